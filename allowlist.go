@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parses the comma-separated namespace/name pairs of the hpas allowed to be processed; an empty allowlist allows all hpas
+func parseHPAAllowlist(value string) (allowlist map[string]bool, err error) {
+	allowlist = map[string]bool{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Hpa allowlist item %v is invalid: should be namespace/name", item)
+		}
+
+		allowlist[item] = true
+	}
+
+	return allowlist, nil
+}
+
+// Returns whether the hpa is in the allowlist, or the allowlist is empty
+func isHorizontalPodAutoscalerAllowed(allowlist map[string]bool, namespace, name string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+
+	return allowlist[namespace+"/"+name]
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHPAAllowlist(t *testing.T) {
+	t.Run("ReturnsNamespaceNamePairs", func(t *testing.T) {
+
+		// act
+		allowlist, err := parseHPAAllowlist("my-namespace/my-app, other-namespace/other-app,")
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]bool{"my-namespace/my-app": true, "other-namespace/other-app": true}, allowlist)
+	})
+
+	t.Run("ReturnsEmptyAllowlistForEmptyValue", func(t *testing.T) {
+
+		// act
+		allowlist, err := parseHPAAllowlist("")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(allowlist))
+	})
+
+	t.Run("ReturnsErrorForItemWithoutNamespace", func(t *testing.T) {
+
+		// act
+		_, err := parseHPAAllowlist("my-namespace/my-app,other-app")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestIsHorizontalPodAutoscalerAllowed(t *testing.T) {
+	t.Run("ReturnsTrueIfAllowlistIsEmpty", func(t *testing.T) {
+
+		// act
+		allowed := isHorizontalPodAutoscalerAllowed(map[string]bool{}, "my-namespace", "my-app")
+
+		assert.True(t, allowed)
+	})
+
+	t.Run("ReturnsTrueIfHPAIsInAllowlist", func(t *testing.T) {
+
+		// act
+		allowed := isHorizontalPodAutoscalerAllowed(map[string]bool{"my-namespace/my-app": true}, "my-namespace", "my-app")
+
+		assert.True(t, allowed)
+	})
+
+	t.Run("ReturnsFalseIfHPAIsNotInAllowlist", func(t *testing.T) {
+
+		// act
+		allowed := isHorizontalPodAutoscalerAllowed(map[string]bool{"my-namespace/my-app": true}, "other-namespace", "my-app")
+
+		assert.False(t, allowed)
+	})
+}
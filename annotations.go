@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+)
+
+const defaultAnnotationPrefix = "estafette.io/hpa-scaler"
+
+// hpaScalerAnnotations holds the keys of the annotations the hpa scaler reads from and writes to an hpa, so they can share a configurable prefix
+type hpaScalerAnnotations struct {
+	Enabled                                string
+	PrometheusQuery                        string
+	QueryWindow                            string
+	OverrideMinReplicasQuery               string
+	RequestsPerReplica                     string
+	Delta                                  string
+	DeltaRatio                             string
+	SafetyFactor                           string
+	PrometheusServerURL                    string
+	PrometheusSecondaryServerURL           string
+	PrometheusServerURLs                   string
+	PrometheusServerAggregation            string
+	PrometheusPathPrefix                   string
+	ScaleDownMaxRatio                      string
+	EnableScaleDownRatioDeploymentChecking string
+	DeploymentInProgressPredicate          string
+	DeploymentInProgressReplicaSets        string
+	Paused                                 string
+	RatchetUpOnly                          string
+	MinChange                              string
+	MinChangeRatio                         string
+	RequestsPerReplicaQuery                string
+	ConcurrencyQuery                       string
+	ConcurrencyPerReplica                  string
+	ScaleToZero                            string
+	MinimumReplicasLowerBound              string
+	ColdStartMinReplicas                   string
+	RoundToMultiple                        string
+	PrometheusQueryRangeSeconds            string
+	PrometheusQueryStepSeconds             string
+	PrometheusQueryAggregation             string
+	PrometheusQueryMode                    string
+	PrometheusCounterIntervalSeconds       string
+	RateUnit                               string
+	TargetLatency                          string
+	HTTPMetricsURL                         string
+	HTTPMetricsJSONPath                    string
+	CloudMonitoringQuery                   string
+	CloudMonitoringProject                 string
+	LatencyGain                            string
+	DisableScaleDownFloor                  string
+	ManageMaxReplicas                      string
+	RespectManualEditsSeconds              string
+	BufferReplicas                         string
+	TargetWindowSize                       string
+	TargetWindowMode                       string
+	RequestRateWindowSize                  string
+	MaxRateDropRatio                       string
+	ScaleDownStabilizationPolls            string
+	WarmupGraceSeconds                     string
+	ReplicasSmoothingFactor                string
+
+	State             string
+	LastRequestRate   string
+	TargetMinReplicas string
+}
+
+// Returns the annotation keys for the prefix, which is used as is for enabling the scaler and followed by a dash for all other annotations
+func newHPAScalerAnnotations(prefix string) hpaScalerAnnotations {
+	prefix = strings.TrimSuffix(prefix, "-")
+
+	return hpaScalerAnnotations{
+		Enabled:                                prefix,
+		PrometheusQuery:                        prefix + "-prometheus-query",
+		QueryWindow:                            prefix + "-query-window",
+		OverrideMinReplicasQuery:               prefix + "-override-min-replicas-query",
+		RequestsPerReplica:                     prefix + "-requests-per-replica",
+		Delta:                                  prefix + "-delta",
+		DeltaRatio:                             prefix + "-delta-ratio",
+		SafetyFactor:                           prefix + "-safety-factor",
+		PrometheusServerURL:                    prefix + "-prometheus-server-url",
+		PrometheusSecondaryServerURL:           prefix + "-prometheus-secondary-server-url",
+		PrometheusServerURLs:                   prefix + "-prometheus-server-urls",
+		PrometheusServerAggregation:            prefix + "-prometheus-server-aggregation",
+		PrometheusPathPrefix:                   prefix + "-prometheus-path-prefix",
+		ScaleDownMaxRatio:                      prefix + "-scale-down-max-ratio",
+		EnableScaleDownRatioDeploymentChecking: prefix + "-enable-scale-down-ratio-deployment-checking",
+		DeploymentInProgressPredicate:          prefix + "-deployment-in-progress-predicate",
+		DeploymentInProgressReplicaSets:        prefix + "-deployment-in-progress-replica-sets",
+		Paused:                                 prefix + "-paused",
+		RatchetUpOnly:                          prefix + "-ratchet-up-only",
+		MinChange:                              prefix + "-min-change",
+		MinChangeRatio:                         prefix + "-min-change-ratio",
+		RequestsPerReplicaQuery:                prefix + "-requests-per-replica-query",
+		ConcurrencyQuery:                       prefix + "-concurrency-query",
+		ConcurrencyPerReplica:                  prefix + "-concurrency-per-replica",
+		ScaleToZero:                            prefix + "-scale-to-zero",
+		MinimumReplicasLowerBound:              prefix + "-minimum-replicas-lower-bound",
+		ColdStartMinReplicas:                   prefix + "-cold-start-min-replicas",
+		RoundToMultiple:                        prefix + "-round-to-multiple",
+		PrometheusQueryRangeSeconds:            prefix + "-prometheus-query-range-seconds",
+		PrometheusQueryStepSeconds:             prefix + "-prometheus-query-step-seconds",
+		PrometheusQueryAggregation:             prefix + "-prometheus-query-aggregation",
+		PrometheusQueryMode:                    prefix + "-prometheus-query-mode",
+		PrometheusCounterIntervalSeconds:       prefix + "-prometheus-counter-interval-seconds",
+		RateUnit:                               prefix + "-rate-unit",
+		TargetLatency:                          prefix + "-target-latency",
+		HTTPMetricsURL:                         prefix + "-http-metrics-url",
+		HTTPMetricsJSONPath:                    prefix + "-http-metrics-jsonpath",
+		CloudMonitoringQuery:                   prefix + "-cloud-monitoring-query",
+		CloudMonitoringProject:                 prefix + "-cloud-monitoring-project",
+		LatencyGain:                            prefix + "-latency-gain",
+		DisableScaleDownFloor:                  prefix + "-disable-scale-down-floor",
+		ManageMaxReplicas:                      prefix + "-manage-max-replicas",
+		RespectManualEditsSeconds:              prefix + "-respect-manual-edits-seconds",
+		BufferReplicas:                         prefix + "-buffer-replicas",
+		TargetWindowSize:                       prefix + "-target-window-size",
+		TargetWindowMode:                       prefix + "-target-window-mode",
+		RequestRateWindowSize:                  prefix + "-request-rate-window-size",
+		MaxRateDropRatio:                       prefix + "-max-rate-drop-ratio",
+		ScaleDownStabilizationPolls:            prefix + "-scale-down-stabilization-polls",
+		WarmupGraceSeconds:                     prefix + "-warmup-grace-seconds",
+		ReplicasSmoothingFactor:                prefix + "-replicas-smoothing-factor",
+
+		State:             prefix + "-state",
+		LastRequestRate:   prefix + "-last-request-rate",
+		TargetMinReplicas: prefix + "-target-min-replicas",
+	}
+}
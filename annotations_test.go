@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHPAScalerAnnotations(t *testing.T) {
+	t.Run("ReturnsEstafetteAnnotationsForDefaultPrefix", func(t *testing.T) {
+
+		// act
+		keys := newHPAScalerAnnotations(defaultAnnotationPrefix)
+
+		assert.Equal(t, "estafette.io/hpa-scaler", keys.Enabled)
+		assert.Equal(t, "estafette.io/hpa-scaler-prometheus-query", keys.PrometheusQuery)
+		assert.Equal(t, "estafette.io/hpa-scaler-enable-scale-down-ratio-deployment-checking", keys.EnableScaleDownRatioDeploymentChecking)
+		assert.Equal(t, "estafette.io/hpa-scaler-state", keys.State)
+	})
+
+	t.Run("IgnoresTrailingDashOfPrefix", func(t *testing.T) {
+
+		// act
+		keys := newHPAScalerAnnotations("mycompany.io/hpa-scaler-")
+
+		assert.Equal(t, "mycompany.io/hpa-scaler", keys.Enabled)
+		assert.Equal(t, "mycompany.io/hpa-scaler-requests-per-replica", keys.RequestsPerReplica)
+	})
+}
+
+func TestGetDesiredHorizontalPodAutoscalerStateWithCustomPrefix(t *testing.T) {
+	t.Run("ReadsAnnotationsWithCustomPrefix", func(t *testing.T) {
+
+		annotations = newHPAScalerAnnotations("mycompany.io/hpa-scaler")
+		defer func() { annotations = newHPAScalerAnnotations(defaultAnnotationPrefix) }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{
+			"mycompany.io/hpa-scaler":                      "true",
+			"mycompany.io/hpa-scaler-prometheus-query":     "requests",
+			"mycompany.io/hpa-scaler-requests-per-replica": "2.5",
+		}
+
+		// act
+		state := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, "true", state.Enabled)
+		assert.Equal(t, "requests", state.PrometheusQuery)
+		assert.Equal(t, 2.5, state.RequestsPerReplica)
+	})
+
+	t.Run("IgnoresAnnotationsWithDefaultPrefix", func(t *testing.T) {
+
+		annotations = newHPAScalerAnnotations("mycompany.io/hpa-scaler")
+		defer func() { annotations = newHPAScalerAnnotations(defaultAnnotationPrefix) }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{
+			"estafette.io/hpa-scaler":                  "true",
+			"estafette.io/hpa-scaler-prometheus-query": "requests",
+		}
+
+		// act
+		state := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, "false", state.Enabled)
+		assert.Equal(t, "", state.PrometheusQuery)
+	})
+}
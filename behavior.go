@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"math"
+	"reflect"
+
+	"github.com/rs/zerolog/log"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	scaleDownModeRatio          = "ratio"
+	scaleDownModeNativeBehavior = "native-behavior"
+
+	// the period matches the poll interval, so the native behavior limits scale down the same way the built-in ratio logic does
+	scaleDownPolicyPeriodSeconds = int32(90)
+)
+
+// Returns the autoscaling v2 scale down rules equivalent to the built-in scale down ratio logic: scale down at most the ratio of current replicas, but at least 1 replica per period
+func getScaleDownRules(desiredState HPAScalerState, stabilizationWindowSeconds int32) *autoscalingv2beta2.HPAScalingRules {
+	selectPolicy := autoscalingv2beta2.MaxPolicySelect
+
+	rules := &autoscalingv2beta2.HPAScalingRules{
+		StabilizationWindowSeconds: &stabilizationWindowSeconds,
+		SelectPolicy:               &selectPolicy,
+		Policies: []autoscalingv2beta2.HPAScalingPolicy{
+			{
+				Type:          autoscalingv2beta2.PodsScalingPolicy,
+				Value:         1,
+				PeriodSeconds: scaleDownPolicyPeriodSeconds,
+			},
+		},
+	}
+
+	percentage := int32(math.Floor(math.Min(desiredState.ScaleDownMaxRatio, 1) * 100))
+	if percentage > 0 {
+		rules.Policies = append(rules.Policies, autoscalingv2beta2.HPAScalingPolicy{
+			Type:          autoscalingv2beta2.PercentScalingPolicy,
+			Value:         percentage,
+			PeriodSeconds: scaleDownPolicyPeriodSeconds,
+		})
+	}
+
+	return rules
+}
+
+// Sets the scale down behavior of the hpa through the autoscaling v2 api, so kubernetes itself limits the scale down rate
+func applyNativeScaleDownBehavior(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, initiator string, desiredState HPAScalerState) (updated bool, err error) {
+	hpaV2, err := kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).Get(ctx, hpa.Name, metav1.GetOptions{})
+	if err != nil {
+		log.Error().Err(err).Msgf("Retrieving autoscaling v2 hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+		return false, &UpdateError{Err: err}
+	}
+
+	scaleDownRules := getScaleDownRules(desiredState, int32(*scaleDownStabilizationWindowSeconds))
+
+	if hpaV2.Spec.Behavior != nil && reflect.DeepEqual(hpaV2.Spec.Behavior.ScaleDown, scaleDownRules) {
+		// don't update hpa
+		return false, nil
+	}
+
+	// throttle updates to avoid hitting the api server's limits
+	if err := waitForUpdateRateLimiter(ctx); err != nil {
+		log.Error().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Waiting for update rate limiter failed", initiator, hpa.Name, hpa.Namespace)
+		return false, &UpdateError{Err: err}
+	}
+
+	log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Updating scale down behavior of hpa...", initiator, hpa.Name, hpa.Namespace)
+
+	if hpaV2.Spec.Behavior == nil {
+		hpaV2.Spec.Behavior = &autoscalingv2beta2.HorizontalPodAutoscalerBehavior{}
+	}
+	hpaV2.Spec.Behavior.ScaleDown = scaleDownRules
+
+	_, err = kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).Update(ctx, hpaV2, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return false, &UpdateError{Err: err}
+	}
+
+	log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Updated scale down behavior of hpa successfully...", initiator, hpa.Name, hpa.Namespace)
+
+	return true, nil
+}
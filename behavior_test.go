@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetScaleDownRules(t *testing.T) {
+	t.Run("ReturnsPercentPolicyFromScaleDownMaxRatio", func(t *testing.T) {
+
+		desiredState := HPAScalerState{ScaleDownMaxRatio: 0.2}
+
+		// act
+		rules := getScaleDownRules(desiredState, 300)
+
+		assert.Equal(t, int32(300), *rules.StabilizationWindowSeconds)
+		assert.Equal(t, autoscalingv2beta2.MaxPolicySelect, *rules.SelectPolicy)
+		assert.Equal(t, 2, len(rules.Policies))
+		assert.Equal(t, autoscalingv2beta2.PodsScalingPolicy, rules.Policies[0].Type)
+		assert.Equal(t, int32(1), rules.Policies[0].Value)
+		assert.Equal(t, autoscalingv2beta2.PercentScalingPolicy, rules.Policies[1].Type)
+		assert.Equal(t, int32(20), rules.Policies[1].Value)
+	})
+
+	t.Run("ReturnsOnlyPodsPolicyIfScaleDownMaxRatioIsZero", func(t *testing.T) {
+
+		desiredState := HPAScalerState{ScaleDownMaxRatio: 0}
+
+		// act
+		rules := getScaleDownRules(desiredState, 300)
+
+		assert.Equal(t, 1, len(rules.Policies))
+		assert.Equal(t, autoscalingv2beta2.PodsScalingPolicy, rules.Policies[0].Type)
+	})
+
+	t.Run("CapsPercentPolicyAtHundred", func(t *testing.T) {
+
+		desiredState := HPAScalerState{ScaleDownMaxRatio: 1.5}
+
+		// act
+		rules := getScaleDownRules(desiredState, 300)
+
+		assert.Equal(t, int32(100), rules.Policies[1].Value)
+	})
+}
+
+func TestApplyNativeScaleDownBehavior(t *testing.T) {
+	t.Run("SetsScaleDownBehaviorOnV2HPA", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpaV2 := &autoscalingv2beta2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: hpa.Name, Namespace: hpa.Namespace},
+		}
+		kubeClient := fake.NewSimpleClientset(hpaV2)
+		desiredState := HPAScalerState{ScaleDownMaxRatio: 0.2}
+
+		// act
+		updated, err := applyNativeScaleDownBehavior(context.Background(), kubeClient, hpa, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.True(t, updated)
+		updatedHPAV2, _ := kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).Get(context.Background(), hpa.Name, metav1.GetOptions{})
+		assert.Equal(t, int32(20), updatedHPAV2.Spec.Behavior.ScaleDown.Policies[1].Value)
+	})
+
+	t.Run("DoesNotUpdateIfScaleDownBehaviorIsUnchanged", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{ScaleDownMaxRatio: 0.2}
+		hpaV2 := &autoscalingv2beta2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: hpa.Name, Namespace: hpa.Namespace},
+			Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+				Behavior: &autoscalingv2beta2.HorizontalPodAutoscalerBehavior{
+					ScaleDown: getScaleDownRules(desiredState, int32(*scaleDownStabilizationWindowSeconds)),
+				},
+			},
+		}
+		kubeClient := fake.NewSimpleClientset(hpaV2)
+
+		// act
+		updated, err := applyNativeScaleDownBehavior(context.Background(), kubeClient, hpa, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.False(t, updated)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+}
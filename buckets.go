@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// the buckets of the target min replicas histogram unless overridden with --target-min-replicas-buckets
+var defaultTargetMinReplicasBuckets = prometheus.ExponentialBuckets(1, 2, 11)
+
+// Returns the histogram for the target min replicas with the buckets, or the default buckets if none are passed
+func newTargetMinReplicasHistogram(buckets []float64) prometheus.Histogram {
+	if len(buckets) == 0 {
+		buckets = defaultTargetMinReplicasBuckets
+	}
+
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "target_min_replicas",
+		Help:    "The target minimum number of replicas computed per hpa on each poll.",
+		Buckets: buckets,
+	})
+}
+
+// Parses comma-separated histogram bucket upper bounds, which have to be in increasing order
+func parseHistogramBuckets(value string) (buckets []float64, err error) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		bucket, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Histogram bucket %v is invalid: should be a number", item)
+		}
+		if len(buckets) > 0 && bucket <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("Histogram bucket %v is invalid: should be larger than the previous bucket", item)
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, nil
+}
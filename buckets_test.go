@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHistogramBuckets(t *testing.T) {
+	t.Run("ReturnsBucketsInOrder", func(t *testing.T) {
+
+		// act
+		buckets, err := parseHistogramBuckets("1, 2.5,10,")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []float64{1, 2.5, 10}, buckets)
+	})
+
+	t.Run("ReturnsNoBucketsForEmptyValue", func(t *testing.T) {
+
+		// act
+		buckets, err := parseHistogramBuckets("")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(buckets))
+	})
+
+	t.Run("ReturnsErrorIfBucketIsNotANumber", func(t *testing.T) {
+
+		// act
+		_, err := parseHistogramBuckets("1,two,3")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfBucketsAreNotIncreasing", func(t *testing.T) {
+
+		// act
+		_, err := parseHistogramBuckets("1,5,5")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestNewTargetMinReplicasHistogram(t *testing.T) {
+	t.Run("UsesDefaultBucketsIfNoneAreConfigured", func(t *testing.T) {
+
+		// act
+		histogram := newTargetMinReplicasHistogram(nil)
+		histogram.Observe(3)
+
+		metric := &dto.Metric{}
+		histogram.Write(metric)
+		assert.Equal(t, len(defaultTargetMinReplicasBuckets), len(metric.Histogram.Bucket))
+	})
+
+	t.Run("UsesConfiguredBuckets", func(t *testing.T) {
+
+		// act
+		histogram := newTargetMinReplicasHistogram([]float64{5, 50})
+		histogram.Observe(3)
+		histogram.Observe(30)
+
+		metric := &dto.Metric{}
+		histogram.Write(metric)
+		assert.Equal(t, 2, len(metric.Histogram.Bucket))
+		assert.Equal(t, uint64(1), metric.Histogram.Bucket[0].GetCumulativeCount())
+		assert.Equal(t, uint64(2), metric.Histogram.Bucket[1].GetCumulativeCount())
+		assert.Equal(t, uint64(2), metric.Histogram.GetSampleCount())
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sort"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+)
+
+// pendingChange is a change of minReplicas of an hpa that was computed but not applied yet
+type pendingChange struct {
+	hpa   *autoscalingv1.HorizontalPodAutoscaler
+	delta int32
+}
+
+// changePlanner limits the number of hpas changed per poll iteration: changes are first collected, and only the allowed ones are applied afterwards
+type changePlanner struct {
+	allowed map[namespacedName]bool
+	pending []pendingChange
+}
+
+// plans the changes of the current poll iteration when --max-changes-per-iteration is set, nil otherwise
+var changePlan *changePlanner
+
+func newChangePlanner() *changePlanner {
+	return &changePlanner{allowed: map[namespacedName]bool{}}
+}
+
+// Returns whether the change of the hpa can be applied, recording it as pending otherwise
+func (p *changePlanner) allow(hpa *autoscalingv1.HorizontalPodAutoscaler, delta int32) bool {
+	if p.allowed[namespacedName{hpa.Namespace, hpa.Name}] {
+		return true
+	}
+
+	p.pending = append(p.pending, pendingChange{hpa: hpa.DeepCopy(), delta: delta})
+
+	return false
+}
+
+// Allows the pending changes with the largest absolute delta, at most max of them, and returns the allowed and the still deferred changes
+func (p *changePlanner) selectChanges(max int) (selected, deferred []pendingChange) {
+	sorted := append([]pendingChange{}, p.pending...)
+	sort.SliceStable(sorted, func(i, j int) bool { return absInt32(sorted[i].delta) > absInt32(sorted[j].delta) })
+
+	if len(sorted) > max {
+		selected, deferred = sorted[:max], sorted[max:]
+	} else {
+		selected = sorted
+	}
+
+	for _, change := range selected {
+		p.allowed[namespacedName{change.hpa.Namespace, change.hpa.Name}] = true
+	}
+	p.pending = nil
+
+	return selected, deferred
+}
+
+func absInt32(value int32) int32 {
+	if value < 0 {
+		return -value
+	}
+
+	return value
+}
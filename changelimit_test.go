@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangePlanner(t *testing.T) {
+	t.Run("DefersChangesUntilAllowed", func(t *testing.T) {
+
+		planner := newChangePlanner()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+
+		// act
+		allowed := planner.allow(hpa, 5)
+
+		assert.False(t, allowed)
+		assert.Equal(t, 1, len(planner.pending))
+		planner.selectChanges(1)
+		assert.True(t, planner.allow(hpa, 5))
+	})
+
+	t.Run("SelectsLargestAbsoluteDeltas", func(t *testing.T) {
+
+		planner := newChangePlanner()
+		for name, delta := range map[string]int32{"small": 1, "large-down": -8, "medium": 4, "large-up": 6} {
+			hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+			hpa.Name = name
+			planner.allow(hpa, delta)
+		}
+
+		// act
+		selected, deferred := planner.selectChanges(2)
+
+		assert.Equal(t, 2, len(selected))
+		assert.Equal(t, "large-down", selected[0].hpa.Name)
+		assert.Equal(t, "large-up", selected[1].hpa.Name)
+		assert.Equal(t, 2, len(deferred))
+		assert.Equal(t, "medium", deferred[0].hpa.Name)
+		assert.Equal(t, "small", deferred[1].hpa.Name)
+		assert.Equal(t, 0, len(planner.pending))
+	})
+
+	t.Run("SelectsAllChangesIfBelowMax", func(t *testing.T) {
+
+		planner := newChangePlanner()
+		planner.allow(newTestHorizontalPodAutoscaler(3, 20, 10), 5)
+
+		// act
+		selected, deferred := planner.selectChanges(2)
+
+		assert.Equal(t, 1, len(selected))
+		assert.Equal(t, 0, len(deferred))
+	})
+}
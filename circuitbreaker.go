@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	circuitBreakerClosed   = "closed"
+	circuitBreakerOpen     = "open"
+	circuitBreakerHalfOpen = "half-open"
+)
+
+// circuitBreaker short-circuits calls to a failing dependency, keyed by for example the prometheus server url
+type circuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+	now              func() time.Time
+
+	mutex  sync.Mutex
+	states map[string]*circuitBreakerState
+}
+
+type circuitBreakerState struct {
+	consecutiveFailures int
+	openedAt            time.Time
+	trialInProgress     bool
+}
+
+func newCircuitBreaker(failureThreshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		now:              time.Now,
+		states:           map[string]*circuitBreakerState{},
+	}
+}
+
+// Allow returns whether a call for key can go ahead; once the cooldown of an open breaker has passed a single trial call is let through (half-open)
+func (cb *circuitBreaker) Allow(key string) bool {
+	if cb == nil || cb.failureThreshold <= 0 {
+		return true
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	state := cb.getState(key)
+	switch cb.status(state) {
+	case circuitBreakerOpen:
+		return false
+	case circuitBreakerHalfOpen:
+		if state.trialInProgress {
+			return false
+		}
+		state.trialInProgress = true
+		return true
+	}
+
+	return true
+}
+
+// RecordSuccess closes the breaker for key
+func (cb *circuitBreaker) RecordSuccess(key string) {
+	if cb == nil || cb.failureThreshold <= 0 {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	state := cb.getState(key)
+	state.consecutiveFailures = 0
+	state.trialInProgress = false
+	state.openedAt = time.Time{}
+
+	prometheusCircuitBreakerStateVector.WithLabelValues(key).Set(0)
+}
+
+// RecordFailure counts a failure for key and opens the breaker once the threshold of consecutive failures is reached or the half-open trial call failed
+func (cb *circuitBreaker) RecordFailure(key string) {
+	if cb == nil || cb.failureThreshold <= 0 {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	state := cb.getState(key)
+	state.consecutiveFailures++
+
+	if state.trialInProgress || state.consecutiveFailures >= cb.failureThreshold {
+		state.openedAt = cb.now()
+		state.trialInProgress = false
+
+		prometheusCircuitBreakerStateVector.WithLabelValues(key).Set(1)
+	}
+}
+
+// Abandon ends a call for key that was cancelled before its outcome was known, without counting it; a half-open breaker lets another trial call through
+func (cb *circuitBreaker) Abandon(key string) {
+	if cb == nil || cb.failureThreshold <= 0 {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	state := cb.getState(key)
+	state.trialInProgress = false
+}
+
+// Status returns closed, open or half-open for key
+func (cb *circuitBreaker) Status(key string) string {
+	if cb == nil || cb.failureThreshold <= 0 {
+		return circuitBreakerClosed
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.status(cb.getState(key))
+}
+
+func (cb *circuitBreaker) status(state *circuitBreakerState) string {
+	if state.openedAt.IsZero() {
+		return circuitBreakerClosed
+	}
+	if cb.now().Sub(state.openedAt) < cb.cooldown {
+		return circuitBreakerOpen
+	}
+
+	return circuitBreakerHalfOpen
+}
+
+func (cb *circuitBreaker) getState(key string) *circuitBreakerState {
+	state, ok := cb.states[key]
+	if !ok {
+		state = &circuitBreakerState{}
+		cb.states[key] = state
+	}
+
+	return state
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("AllowsCallsWhileFailuresStayBelowThreshold", func(t *testing.T) {
+
+		cb := newCircuitBreaker(3, time.Minute)
+		cb.RecordFailure("http://prometheus")
+		cb.RecordFailure("http://prometheus")
+
+		// act
+		allowed := cb.Allow("http://prometheus")
+
+		assert.True(t, allowed)
+		assert.Equal(t, circuitBreakerClosed, cb.Status("http://prometheus"))
+	})
+
+	t.Run("OpensAfterConsecutiveFailuresReachThreshold", func(t *testing.T) {
+
+		cb := newCircuitBreaker(3, time.Minute)
+		cb.RecordFailure("http://prometheus")
+		cb.RecordFailure("http://prometheus")
+		cb.RecordFailure("http://prometheus")
+
+		// act
+		allowed := cb.Allow("http://prometheus")
+
+		assert.False(t, allowed)
+		assert.Equal(t, circuitBreakerOpen, cb.Status("http://prometheus"))
+		assert.True(t, cb.Allow("http://other-prometheus"))
+	})
+
+	t.Run("SuccessResetsConsecutiveFailures", func(t *testing.T) {
+
+		cb := newCircuitBreaker(2, time.Minute)
+		cb.RecordFailure("http://prometheus")
+		cb.RecordSuccess("http://prometheus")
+		cb.RecordFailure("http://prometheus")
+
+		// act
+		allowed := cb.Allow("http://prometheus")
+
+		assert.True(t, allowed)
+	})
+
+	t.Run("LetsSingleTrialCallThroughWhenHalfOpen", func(t *testing.T) {
+
+		now := time.Now()
+		cb := newCircuitBreaker(1, time.Minute)
+		cb.now = func() time.Time { return now }
+		cb.RecordFailure("http://prometheus")
+		now = now.Add(2 * time.Minute)
+
+		// act
+		firstAllowed := cb.Allow("http://prometheus")
+		secondAllowed := cb.Allow("http://prometheus")
+
+		assert.Equal(t, circuitBreakerHalfOpen, cb.Status("http://prometheus"))
+		assert.True(t, firstAllowed)
+		assert.False(t, secondAllowed)
+	})
+
+	t.Run("ClosesWhenHalfOpenTrialCallSucceeds", func(t *testing.T) {
+
+		now := time.Now()
+		cb := newCircuitBreaker(1, time.Minute)
+		cb.now = func() time.Time { return now }
+		cb.RecordFailure("http://prometheus")
+		now = now.Add(2 * time.Minute)
+		cb.Allow("http://prometheus")
+
+		// act
+		cb.RecordSuccess("http://prometheus")
+
+		assert.Equal(t, circuitBreakerClosed, cb.Status("http://prometheus"))
+		assert.True(t, cb.Allow("http://prometheus"))
+	})
+
+	t.Run("ReopensWhenHalfOpenTrialCallFails", func(t *testing.T) {
+
+		now := time.Now()
+		cb := newCircuitBreaker(3, time.Minute)
+		cb.now = func() time.Time { return now }
+		cb.RecordFailure("http://prometheus")
+		cb.RecordFailure("http://prometheus")
+		cb.RecordFailure("http://prometheus")
+		now = now.Add(2 * time.Minute)
+		cb.Allow("http://prometheus")
+
+		// act
+		cb.RecordFailure("http://prometheus")
+
+		assert.Equal(t, circuitBreakerOpen, cb.Status("http://prometheus"))
+		assert.False(t, cb.Allow("http://prometheus"))
+	})
+
+	t.Run("DoesNotCountAbandonedCall", func(t *testing.T) {
+
+		cb := newCircuitBreaker(2, time.Minute)
+		cb.RecordFailure("http://prometheus")
+
+		// act
+		cb.Abandon("http://prometheus")
+
+		assert.Equal(t, circuitBreakerClosed, cb.Status("http://prometheus"))
+		assert.True(t, cb.Allow("http://prometheus"))
+	})
+
+	t.Run("LetsAnotherTrialCallThroughWhenHalfOpenTrialCallIsAbandoned", func(t *testing.T) {
+
+		now := time.Now()
+		cb := newCircuitBreaker(3, time.Minute)
+		cb.now = func() time.Time { return now }
+		cb.RecordFailure("http://prometheus")
+		cb.RecordFailure("http://prometheus")
+		cb.RecordFailure("http://prometheus")
+		now = now.Add(2 * time.Minute)
+		cb.Allow("http://prometheus")
+
+		// act
+		cb.Abandon("http://prometheus")
+
+		assert.Equal(t, circuitBreakerHalfOpen, cb.Status("http://prometheus"))
+		assert.True(t, cb.Allow("http://prometheus"))
+	})
+
+	t.Run("NeverOpensWhenDisabled", func(t *testing.T) {
+
+		cb := newCircuitBreaker(0, time.Minute)
+		cb.RecordFailure("http://prometheus")
+
+		// act
+		allowed := cb.Allow("http://prometheus")
+
+		assert.True(t, allowed)
+	})
+}
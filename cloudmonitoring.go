@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/oauth2/google"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+)
+
+const (
+	cloudMonitoringBaseURL   = "https://monitoring.googleapis.com"
+	cloudMonitoringReadScope = "https://www.googleapis.com/auth/monitoring.read"
+)
+
+// cloudMonitoringClient runs a Monitoring Query Language query against Google Cloud Monitoring and returns the latest value of each time series
+type cloudMonitoringClient interface {
+	QueryTimeSeries(ctx context.Context, project, query string) ([]float64, error)
+}
+
+// the client for hpas with a cloud monitoring query when --cloud-monitoring-project is set, nil otherwise
+var cloudMonitoring cloudMonitoringClient
+
+// cloudMonitoringHTTPClient queries the Cloud Monitoring api with the application default credentials, the same the gcp auth plugin of the kubernetes client uses
+type cloudMonitoringHTTPClient struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+func newCloudMonitoringHTTPClient(ctx context.Context) (*cloudMonitoringHTTPClient, error) {
+	httpClient, err := google.DefaultClient(ctx, cloudMonitoringReadScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cloudMonitoringHTTPClient{httpClient: httpClient, baseURL: cloudMonitoringBaseURL}, nil
+}
+
+// cloudMonitoringQueryResponse is used to unmarshal the response of the timeSeries:query method, of which only the values are used
+// {"timeSeriesDescriptor":{...},"timeSeriesData":[{"labelValues":[...],"pointData":[{"values":[{"doubleValue":225.4}],"timeInterval":{...}}]}]}
+type cloudMonitoringQueryResponse struct {
+	TimeSeriesData []struct {
+		PointData []struct {
+			Values []cloudMonitoringTypedValue `json:"values"`
+		} `json:"pointData"`
+	} `json:"timeSeriesData"`
+}
+
+// cloudMonitoringTypedValue holds a single value of a point, with int64 values encoded as strings
+type cloudMonitoringTypedValue struct {
+	DoubleValue *float64 `json:"doubleValue"`
+	Int64Value  *string  `json:"int64Value"`
+}
+
+// QueryTimeSeries runs the query in the project and returns the first value of the latest point of each time series
+func (c *cloudMonitoringHTTPClient) QueryTimeSeries(ctx context.Context, project, query string) ([]float64, error) {
+	requestBody, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%v/v3/projects/%v/timeSeries:query", c.baseURL, url.PathEscape(project)), bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", getUserAgent(*prometheusUserAgent))
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Cloud Monitoring query in project %v responded with status %v: %v", project, resp.StatusCode, string(body))
+	}
+
+	var queryResponse cloudMonitoringQueryResponse
+	if err := json.Unmarshal(body, &queryResponse); err != nil {
+		return nil, err
+	}
+
+	return queryResponse.getLatestValues()
+}
+
+// Returns the first value of the latest point of each time series; the api returns the points newest first
+func (r *cloudMonitoringQueryResponse) getLatestValues() ([]float64, error) {
+	values := []float64{}
+	for _, timeSeries := range r.TimeSeriesData {
+		if len(timeSeries.PointData) == 0 || len(timeSeries.PointData[0].Values) == 0 {
+			continue
+		}
+
+		value := timeSeries.PointData[0].Values[0]
+		switch {
+		case value.DoubleValue != nil:
+			values = append(values, *value.DoubleValue)
+		case value.Int64Value != nil:
+			f, err := strconv.ParseFloat(*value.Int64Value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("The value %v in the Cloud Monitoring response is not a number: %v", *value.Int64Value, err)
+			}
+			values = append(values, f)
+		default:
+			return nil, errors.New("The values in the Cloud Monitoring response should be double or int64 values")
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, errors.New("The Cloud Monitoring query didn't return any time series")
+	}
+
+	return values, nil
+}
+
+// Returns the request rates from the Cloud Monitoring query of the hpa, one per time series
+func getRequestRatesFromCloudMonitoring(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) ([]float64, error) {
+	if cloudMonitoring == nil {
+		return nil, fmt.Errorf("Hpa %v in namespace %v has a Cloud Monitoring query, but Cloud Monitoring isn't enabled; set --cloud-monitoring-project", hpa.Name, hpa.Namespace)
+	}
+
+	return cloudMonitoring.QueryTimeSeries(ctx, desiredState.CloudMonitoringProject, desiredState.CloudMonitoringQuery)
+}
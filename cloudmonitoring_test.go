@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubCloudMonitoringClient struct {
+	values  []float64
+	err     error
+	project string
+	query   string
+}
+
+func (c *stubCloudMonitoringClient) QueryTimeSeries(ctx context.Context, project, query string) ([]float64, error) {
+	c.project = project
+	c.query = query
+	return c.values, c.err
+}
+
+func TestCloudMonitoringHTTPClientQueryTimeSeries(t *testing.T) {
+	t.Run("PostsQueryToProjectAndReturnsLatestValueOfEachTimeSeries", func(t *testing.T) {
+
+		var path, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			fmt.Fprint(w, `{"timeSeriesData":[{"pointData":[{"values":[{"doubleValue":225.4}]},{"values":[{"doubleValue":180}]}]},{"pointData":[{"values":[{"int64Value":"30"}]}]}]}`)
+		}))
+		defer server.Close()
+		client := &cloudMonitoringHTTPClient{httpClient: server.Client(), baseURL: server.URL}
+
+		// act
+		values, err := client.QueryTimeSeries(context.Background(), "my-project", "fetch https_lb_rule | every 1m")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []float64{225.4, 30}, values)
+		assert.Equal(t, "/v3/projects/my-project/timeSeries:query", path)
+		assert.Equal(t, `{"query":"fetch https_lb_rule | every 1m"}`, body)
+	})
+
+	t.Run("ReturnsErrorIfQueryReturnsNoTimeSeries", func(t *testing.T) {
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{}`)
+		}))
+		defer server.Close()
+		client := &cloudMonitoringHTTPClient{httpClient: server.Client(), baseURL: server.URL}
+
+		// act
+		_, err := client.QueryTimeSeries(context.Background(), "my-project", "fetch https_lb_rule")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfApiFails", func(t *testing.T) {
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+		client := &cloudMonitoringHTTPClient{httpClient: server.Client(), baseURL: server.URL}
+
+		// act
+		_, err := client.QueryTimeSeries(context.Background(), "my-project", "fetch https_lb_rule")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestParseCloudMonitoringAnnotations(t *testing.T) {
+	t.Run("ReadsQueryAndProjectFromAnnotations", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-cloud-monitoring-query": "fetch https_lb_rule", "estafette.io/hpa-scaler-cloud-monitoring-project": "my-project"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, "fetch https_lb_rule", state.CloudMonitoringQuery)
+		assert.Equal(t, "my-project", state.CloudMonitoringProject)
+	})
+
+	t.Run("ReturnsErrorForQueryWithoutProject", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-cloud-monitoring-query": "fetch https_lb_rule"}
+
+		// act
+		_, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 1, len(errs))
+	})
+}
+
+func TestGetMinPodCountBasedOnCloudMonitoring(t *testing.T) {
+	t.Run("DividesRequestRateFromCloudMonitoringByRequestsPerReplica", func(t *testing.T) {
+
+		stub := &stubCloudMonitoringClient{values: []float64{100}}
+		cloudMonitoring = stub
+		defer func() { cloudMonitoring = nil }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{CloudMonitoringQuery: "fetch https_lb_rule", CloudMonitoringProject: "my-project", RequestsPerReplica: 20}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+		assert.Equal(t, "my-project", stub.project)
+		assert.Equal(t, "fetch https_lb_rule", stub.query)
+	})
+
+	t.Run("ReturnsQueryErrorIfCloudMonitoringFails", func(t *testing.T) {
+
+		cloudMonitoring = &stubCloudMonitoringClient{err: errors.New("permission denied")}
+		defer func() { cloudMonitoring = nil }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{CloudMonitoringQuery: "fetch https_lb_rule", CloudMonitoringProject: "my-project", RequestsPerReplica: 20}
+
+		// act
+		_, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		_, isQueryError := err.(*QueryError)
+		assert.True(t, isQueryError)
+	})
+
+	t.Run("ReturnsQueryErrorIfCloudMonitoringIsNotEnabled", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{CloudMonitoringQuery: "fetch https_lb_rule", CloudMonitoringProject: "my-project", RequestsPerReplica: 20}
+
+		// act
+		_, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		_, isQueryError := err.(*QueryError)
+		assert.True(t, isQueryError)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"math"
+
+	"github.com/rs/zerolog/log"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+)
+
+// Returns the minimum pod count needed for the requests in flight returned by the concurrency query, along with that concurrency.
+// By Little's Law the concurrency is the request rate times the latency, so it can be queried directly or calculated in the query from both.
+// The concurrency per replica is validated when parsing the annotations, which drops the query if it isn't positive.
+func getMinPodCountBasedOnConcurrency(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) (minPodCount int32, concurrency float64, err error) {
+	concurrencyQuery, err := renderPrometheusQuery(desiredState.ConcurrencyQuery, desiredState.QueryWindow)
+	if err != nil {
+		log.Error().Err(err).Msgf("Rendering concurrency query for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+		return 0, 0, &QueryError{Err: err}
+	}
+
+	queryResponse, err := executePrometheusQueryWithFallback(ctx, hpa, desiredState, concurrencyQuery, 0, 0)
+	if err != nil {
+		return 0, 0, &QueryError{Err: err}
+	}
+
+	concurrencies, err := queryResponse.GetValues()
+	if err != nil {
+		log.Error().Err(err).Msgf("Retrieving concurrency from query response body for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+		return 0, 0, &QueryError{Err: err}
+	}
+
+	// the requests in flight of all series, for example one per pod, have to be served together
+	for _, c := range concurrencies {
+		concurrency += c
+	}
+
+	return getReplicasForConcurrency(concurrency, desiredState.ConcurrencyPerReplica, desiredState.SafetyFactor), concurrency, nil
+}
+
+// Returns the replicas needed to serve the requests in flight, each replica serving at most concurrencyPerReplica of them at once
+func getReplicasForConcurrency(concurrency, concurrencyPerReplica, safetyFactor float64) int32 {
+	if safetyFactor <= 0 {
+		safetyFactor = 1
+	}
+
+	return int32(math.Ceil(safetyFactor * concurrency / concurrencyPerReplica))
+}
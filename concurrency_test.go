@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReplicasForConcurrency(t *testing.T) {
+	t.Run("DividesConcurrencyByConcurrencyPerReplicaRoundedUp", func(t *testing.T) {
+
+		// act
+		replicas := getReplicasForConcurrency(45, 10, 1)
+
+		assert.Equal(t, int32(5), replicas)
+	})
+
+	t.Run("MultipliesBySafetyFactor", func(t *testing.T) {
+
+		// act
+		replicas := getReplicasForConcurrency(40, 10, 1.5)
+
+		assert.Equal(t, int32(6), replicas)
+	})
+
+	t.Run("IgnoresSafetyFactorOfZero", func(t *testing.T) {
+
+		// act
+		replicas := getReplicasForConcurrency(40, 10, 0)
+
+		assert.Equal(t, int32(4), replicas)
+	})
+}
+
+func TestGetMinPodCountBasedOnConcurrency(t *testing.T) {
+	t.Run("DividesSumOfConcurrencyOfAllSeriesByConcurrencyPerReplica", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"in_flight": "25"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, ConcurrencyQuery: "in_flight", ConcurrencyPerReplica: 4}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(7), minPodCount)
+		assert.Equal(t, float64(0), requestRate)
+	})
+
+	t.Run("UsesConcurrencyIfItNeedsMoreReplicasThanRequestRate", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100", "in_flight": "40"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, ConcurrencyQuery: "in_flight", ConcurrencyPerReplica: 5}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(8), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("UsesRequestRateIfItNeedsMoreReplicasThanConcurrency", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "200", "in_flight": "40"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, ConcurrencyQuery: "in_flight", ConcurrencyPerReplica: 5}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(10), minPodCount)
+	})
+
+	t.Run("ReturnsQueryErrorIfConcurrencyQueryFails", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, ConcurrencyQuery: "in_flight", ConcurrencyPerReplica: 5}
+
+		// act
+		_, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		_, isQueryError := err.(*QueryError)
+		assert.True(t, isQueryError)
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// the type of the condition describing the outcome of the last time this application processed the hpa
+const statusConditionType = autoscalingv2beta2.HorizontalPodAutoscalerConditionType("HPAScalerReconciled")
+
+// Returns the condition describing the processing result of the hpa; only failures have status false
+func getStatusCondition(result processingResult, err error) autoscalingv2beta2.HorizontalPodAutoscalerCondition {
+	condition := autoscalingv2beta2.HorizontalPodAutoscalerCondition{
+		Type:    statusConditionType,
+		Status:  corev1.ConditionTrue,
+		Reason:  getStatusConditionReason(result.Reason),
+		Message: fmt.Sprintf("Processing the hpa %v with reason %v", result.Status, result.Reason),
+	}
+
+	if result.Status == "failed" {
+		condition.Status = corev1.ConditionFalse
+		if err != nil {
+			condition.Message = err.Error()
+		}
+	}
+
+	return condition
+}
+
+// Returns the reason in the CamelCase expected for conditions, for example BelowMinChange for below-min-change
+func getStatusConditionReason(reason string) string {
+	words := strings.Split(reason, "-")
+	for i, word := range words {
+		if len(word) > 0 {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+
+	return strings.Join(words, "")
+}
+
+// Sets the condition describing the processing result in the status of the hpa through the autoscaling v2 api; it's only updated when the condition changes
+func setStatusCondition(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, initiator string, result processingResult, processingErr error, now metav1.Time) (updated bool, err error) {
+	hpaV2, err := kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).Get(ctx, hpa.Name, metav1.GetOptions{})
+	if err != nil {
+		log.Error().Err(err).Msgf("Retrieving autoscaling v2 hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+		return false, &UpdateError{Err: err}
+	}
+
+	condition := getStatusCondition(result, processingErr)
+	condition.LastTransitionTime = now
+
+	index := -1
+	for i, existingCondition := range hpaV2.Status.Conditions {
+		if existingCondition.Type == statusConditionType {
+			index = i
+			break
+		}
+	}
+
+	if index >= 0 {
+		existingCondition := hpaV2.Status.Conditions[index]
+		if existingCondition.Status == condition.Status && existingCondition.Reason == condition.Reason && existingCondition.Message == condition.Message {
+			// don't update hpa
+			return false, nil
+		}
+		if existingCondition.Status == condition.Status {
+			// the transition time only changes along with the status
+			condition.LastTransitionTime = existingCondition.LastTransitionTime
+		}
+		hpaV2.Status.Conditions[index] = condition
+	} else {
+		hpaV2.Status.Conditions = append(hpaV2.Status.Conditions, condition)
+	}
+
+	// throttle updates to avoid hitting the api server's limits
+	if err := waitForUpdateRateLimiter(ctx); err != nil {
+		log.Error().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Waiting for update rate limiter failed", initiator, hpa.Name, hpa.Namespace)
+		return false, &UpdateError{Err: err}
+	}
+
+	_, err = kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).UpdateStatus(ctx, hpaV2, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Updating status condition failed", initiator, hpa.Name, hpa.Namespace)
+		return false, &UpdateError{Err: err}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetStatusConditionReason(t *testing.T) {
+	testCases := []struct {
+		reason         string
+		expectedReason string
+	}{
+		{reasonUpdated, "Updated"},
+		{reasonBelowMinChange, "BelowMinChange"},
+		{reasonQueryFailed, "QueryFailed"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("Returns%vFor%v", tc.expectedReason, tc.reason), func(t *testing.T) {
+
+			// act
+			reason := getStatusConditionReason(tc.reason)
+
+			assert.Equal(t, tc.expectedReason, reason)
+		})
+	}
+}
+
+func TestSetStatusCondition(t *testing.T) {
+	now := metav1.NewTime(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	t.Run("AddsConditionWithReasonAndMessage", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpaV2 := &autoscalingv2beta2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: hpa.Name, Namespace: hpa.Namespace},
+			Status: autoscalingv2beta2.HorizontalPodAutoscalerStatus{
+				Conditions: []autoscalingv2beta2.HorizontalPodAutoscalerCondition{
+					{Type: autoscalingv2beta2.AbleToScale, Status: corev1.ConditionTrue, Reason: "ReadyForNewScale"},
+				},
+			},
+		}
+		kubeClient := fake.NewSimpleClientset(hpaV2)
+
+		// act
+		updated, err := setStatusCondition(context.Background(), kubeClient, hpa, "test", processingResult{"succeeded", reasonUpdated}, nil, now)
+
+		assert.Nil(t, err)
+		assert.True(t, updated)
+		updatedHPAV2, _ := kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).Get(context.Background(), hpa.Name, metav1.GetOptions{})
+		assert.Equal(t, 2, len(updatedHPAV2.Status.Conditions))
+		condition := updatedHPAV2.Status.Conditions[1]
+		assert.Equal(t, statusConditionType, condition.Type)
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, "Updated", condition.Reason)
+		assert.Equal(t, "Processing the hpa succeeded with reason updated", condition.Message)
+		assert.True(t, now.Equal(&condition.LastTransitionTime))
+	})
+
+	t.Run("SetsStatusFalseWithErrorMessageIfProcessingFailed", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpaV2 := &autoscalingv2beta2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: hpa.Name, Namespace: hpa.Namespace},
+		}
+		kubeClient := fake.NewSimpleClientset(hpaV2)
+
+		// act
+		_, err := setStatusCondition(context.Background(), kubeClient, hpa, "test", processingResult{"failed", reasonQueryFailed}, &QueryError{Err: errors.New("prometheus unavailable")}, now)
+
+		assert.Nil(t, err)
+		updatedHPAV2, _ := kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).Get(context.Background(), hpa.Name, metav1.GetOptions{})
+		condition := updatedHPAV2.Status.Conditions[0]
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, "QueryFailed", condition.Reason)
+		assert.Equal(t, "prometheus unavailable", condition.Message)
+	})
+
+	t.Run("DoesNotUpdateIfConditionIsUnchanged", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		result := processingResult{"skipped", reasonNoChange}
+		condition := getStatusCondition(result, nil)
+		hpaV2 := &autoscalingv2beta2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: hpa.Name, Namespace: hpa.Namespace},
+			Status:     autoscalingv2beta2.HorizontalPodAutoscalerStatus{Conditions: []autoscalingv2beta2.HorizontalPodAutoscalerCondition{condition}},
+		}
+		kubeClient := fake.NewSimpleClientset(hpaV2)
+
+		// act
+		updated, err := setStatusCondition(context.Background(), kubeClient, hpa, "test", result, nil, now)
+
+		assert.Nil(t, err)
+		assert.False(t, updated)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+
+	t.Run("KeepsTransitionTimeIfStatusIsUnchanged", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		earlier := metav1.NewTime(now.Add(-time.Hour))
+		condition := getStatusCondition(processingResult{"skipped", reasonNoChange}, nil)
+		condition.LastTransitionTime = earlier
+		hpaV2 := &autoscalingv2beta2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: hpa.Name, Namespace: hpa.Namespace},
+			Status:     autoscalingv2beta2.HorizontalPodAutoscalerStatus{Conditions: []autoscalingv2beta2.HorizontalPodAutoscalerCondition{condition}},
+		}
+		kubeClient := fake.NewSimpleClientset(hpaV2)
+
+		// act
+		updated, err := setStatusCondition(context.Background(), kubeClient, hpa, "test", processingResult{"succeeded", reasonUpdated}, nil, now)
+
+		assert.Nil(t, err)
+		assert.True(t, updated)
+		updatedHPAV2, _ := kubeClient.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).Get(context.Background(), hpa.Name, metav1.GetOptions{})
+		assert.Equal(t, "Updated", updatedHPAV2.Status.Conditions[0].Reason)
+		assert.True(t, earlier.Equal(&updatedHPAV2.Status.Conditions[0].LastTransitionTime))
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/alecthomas/kingpin"
+)
+
+var (
+	printConfig = kingpin.Flag("print-config", "Whether to print the effective configuration, resolved from the flags and envvars, as json and exit.").Default("false").Bool()
+)
+
+// effectiveConfig is used to marshal the configuration the controller runs with, for debugging
+type effectiveConfig struct {
+	Version                   string            `json:"version"`
+	GoVersion                 string            `json:"goVersion"`
+	PollIntervalSeconds       int               `json:"pollIntervalSeconds"`
+	PollJitterSeconds         int               `json:"pollJitterSeconds"`
+	MinimumReplicasLowerBound int32             `json:"minimumReplicasLowerBound"`
+	Flags                     map[string]string `json:"flags"`
+}
+
+// Returns the configuration resolved from the parsed flags and envvars of the application; the flags of subcommands are left out
+func getEffectiveConfig(app *kingpin.Application) effectiveConfig {
+	config := effectiveConfig{
+		Version:                   version,
+		GoVersion:                 goVersion,
+		PollIntervalSeconds:       pollIntervalSeconds,
+		PollJitterSeconds:         getJitterDeviation(pollIntervalSeconds),
+		MinimumReplicasLowerBound: getGlobalMinimumReplicasLowerBound(),
+		Flags:                     map[string]string{},
+	}
+
+	for _, flag := range app.Model().Flags {
+		if flag.Hidden || flag.Name == "help" || flag.Name == "print-config" {
+			continue
+		}
+		config.Flags[flag.Name] = flag.Value.String()
+	}
+
+	return config
+}
+
+// Writes the effective configuration to out as indented json
+func printEffectiveConfig(out io.Writer, app *kingpin.Application) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(getEffectiveConfig(app))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintEffectiveConfig(t *testing.T) {
+	t.Run("PrintsFlagsAndEnvvarsAsResolved", func(t *testing.T) {
+
+		os.Setenv("TEST_UPDATE_QPS", "2.5")
+		defer os.Unsetenv("TEST_UPDATE_QPS")
+		app := kingpin.New("test", "")
+		app.Flag("prometheus-server-url", "").Required().String()
+		app.Flag("log-level", "").Default("info").String()
+		app.Flag("update-qps", "").Default("5").Envar("TEST_UPDATE_QPS").Float32()
+		app.Flag("list-retry-backoff", "").Default("5s").Duration()
+		_, err := app.Parse([]string{"--prometheus-server-url=http://prometheus.monitoring.svc", "--list-retry-backoff=10s"})
+		assert.Nil(t, err)
+		var out bytes.Buffer
+
+		// act
+		err = printEffectiveConfig(&out, app)
+
+		assert.Nil(t, err)
+		var config effectiveConfig
+		assert.Nil(t, json.Unmarshal(out.Bytes(), &config))
+		assert.Equal(t, map[string]string{
+			"prometheus-server-url": "http://prometheus.monitoring.svc",
+			"log-level":             "info",
+			"update-qps":            "2.5",
+			"list-retry-backoff":    "10s",
+		}, config.Flags)
+		assert.Equal(t, 90, config.PollIntervalSeconds)
+		assert.Equal(t, 22, config.PollJitterSeconds)
+	})
+
+	t.Run("PrintsLowerBoundFromEnvvar", func(t *testing.T) {
+
+		os.Setenv("MINIMUM_REPLICAS_LOWER_BOUND", "2")
+		defer os.Unsetenv("MINIMUM_REPLICAS_LOWER_BOUND")
+		app := kingpin.New("test", "")
+		var out bytes.Buffer
+
+		// act
+		err := printEffectiveConfig(&out, app)
+
+		assert.Nil(t, err)
+		var config effectiveConfig
+		assert.Nil(t, json.Unmarshal(out.Bytes(), &config))
+		assert.Equal(t, int32(2), config.MinimumReplicasLowerBound)
+	})
+}
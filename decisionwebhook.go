@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DecisionWebhookPayload is used to marshal the change of minReplicas posted to the decision webhook
+type DecisionWebhookPayload struct {
+	HPA            string  `json:"hpa"`
+	Namespace      string  `json:"namespace"`
+	OldMinReplicas int32   `json:"oldMinReplicas"`
+	NewMinReplicas int32   `json:"newMinReplicas"`
+	RequestRate    float64 `json:"requestRate"`
+	Timestamp      string  `json:"timestamp"`
+}
+
+// decisionWebhookSender posts the changes of minReplicas to an url, so automation can react to them
+type decisionWebhookSender struct {
+	url     string
+	retries int
+	backoff time.Duration
+}
+
+// the sender of changes when --decision-webhook-url is set, nil otherwise
+var decisionWebhook *decisionWebhookSender
+
+func newDecisionWebhookSender(url string, retries int, backoff time.Duration) *decisionWebhookSender {
+	return &decisionWebhookSender{url: url, retries: retries, backoff: backoff}
+}
+
+// Notify posts the payload in the background, so a slow or failing webhook doesn't hold up processing; it does nothing without a sender
+func (s *decisionWebhookSender) Notify(ctx context.Context, payload DecisionWebhookPayload) {
+	if s == nil {
+		return
+	}
+
+	go func() {
+		if err := s.send(ctx, payload); err != nil {
+			log.Warn().Err(err).Msgf("Posting the change of hpa %v in namespace %v to decision webhook %v failed", payload.HPA, payload.Namespace, s.url)
+		}
+	}()
+}
+
+// Posts the payload, retrying with exponential backoff when the request fails or the webhook doesn't respond with a 2xx status
+func (s *decisionWebhookSender) send(ctx context.Context, payload DecisionWebhookPayload) (err error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(ctx, body)
+		if err == nil || attempt >= s.retries {
+			return err
+		}
+
+		log.Debug().Err(err).Msgf("Posting to decision webhook %v failed, retrying in %v...", s.url, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (s *decisionWebhookSender) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", getUserAgent(""))
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		responseBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Decision webhook %v responded with status %v: %v", s.url, resp.StatusCode, string(responseBody))
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// decisionWebhookCapture stores the payloads it receives, after failing the given number of requests first
+type decisionWebhookCapture struct {
+	mutex    sync.Mutex
+	failures int
+	attempts int
+	payloads []DecisionWebhookPayload
+}
+
+func (c *decisionWebhookCapture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.attempts++
+	if c.attempts <= c.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	var payload DecisionWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.payloads = append(c.payloads, payload)
+}
+
+func (c *decisionWebhookCapture) getPayloads() []DecisionWebhookPayload {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]DecisionWebhookPayload{}, c.payloads...)
+}
+
+func TestDecisionWebhookSenderSend(t *testing.T) {
+	t.Run("PostsPayloadAsJSON", func(t *testing.T) {
+
+		capture := &decisionWebhookCapture{}
+		server := httptest.NewServer(capture)
+		defer server.Close()
+		sender := newDecisionWebhookSender(server.URL, 0, time.Millisecond)
+		payload := DecisionWebhookPayload{HPA: "my-app", Namespace: "my-namespace", OldMinReplicas: 3, NewMinReplicas: 8, RequestRate: 160, Timestamp: "2020-01-01T00:00:00Z"}
+
+		// act
+		err := sender.send(context.Background(), payload)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []DecisionWebhookPayload{payload}, capture.getPayloads())
+	})
+
+	t.Run("RetriesFailedPosts", func(t *testing.T) {
+
+		capture := &decisionWebhookCapture{failures: 2}
+		server := httptest.NewServer(capture)
+		defer server.Close()
+		sender := newDecisionWebhookSender(server.URL, 2, time.Millisecond)
+
+		// act
+		err := sender.send(context.Background(), DecisionWebhookPayload{HPA: "my-app", Namespace: "my-namespace"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, capture.attempts)
+		assert.Equal(t, 1, len(capture.getPayloads()))
+	})
+
+	t.Run("ReturnsErrorAfterLastRetry", func(t *testing.T) {
+
+		capture := &decisionWebhookCapture{failures: 5}
+		server := httptest.NewServer(capture)
+		defer server.Close()
+		sender := newDecisionWebhookSender(server.URL, 2, time.Millisecond)
+
+		// act
+		err := sender.send(context.Background(), DecisionWebhookPayload{HPA: "my-app", Namespace: "my-namespace"})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, 3, capture.attempts)
+	})
+}
+
+func TestDecisionWebhookOnChanges(t *testing.T) {
+	t.Run("PostsChangeOfMinReplicas", func(t *testing.T) {
+
+		capture := &decisionWebhookCapture{}
+		server := httptest.NewServer(capture)
+		defer server.Close()
+		decisionWebhook = newDecisionWebhookSender(server.URL, 0, time.Millisecond)
+		defer func() { decisionWebhook = nil }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		_, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		if assert.True(t, waitFor(func() bool { return len(capture.getPayloads()) == 1 }, time.Second)) {
+			payload := capture.getPayloads()[0]
+			assert.Equal(t, "my-app", payload.HPA)
+			assert.Equal(t, "my-namespace", payload.Namespace)
+			assert.Equal(t, int32(3), payload.OldMinReplicas)
+			assert.Equal(t, int32(8), payload.NewMinReplicas)
+			assert.NotEqual(t, "", payload.Timestamp)
+		}
+	})
+
+	t.Run("DoesNotPostIfMinReplicasIsUnchanged", func(t *testing.T) {
+
+		capture := &decisionWebhookCapture{}
+		server := httptest.NewServer(capture)
+		defer server.Close()
+		decisionWebhook = newDecisionWebhookSender(server.URL, 0, time.Millisecond)
+		defer func() { decisionWebhook = nil }()
+		hpa := newTestHorizontalPodAutoscaler(8, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		_, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, 0, len(capture.getPayloads()))
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// QueryError is returned when retrieving the request rate for an hpa fails
+type QueryError struct {
+	Err error
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// UpdateError is returned when storing the changes to an hpa in the kubernetes api fails
+type UpdateError struct {
+	Err error
+}
+
+func (e *UpdateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UpdateError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError is returned for an annotation of an hpa with an invalid value
+type ParseError struct {
+	Annotation string
+	Value      string
+	Err        error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Annotation %v has invalid value %v: %v", e.Annotation, e.Value, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the reason for the totals metric of an hpa that failed processing, based on the type of the error
+func getFailedReason(err error) string {
+	var queryError *QueryError
+	if errors.As(err, &queryError) {
+		return reasonQueryFailed
+	}
+
+	var updateError *UpdateError
+	if errors.As(err, &updateError) {
+		return reasonUpdateFailed
+	}
+
+	return reasonError
+}
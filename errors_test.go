@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseError(t *testing.T) {
+	t.Run("ReturnsMessageWithAnnotationAndValue", func(t *testing.T) {
+
+		err := &ParseError{Annotation: "estafette.io/hpa-scaler-delta", Value: "abc", Err: errors.New("invalid syntax")}
+
+		// act
+		message := err.Error()
+
+		assert.Equal(t, "Annotation estafette.io/hpa-scaler-delta has invalid value abc: invalid syntax", message)
+	})
+}
+
+func TestGetFailedReason(t *testing.T) {
+	testCases := []struct {
+		name           string
+		err            error
+		expectedReason string
+	}{
+		{"QueryError", &QueryError{Err: errors.New("timeout")}, reasonQueryFailed},
+		{"UpdateError", &UpdateError{Err: errors.New("conflict")}, reasonUpdateFailed},
+		{"WrappedQueryError", fmt.Errorf("processing failed: %w", &QueryError{Err: errors.New("timeout")}), reasonQueryFailed},
+		{"OtherError", errors.New("unexpected"), reasonError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("Returns%vFor%v", tc.expectedReason, tc.name), func(t *testing.T) {
+
+			// act
+			reason := getFailedReason(tc.err)
+
+			assert.Equal(t, tc.expectedReason, reason)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+)
+
+// Returns the hpas reordered round-robin across their namespaces, taking one hpa of each namespace in turn, so a namespace with many slow hpas doesn't delay all others; within a namespace the order is kept
+func interleaveHorizontalPodAutoscalersByNamespace(hpas []autoscalingv1.HorizontalPodAutoscaler) []autoscalingv1.HorizontalPodAutoscaler {
+	// a queue per namespace, in order of first appearance
+	namespaces := []string{}
+	queues := map[string][]autoscalingv1.HorizontalPodAutoscaler{}
+	for _, hpa := range hpas {
+		if _, ok := queues[hpa.Namespace]; !ok {
+			namespaces = append(namespaces, hpa.Namespace)
+		}
+		queues[hpa.Namespace] = append(queues[hpa.Namespace], hpa)
+	}
+
+	interleaved := make([]autoscalingv1.HorizontalPodAutoscaler, 0, len(hpas))
+	for len(interleaved) < len(hpas) {
+		for _, namespace := range namespaces {
+			if len(queues[namespace]) == 0 {
+				continue
+			}
+			interleaved = append(interleaved, queues[namespace][0])
+			queues[namespace] = queues[namespace][1:]
+		}
+	}
+
+	return interleaved
+}
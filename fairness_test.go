@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestNamespacedHorizontalPodAutoscalers(namespacedNames ...string) []autoscalingv1.HorizontalPodAutoscaler {
+	hpas := []autoscalingv1.HorizontalPodAutoscaler{}
+	for i := 0; i < len(namespacedNames); i += 2 {
+		hpas = append(hpas, autoscalingv1.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Namespace: namespacedNames[i], Name: namespacedNames[i+1]}})
+	}
+
+	return hpas
+}
+
+func getNamespacedNames(hpas []autoscalingv1.HorizontalPodAutoscaler) []string {
+	namespacedNames := []string{}
+	for _, hpa := range hpas {
+		namespacedNames = append(namespacedNames, hpa.Namespace+"/"+hpa.Name)
+	}
+
+	return namespacedNames
+}
+
+func TestInterleaveHorizontalPodAutoscalersByNamespace(t *testing.T) {
+	t.Run("AlternatesBetweenNamespaces", func(t *testing.T) {
+
+		hpas := newTestNamespacedHorizontalPodAutoscalers(
+			"busy", "app-1",
+			"busy", "app-2",
+			"busy", "app-3",
+			"busy", "app-4",
+			"quiet", "app-1",
+			"other", "app-1",
+			"other", "app-2",
+		)
+
+		// act
+		interleaved := interleaveHorizontalPodAutoscalersByNamespace(hpas)
+
+		assert.Equal(t, []string{
+			"busy/app-1", "quiet/app-1", "other/app-1",
+			"busy/app-2", "other/app-2",
+			"busy/app-3",
+			"busy/app-4",
+		}, getNamespacedNames(interleaved))
+	})
+
+	t.Run("KeepsOrderForSingleNamespace", func(t *testing.T) {
+
+		hpas := newTestNamespacedHorizontalPodAutoscalers("busy", "app-1", "busy", "app-2")
+
+		// act
+		interleaved := interleaveHorizontalPodAutoscalersByNamespace(hpas)
+
+		assert.Equal(t, []string{"busy/app-1", "busy/app-2"}, getNamespacedNames(interleaved))
+	})
+
+	t.Run("ReturnsEmptyForNoHPAs", func(t *testing.T) {
+
+		// act
+		interleaved := interleaveHorizontalPodAutoscalersByNamespace(nil)
+
+		assert.Equal(t, 0, len(interleaved))
+	})
+}
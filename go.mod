@@ -5,11 +5,15 @@ go 1.12
 require (
 	github.com/alecthomas/kingpin v2.2.6+incompatible
 	github.com/estafette/estafette-foundation v0.0.68
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/prometheus/client_golang v0.9.2
+	github.com/prometheus/client_model v0.0.0-20190812154241-14fe0d1b01d4
 	github.com/rs/zerolog v1.17.2
 	github.com/sethgrid/pester v1.1.0
 	github.com/stretchr/testify v1.4.0
-	k8s.io/api v0.17.0
-	k8s.io/apimachinery v0.17.0
-	k8s.io/client-go v0.17.0
+	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
+	k8s.io/api v0.18.19
+	k8s.io/apimachinery v0.18.19
+	k8s.io/client-go v0.18.19
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// hpaInfoTracker remembers the label values of the info series set per hpa, so the previous series can be removed once they change
+type hpaInfoTracker struct {
+	mutex  sync.Mutex
+	vector *prometheus.GaugeVec
+	labels map[namespacedName][]string
+}
+
+func newHPAInfoTracker(vector *prometheus.GaugeVec) *hpaInfoTracker {
+	return &hpaInfoTracker{
+		vector: vector,
+		labels: map[namespacedName][]string{},
+	}
+}
+
+// Set sets the info series of the hpa to 1, deleting its previous series if it had other label values
+func (t *hpaInfoTracker) Set(name, namespace, prometheusServerURL, enabled string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := namespacedName{namespace: namespace, name: name}
+	labels := []string{name, namespace, prometheusServerURL, enabled}
+
+	if previous, ok := t.labels[key]; ok && !reflect.DeepEqual(previous, labels) {
+		t.vector.DeleteLabelValues(previous...)
+	}
+
+	t.vector.WithLabelValues(labels...).Set(1)
+	t.labels[key] = labels
+}
+
+// Delete removes the info series of the hpa, if it has one
+func (t *hpaInfoTracker) Delete(name, namespace string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := namespacedName{namespace: namespace, name: name}
+	if previous, ok := t.labels[key]; ok {
+		t.vector.DeleteLabelValues(previous...)
+		delete(t.labels, key)
+	}
+}
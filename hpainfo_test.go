@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHPAInfoVector() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_info",
+		Help: "Information about each hpa processed by this application, always set to 1.",
+	}, []string{"hpa", "namespace", "prometheus_server_url", "enabled"})
+}
+
+func TestHPAInfoTracker(t *testing.T) {
+	t.Run("SetsInfoSeriesToOne", func(t *testing.T) {
+
+		vector := newTestHPAInfoVector()
+		tracker := newHPAInfoTracker(vector)
+
+		// act
+		tracker.Set("my-app", "my-namespace", "http://prometheus", "true")
+
+		assert.Equal(t, float64(1), testutil.ToFloat64(vector.WithLabelValues("my-app", "my-namespace", "http://prometheus", "true")))
+	})
+
+	t.Run("DeletesPreviousSeriesIfEnabledChanges", func(t *testing.T) {
+
+		vector := newTestHPAInfoVector()
+		tracker := newHPAInfoTracker(vector)
+		tracker.Set("my-app", "my-namespace", "http://prometheus", "true")
+
+		// act
+		tracker.Set("my-app", "my-namespace", "http://prometheus", "false")
+
+		// deleting returns false if the series no longer exists
+		assert.False(t, vector.DeleteLabelValues("my-app", "my-namespace", "http://prometheus", "true"))
+		assert.True(t, vector.DeleteLabelValues("my-app", "my-namespace", "http://prometheus", "false"))
+	})
+
+	t.Run("DeletesPreviousSeriesIfPrometheusServerURLChanges", func(t *testing.T) {
+
+		vector := newTestHPAInfoVector()
+		tracker := newHPAInfoTracker(vector)
+		tracker.Set("my-app", "my-namespace", "http://prometheus", "true")
+
+		// act
+		tracker.Set("my-app", "my-namespace", "http://other-prometheus", "true")
+
+		assert.False(t, vector.DeleteLabelValues("my-app", "my-namespace", "http://prometheus", "true"))
+		assert.True(t, vector.DeleteLabelValues("my-app", "my-namespace", "http://other-prometheus", "true"))
+	})
+
+	t.Run("KeepsSeriesOfOtherHPAs", func(t *testing.T) {
+
+		vector := newTestHPAInfoVector()
+		tracker := newHPAInfoTracker(vector)
+		tracker.Set("other-app", "my-namespace", "http://prometheus", "true")
+
+		// act
+		tracker.Set("my-app", "my-namespace", "http://other-prometheus", "true")
+
+		assert.True(t, vector.DeleteLabelValues("other-app", "my-namespace", "http://prometheus", "true"))
+	})
+
+	t.Run("DeletesSeriesOfHPA", func(t *testing.T) {
+
+		vector := newTestHPAInfoVector()
+		tracker := newHPAInfoTracker(vector)
+		tracker.Set("my-app", "my-namespace", "http://prometheus", "true")
+
+		// act
+		tracker.Delete("my-app", "my-namespace")
+
+		assert.False(t, vector.DeleteLabelValues("my-app", "my-namespace", "http://prometheus", "true"))
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sethgrid/pester"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Parses the jsonpath expression, adding the surrounding braces kubectl-style expressions have if they're left out
+func parseHTTPMetricsJSONPath(expression string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+
+	path := jsonpath.New("http-metrics")
+	if err := path.Parse(expression); err != nil {
+		return nil, err
+	}
+
+	return path, nil
+}
+
+// Returns the request rates the jsonpath expression selects from the json body of the http metrics endpoint, one per selected value
+func getRequestRatesFromHTTPMetricsEndpoint(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) ([]float64, error) {
+	path, err := parseHTTPMetricsJSONPath(desiredState.HTTPMetricsJSONPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", desiredState.HTTPMetricsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := pester.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Error().Err(err).Msgf("Requesting http metrics endpoint %v for hpa %v in namespace %v failed", desiredState.HTTPMetricsURL, hpa.Name, hpa.Namespace)
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Http metrics endpoint %v responded with status %v: %v", desiredState.HTTPMetricsURL, resp.StatusCode, string(body))
+	}
+
+	return extractRequestRates(body, path)
+}
+
+// Returns the values the jsonpath expression selects from the json body as floats; numbers in strings are accepted as well
+func extractRequestRates(body []byte, path *jsonpath.JSONPath) ([]float64, error) {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	results, err := path.FindResults(data)
+	if err != nil {
+		return nil, err
+	}
+
+	requestRates := []float64{}
+	for _, result := range results {
+		for _, value := range result {
+			switch v := value.Interface().(type) {
+			case float64:
+				requestRates = append(requestRates, v)
+			case string:
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return nil, fmt.Errorf("The value %v selected from the http metrics response is not a number: %v", v, err)
+				}
+				requestRates = append(requestRates, f)
+			default:
+				return nil, fmt.Errorf("The value %v selected from the http metrics response is not a number", v)
+			}
+		}
+	}
+
+	if len(requestRates) == 0 {
+		return nil, fmt.Errorf("The jsonpath expression didn't select any value from the http metrics response")
+	}
+
+	return requestRates, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractRequestRates(t *testing.T) {
+	t.Run("ReturnsNumberSelectedByJSONPath", func(t *testing.T) {
+
+		path, _ := parseHTTPMetricsJSONPath("{.data.rate}")
+
+		// act
+		requestRates, err := extractRequestRates([]byte(`{"data":{"rate":225.4}}`), path)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []float64{225.4}, requestRates)
+	})
+
+	t.Run("ReturnsAllNumbersSelectedByJSONPathWithoutBraces", func(t *testing.T) {
+
+		path, _ := parseHTTPMetricsJSONPath(".regions[*].rate")
+
+		// act
+		requestRates, err := extractRequestRates([]byte(`{"regions":[{"name":"eu","rate":15},{"name":"us","rate":"30.5"}]}`), path)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []float64{15, 30.5}, requestRates)
+	})
+
+	t.Run("ReturnsErrorIfSelectedValueIsNotANumber", func(t *testing.T) {
+
+		path, _ := parseHTTPMetricsJSONPath("{.data}")
+
+		// act
+		_, err := extractRequestRates([]byte(`{"data":{"rate":225.4}}`), path)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfJSONPathDoesNotMatch", func(t *testing.T) {
+
+		path, _ := parseHTTPMetricsJSONPath("{.data.requests}")
+
+		// act
+		_, err := extractRequestRates([]byte(`{"data":{"rate":225.4}}`), path)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetMinPodCountBasedOnHTTPMetricsEndpoint(t *testing.T) {
+	t.Run("DividesRequestRateFromEndpointByRequestsPerReplica", func(t *testing.T) {
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"service":"my-app","metrics":{"requestsPerSecond":100}}`)
+		}))
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{HTTPMetricsURL: server.URL, HTTPMetricsJSONPath: "{.metrics.requestsPerSecond}", RequestsPerReplica: 20}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("ReturnsErrorIfEndpointFails", func(t *testing.T) {
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{HTTPMetricsURL: server.URL, HTTPMetricsJSONPath: "{.metrics.requestsPerSecond}", RequestsPerReplica: 20}
+
+		// act
+		_, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	autoscalinglisters "k8s.io/client-go/listers/autoscaling/v1"
+)
+
+// informerCache reads hpas and replica sets from the caches of shared informers, which are kept up to date with a watch, instead of listing them from the api every iteration
+type informerCache struct {
+	hpaLister        autoscalinglisters.HorizontalPodAutoscalerLister
+	replicaSetLister appslisters.ReplicaSetLister
+}
+
+// the caches of the hpas and replica sets when --use-informers is set, nil otherwise
+var sharedInformerCache *informerCache
+
+// Starts the shared informers for hpas and replica sets and waits until their caches are synced; they run until the context is cancelled
+func startInformerCache(ctx context.Context, kubeClient kubernetes.Interface, resync time.Duration) (*informerCache, error) {
+	factory := informers.NewSharedInformerFactory(kubeClient, resync)
+
+	cache := &informerCache{
+		hpaLister:        factory.Autoscaling().V1().HorizontalPodAutoscalers().Lister(),
+		replicaSetLister: factory.Apps().V1().ReplicaSets().Lister(),
+	}
+
+	factory.Start(ctx.Done())
+
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("Syncing the cache of %v failed", informerType)
+		}
+	}
+
+	log.Info().Msg("Synced the caches of horizontal pod autoscalers and replicasets")
+
+	return cache, nil
+}
+
+// Returns copies of all cached hpas as a single page, since the caller updates them and the cached objects have to stay untouched
+func (c *informerCache) listHorizontalPodAutoscalers() (*autoscalingv1.HorizontalPodAutoscalerList, error) {
+	cachedHPAs, err := c.hpaLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	hpas := &autoscalingv1.HorizontalPodAutoscalerList{Items: make([]autoscalingv1.HorizontalPodAutoscaler, len(cachedHPAs))}
+	for i, hpa := range cachedHPAs {
+		hpas.Items[i] = *hpa.DeepCopy()
+	}
+
+	return hpas, nil
+}
+
+// Returns all cached replica sets; they're only read, so they don't need to be copied deeply
+func (c *informerCache) listReplicaSets() (*appsv1.ReplicaSetList, error) {
+	cachedReplicaSets, err := c.replicaSetLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSets := &appsv1.ReplicaSetList{Items: make([]appsv1.ReplicaSet, len(cachedReplicaSets))}
+	for i, replicaSet := range cachedReplicaSets {
+		replicaSets.Items[i] = *replicaSet
+	}
+
+	return replicaSets, nil
+}
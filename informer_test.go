@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func countListHorizontalPodAutoscalersActions(kubeClient *fake.Clientset) (count int) {
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "horizontalpodautoscalers" {
+			count++
+		}
+	}
+	return
+}
+
+func TestInformerCache(t *testing.T) {
+	t.Run("ReadsHPAsAndReplicaSetsFromCacheInsteadOfListing", func(t *testing.T) {
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2", "estafette.io/hpa-scaler-enable-scale-down-ratio-deployment-checking": "true"}
+		replicaSet := newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 10)
+		kubeClient := fake.NewSimpleClientset(hpa, &replicaSet)
+		cache, err := startInformerCache(ctx, kubeClient, 0)
+		assert.Nil(t, err)
+		sharedInformerCache = cache
+		defer func() { sharedInformerCache = nil }()
+		kubeClient.ClearActions()
+
+		// act
+		statusCounts, hpaCount, err := pollHorizontalPodAutoscalers(ctx, kubeClient, &sync.WaitGroup{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, hpaCount)
+		assert.Equal(t, 1, statusCounts["succeeded"])
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		assert.Equal(t, 0, countListHorizontalPodAutoscalersActions(kubeClient))
+		assert.Equal(t, 0, countListReplicaSetsActions(kubeClient))
+		minReplicasVector.DeleteLabelValues("my-app", "my-namespace")
+	})
+
+	t.Run("ReturnsCopiesOfCachedHPAs", func(t *testing.T) {
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		kubeClient := fake.NewSimpleClientset(newTestHorizontalPodAutoscaler(3, 20, 10))
+		cache, err := startInformerCache(ctx, kubeClient, 0)
+		assert.Nil(t, err)
+
+		// act
+		hpas, err := cache.listHorizontalPodAutoscalers()
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(hpas.Items))
+		assert.Equal(t, "", hpas.Continue)
+		hpas.Items[0].Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+		cachedHPA, err := cache.hpaLister.HorizontalPodAutoscalers("my-namespace").Get("my-app")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(cachedHPA.Annotations))
+	})
+
+	t.Run("PicksUpReplicaSetsCreatedAfterSync", func(t *testing.T) {
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		kubeClient := fake.NewSimpleClientset()
+		cache, err := startInformerCache(ctx, kubeClient, 0)
+		assert.Nil(t, err)
+		replicaSet := newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 10)
+
+		// act
+		_, err = kubeClient.AppsV1().ReplicaSets("my-namespace").Create(ctx, &replicaSet, metav1.CreateOptions{})
+
+		assert.Nil(t, err)
+		assert.True(t, waitFor(func() bool {
+			replicaSets, err := cache.listReplicaSets()
+			return err == nil && len(replicaSets.Items) == 1
+		}, 5*time.Second))
+	})
+}
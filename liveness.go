@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// unix time in nanoseconds of the start of the most recent poll iteration, accessed atomically
+var lastHeartbeat int64
+
+// Records that the poll loop is still making progress
+func recordHeartbeat(now time.Time) {
+	atomic.StoreInt64(&lastHeartbeat, now.UnixNano())
+	heartbeatGauge.Set(float64(now.Unix()))
+}
+
+// Returns the time since the last heartbeat of the poll loop
+func getHeartbeatAge(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&lastHeartbeat)))
+}
+
+// Responds with an error if the poll loop stalled, so kubernetes restarts the pod
+func livenessHandler(w http.ResponseWriter, _ *http.Request) {
+	heartbeatAge := getHeartbeatAge(time.Now())
+	if *livenessMaxHeartbeatAge > 0 && heartbeatAge > *livenessMaxHeartbeatAge {
+		log.Warn().Msgf("Last heartbeat of the poll loop was %v ago, failing liveness check", heartbeatAge)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, fmt.Sprintf("Last heartbeat was %v ago\n", heartbeatAge))
+		return
+	}
+
+	io.WriteString(w, "I'm alive!\n")
+}
+
+// Initializes the /liveness endpoint on the specified port, replacing foundation.InitLiveness to include the heartbeat check
+func initLiveness(port int) {
+	go func() {
+		portString := fmt.Sprintf(":%v", port)
+		log.Debug().
+			Str("port", portString).
+			Msg("Serving /liveness endpoint...")
+
+		serverMux := http.NewServeMux()
+		serverMux.HandleFunc("/liveness", livenessHandler)
+
+		if err := http.ListenAndServe(portString, serverMux); err != nil {
+			log.Fatal().Err(err).Msg("Starting /liveness listener failed")
+		}
+	}()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLivenessHandler(t *testing.T) {
+	t.Run("ReturnsOkIfHeartbeatIsRecent", func(t *testing.T) {
+
+		*livenessMaxHeartbeatAge = time.Minute
+		defer func() { *livenessMaxHeartbeatAge = 0 }()
+		recordHeartbeat(time.Now())
+		recorder := httptest.NewRecorder()
+
+		// act
+		livenessHandler(recorder, httptest.NewRequest("GET", "/liveness", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("ReturnsServiceUnavailableIfHeartbeatIsTooOld", func(t *testing.T) {
+
+		*livenessMaxHeartbeatAge = time.Minute
+		defer func() { *livenessMaxHeartbeatAge = 0 }()
+		recordHeartbeat(time.Now().Add(-2 * time.Minute))
+		recorder := httptest.NewRecorder()
+
+		// act
+		livenessHandler(recorder, httptest.NewRequest("GET", "/liveness", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	})
+
+	t.Run("ReturnsOkIfMaxHeartbeatAgeIsDisabled", func(t *testing.T) {
+
+		*livenessMaxHeartbeatAge = 0
+		recordHeartbeat(time.Now().Add(-2 * time.Hour))
+		recorder := httptest.NewRecorder()
+
+		// act
+		livenessHandler(recorder, httptest.NewRequest("GET", "/liveness", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+}
@@ -1,23 +1,30 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"math/rand"
+	"net/http"
 	"net/url"
 	"os"
+	"reflect"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/alecthomas/kingpin"
 	foundation "github.com/estafette/estafette-foundation"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"github.com/sethgrid/pester"
 
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
@@ -25,32 +32,148 @@ import (
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
-const annotationHPAScaler = "estafette.io/hpa-scaler"
-const annotationHPAScalerPrometheusQuery = "estafette.io/hpa-scaler-prometheus-query"
-const annotationHPAScalerRequestsPerReplica = "estafette.io/hpa-scaler-requests-per-replica"
-const annotationHPAScalerDelta = "estafette.io/hpa-scaler-delta"
-const annotationHPAScalerPrometheusServerURL = "estafette.io/hpa-scaler-prometheus-server-url"
-const annotationHPAScalerScaleDownMaxRatio = "estafette.io/hpa-scaler-scale-down-max-ratio"
-const annotationHPAScalerEnableScaleDownRatioDeploymentChecking = "estafette.io/hpa-scaler-enable-scale-down-ratio-deployment-checking"
+const deploymentCheckingModeAppLabel = "app-label"
+const deploymentCheckingModeOwnerReference = "owner-reference"
+const deploymentCheckingModeRevision = "revision"
+
+// the annotation in which the deployment controller stores the revision of a deployment and its replica sets
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// matches prometheus metric names, such as the names of recording rules
+var metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// marks a requests per replica value as the name of a recording rule, so a mistyped number isn't queried as one
+const recordingRulePrefix = "rule:"
+
+const queryAggregationFirst = "first"
+const queryAggregationSum = "sum"
+const queryAggregationPerSeriesCeilSum = "per-series-ceil-sum"
+
+const prometheusQueryModeRate = "rate"
+const prometheusQueryModeCounter = "counter"
+const prometheusQueryModeGauge = "gauge"
+
+const rateUnitPerSecond = "per-second"
+const rateUnitPerMinute = "per-minute"
+
+const defaultMetricPrefix = "estafette_hpa_scaler_"
+
+// the time between poll iterations, before jitter is applied
+const pollIntervalSeconds = 90
+
+const targetWindowModeMax = "max"
+const targetWindowModeMedian = "median"
+
+const (
+	reasonUpdated         = "updated"
+	reasonNoChange        = "no-change"
+	reasonNotEnabled      = "not-enabled"
+	reasonDisabled        = "disabled"
+	reasonPaused          = "paused"
+	reasonQueryFailed     = "query-failed"
+	reasonUpdateFailed    = "update-failed"
+	reasonClampedUpper    = "clamped-upper"
+	reasonClampedLower    = "clamped-lower"
+	reasonCooldown        = "cooldown"
+	reasonBelowMinChange  = "below-min-change"
+	reasonRateDrop        = "rate-drop"
+	reasonNotAllowed      = "not-allowed"
+	reasonDebounced       = "debounced"
+	reasonInvalidReplicas = "invalid-replicas"
+	reasonError           = "error"
+	reasonOverridden      = "overridden"
+	reasonMaintenance     = "maintenance"
+	reasonDeferred        = "deferred"
+	reasonBackoff         = "backoff"
+	reasonRatchet         = "ratchet"
+	reasonStabilizing     = "stabilizing"
+	reasonWarmup          = "warmup"
+)
 
-const annotationHPAScalerState = "estafette.io/hpa-scaler-state"
+// processingResult is the outcome of processing an hpa, with the reason that led to it
+type processingResult struct {
+	Status string
+	Reason string
+}
 
 // HPAScalerState represents the state of the HorizontalPodAutoscaler with respect to the Estafette k8s hpa scaler
 type HPAScalerState struct {
-	Enabled                                string  `json:"enabled"`
-	PrometheusQuery                        string  `json:"prometheusQuery"`
-	RequestsPerReplica                     float64 `json:"requestsPerReplica"`
-	Delta                                  float64 `json:"delta"`
-	LastUpdated                            string  `json:"lastUpdated"`
-	PrometheusServerURL                    string  `json:"prometheusServerUrl"`
-	ScaleDownMaxRatio                      float64 `json:"scaleDownMaxRatio"`
-	EnableScaleDownRatioDeploymentChecking string  `json:"enableScaleDownRatioDeploymentChecking"`
+	Enabled                                string    `json:"enabled"`
+	PrometheusQuery                        string    `json:"prometheusQuery"`
+	QueryWindow                            string    `json:"queryWindow"`
+	OverrideMinReplicasQuery               string    `json:"overrideMinReplicasQuery"`
+	RequestsPerReplica                     float64   `json:"requestsPerReplica"`
+	Delta                                  float64   `json:"delta"`
+	SafetyFactor                           float64   `json:"safetyFactor"`
+	DeltaRatio                             float64   `json:"deltaRatio"`
+	LastUpdated                            string    `json:"lastUpdated"`
+	PrometheusServerURL                    string    `json:"prometheusServerUrl"`
+	PrometheusSecondaryServerURL           string    `json:"prometheusSecondaryServerUrl"`
+	PrometheusServerURLs                   []string  `json:"prometheusServerUrls,omitempty"`
+	PrometheusServerAggregation            string    `json:"prometheusServerAggregation"`
+	PrometheusPathPrefix                   string    `json:"prometheusPathPrefix"`
+	ScaleDownMaxRatio                      float64   `json:"scaleDownMaxRatio"`
+	EnableScaleDownRatioDeploymentChecking string    `json:"enableScaleDownRatioDeploymentChecking"`
+	DeploymentInProgressPredicate          string    `json:"deploymentInProgressPredicate"`
+	DeploymentInProgressReplicaSets        int       `json:"deploymentInProgressReplicaSets"`
+	Paused                                 string    `json:"paused"`
+	RatchetUpOnly                          string    `json:"ratchetUpOnly"`
+	MinChange                              int32     `json:"minChange"`
+	MinChangeRatio                         float64   `json:"minChangeRatio"`
+	RequestsPerReplicaQuery                string    `json:"requestsPerReplicaQuery"`
+	ConcurrencyQuery                       string    `json:"concurrencyQuery"`
+	ConcurrencyPerReplica                  float64   `json:"concurrencyPerReplica"`
+	ScaleToZero                            string    `json:"scaleToZero"`
+	MinimumReplicasLowerBound              int32     `json:"minimumReplicasLowerBound"`
+	ColdStartMinReplicas                   int32     `json:"coldStartMinReplicas"`
+	RoundToMultiple                        int32     `json:"roundToMultiple"`
+	PrometheusQueryRangeSeconds            int       `json:"prometheusQueryRangeSeconds"`
+	PrometheusQueryStepSeconds             int       `json:"prometheusQueryStepSeconds"`
+	PrometheusQueryAggregation             string    `json:"prometheusQueryAggregation"`
+	PrometheusQueryMode                    string    `json:"prometheusQueryMode"`
+	PrometheusCounterIntervalSeconds       int       `json:"prometheusCounterIntervalSeconds"`
+	RateUnit                               string    `json:"rateUnit"`
+	TargetLatency                          float64   `json:"targetLatency"`
+	HTTPMetricsURL                         string    `json:"httpMetricsUrl"`
+	HTTPMetricsJSONPath                    string    `json:"httpMetricsJsonPath"`
+	CloudMonitoringQuery                   string    `json:"cloudMonitoringQuery"`
+	CloudMonitoringProject                 string    `json:"cloudMonitoringProject"`
+	LatencyGain                            float64   `json:"latencyGain"`
+	DisableScaleDownFloor                  string    `json:"disableScaleDownFloor"`
+	ManageMaxReplicas                      string    `json:"manageMaxReplicas"`
+	RespectManualEditsSeconds              int       `json:"respectManualEditsSeconds"`
+	BufferReplicas                         int32     `json:"bufferReplicas"`
+	TargetWindowSize                       int       `json:"targetWindowSize"`
+	TargetWindowMode                       string    `json:"targetWindowMode"`
+	RequestRateWindowSize                  int       `json:"requestRateWindowSize"`
+	MaxRateDropRatio                       float64   `json:"maxRateDropRatio"`
+	ScaleDownStabilizationPolls            int       `json:"scaleDownStabilizationPolls"`
+	WarmupGraceSeconds                     int       `json:"warmupGraceSeconds"`
+	ReplicasSmoothingFactor                float64   `json:"replicasSmoothingFactor"`
+	MinReplicas                            *int32    `json:"minReplicas,omitempty"`
+	RecentTargets                          []int32   `json:"recentTargets,omitempty"`
+	RecentRequestRates                     []float64 `json:"recentRequestRates,omitempty"`
+	LastRequestRate                        float64   `json:"lastRequestRate,omitempty"`
+	ConsecutiveLowReadings                 int       `json:"consecutiveLowReadings,omitempty"`
+	LastRolloutSeen                        string    `json:"lastRolloutSeen,omitempty"`
+	SmoothedReplicas                       float64   `json:"smoothedReplicas,omitempty"`
+}
+
+// namespacedName identifies an hpa across namespaces
+type namespacedName struct {
+	namespace string
+	name      string
 }
 
 type replicaSetsHolder struct {
 	replicaSetList *appsv1.ReplicaSetList
+	// whether a deployment is in progress per resolved scale target, so hpas of the same app share the check within an iteration
+	deploymentsInProgress map[string]bool
+	// the lower bound annotated on each namespace, 0 if it has none, so hpas in the same namespace share the lookup within an iteration
+	namespaceLowerBounds map[string]int32
 }
 
 var (
@@ -64,56 +187,343 @@ var (
 )
 
 var (
-	prometheusServerURL = kingpin.Flag("prometheus-server-url", "The url to reach the Prometheus server.").Envar("PROMETHEUS_SERVER_URL").Required().String()
-
-	// seed random number
+	prometheusServerURL                      = kingpin.Flag("prometheus-server-url", "The url to reach the Prometheus server.").Envar("PROMETHEUS_SERVER_URL").Required().String()
+	prometheusServerURLMapFile               = kingpin.Flag("prometheus-server-url-map-file", "The path to a yaml file mapping namespaces to the url of the Prometheus server for their hpas, overriding --prometheus-server-url.").Envar("PROMETHEUS_SERVER_URL_MAP_FILE").String()
+	prometheusSecondaryServerURL             = kingpin.Flag("prometheus-secondary-server-url", "The url to reach a secondary Prometheus server, queried when the query to the primary server fails.").Envar("PROMETHEUS_SECONDARY_SERVER_URL").String()
+	prometheusPathPrefix                     = kingpin.Flag("prometheus-path-prefix", "The path prefix the Prometheus api is served under, for example /prometheus when behind an ingress.").Envar("PROMETHEUS_PATH_PREFIX").String()
+	prometheusUserAgent                      = kingpin.Flag("prometheus-user-agent", "The User-Agent header sent with Prometheus queries; empty sends estafette-k8s-hpa-scaler followed by the version.").Envar("PROMETHEUS_USER_AGENT").String()
+	prometheusProxyURL                       = kingpin.Flag("prometheus-proxy-url", "The url of the http proxy to send Prometheus queries through; empty uses the proxy from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY envvars, if any.").Envar("PROMETHEUS_PROXY_URL").String()
+	prometheusServiceAccountToken            = kingpin.Flag("prometheus-service-account-token", "Whether to send the token of the pod's service account as bearer token with Prometheus queries, for a Prometheus server behind an authenticating proxy; the token is reread every minute as it rotates.").Default("false").Envar("PROMETHEUS_SERVICE_ACCOUNT_TOKEN").Bool()
+	cloudMonitoringProject                   = kingpin.Flag("cloud-monitoring-project", "The Google Cloud project queried for hpas with a Cloud Monitoring query, unless overridden by their annotation; empty disables Cloud Monitoring as metrics source.").Envar("CLOUD_MONITORING_PROJECT").String()
+	prometheusQueryRetries                   = kingpin.Flag("prometheus-query-retries", "The number of times a prometheus query is retried with exponential backoff when getting, reading or unmarshalling the response fails.").Default("2").Envar("PROMETHEUS_QUERY_RETRIES").Int()
+	prometheusQueryRetryBackoff              = kingpin.Flag("prometheus-query-retry-backoff", "The initial time to wait before retrying a prometheus query, doubling with each retry.").Default("1s").Envar("PROMETHEUS_QUERY_RETRY_BACKOFF").Duration()
+	prometheusCircuitBreakerFailureThreshold = kingpin.Flag("prometheus-circuit-breaker-failure-threshold", "The number of consecutive failed queries after which queries to a Prometheus server are short-circuited; 0 disables the circuit breaker.").Default("5").Envar("PROMETHEUS_CIRCUIT_BREAKER_FAILURE_THRESHOLD").Int()
+	prometheusCircuitBreakerCooldown         = kingpin.Flag("prometheus-circuit-breaker-cooldown", "The time queries to a Prometheus server are short-circuited before a trial query is let through.").Default("5m").Envar("PROMETHEUS_CIRCUIT_BREAKER_COOLDOWN").Duration()
+	scaleDownMode                            = kingpin.Flag("scale-down-mode", "How the scale down max ratio is applied: ratio uses the built-in logic raising minReplicas, native-behavior sets the autoscaling v2 scale down behavior of the hpa.").Default(scaleDownModeRatio).Envar("SCALE_DOWN_MODE").Enum(scaleDownModeRatio, scaleDownModeNativeBehavior)
+	scaleDownStabilizationWindowSeconds      = kingpin.Flag("scale-down-stabilization-window-seconds", "The scale down stabilization window set on hpas when using the native-behavior scale down mode.").Default("300").Envar("SCALE_DOWN_STABILIZATION_WINDOW_SECONDS").Int()
+	scaleDownRatioPerMinute                  = kingpin.Flag("scale-down-ratio-per-minute", "Whether the scale down max ratio is a per minute rate, compounded over the time since minReplicas was last updated, instead of a ratio per poll.").Default("false").Envar("SCALE_DOWN_RATIO_PER_MINUTE").Bool()
+	deploymentCheckingMode                   = kingpin.Flag("deployment-checking-mode", "How replica sets are matched to an hpa when checking whether a deployment is in progress: app-label matches the app label, owner-reference follows the scaleTargetRef of the hpa to its deployment's replica sets, revision does the same but only counts replica sets of another revision than the deployment's current one.").Default(deploymentCheckingModeAppLabel).Envar("DEPLOYMENT_CHECKING_MODE").Enum(deploymentCheckingModeAppLabel, deploymentCheckingModeOwnerReference, deploymentCheckingModeRevision)
+	disableDeploymentChecking                = kingpin.Flag("disable-deployment-checking", "Whether to skip checking for deployments in progress for all hpas, regardless of their annotation, so replica sets are never listed.").Default("false").Envar("DISABLE_DEPLOYMENT_CHECKING").Bool()
+	useInformers                             = kingpin.Flag("use-informers", "Whether to read hpas and replica sets from caches kept up to date by watches, instead of listing them from the api every iteration.").Default("false").Envar("USE_INFORMERS").Bool()
+	updateQPS                                = kingpin.Flag("update-qps", "The maximum number of hpa updates per second sent to the kubernetes api; 0 disables rate limiting.").Default("5").Envar("UPDATE_QPS").Float32()
+	updateBurst                              = kingpin.Flag("update-burst", "The maximum number of hpa updates sent to the kubernetes api in a burst.").Default("10").Envar("UPDATE_BURST").Int()
+	shutdownTimeout                          = kingpin.Flag("shutdown-timeout", "The maximum time to wait for hpas being processed to finish on shutdown; 0 waits indefinitely.").Default("20s").Envar("SHUTDOWN_TIMEOUT").Duration()
+	livenessMaxHeartbeatAge                  = kingpin.Flag("liveness-max-heartbeat-age", "The maximum time since the start of the last poll iteration before the liveness check fails; 0 disables the check.").Default("10m").Envar("LIVENESS_MAX_HEARTBEAT_AGE").Duration()
+	logLevel                                 = kingpin.Flag("log-level", "The minimum level of log messages to output.").Default("info").Envar("LOG_LEVEL").Enum("trace", "debug", "info", "warn", "error", "fatal", "panic")
+	jitterSeed                               = kingpin.Flag("jitter-seed", "The seed for the random jitter applied to the poll interval, to make it reproducible for debugging; 0 seeds from the current time.").Default("0").Envar("JITTER_SEED").Int64()
+	annotationPrefix                         = kingpin.Flag("annotation-prefix", "The prefix of the annotations on hpas read and written by this application.").Default(defaultAnnotationPrefix).Envar("ANNOTATION_PREFIX").String()
+	webhookEnabled                           = kingpin.Flag("webhook-enabled", "Whether to serve a validating admission webhook rejecting hpas with invalid annotations.").Default("false").Envar("WEBHOOK_ENABLED").Bool()
+	webhookPort                              = kingpin.Flag("webhook-port", "The port to serve the validating admission webhook on.").Default("8443").Envar("WEBHOOK_PORT").Int()
+	webhookTLSCertFile                       = kingpin.Flag("webhook-tls-cert-file", "The path to the tls certificate for the validating admission webhook.").Default("/certs/tls.crt").Envar("WEBHOOK_TLS_CERT_FILE").String()
+	webhookTLSKeyFile                        = kingpin.Flag("webhook-tls-key-file", "The path to the tls key for the validating admission webhook.").Default("/certs/tls.key").Envar("WEBHOOK_TLS_KEY_FILE").String()
+	maxMinReplicas                           = kingpin.Flag("max-min-replicas", "The maximum minReplicas set on any hpa, as a safety valve against misconfigured queries; 0 disables the cap.").Default("0").Envar("MAX_MIN_REPLICAS").Int32()
+	metricsPort                              = kingpin.Flag("metrics-port", "The port to serve the prometheus metrics endpoint /metrics on.").Default("9101").Envar("METRICS_PORT").Int()
+	livenessPort                             = kingpin.Flag("liveness-port", "The port to serve the liveness endpoint /liveness on.").Default("5000").Envar("LIVENESS_PORT").Int()
+	enablePprof                              = kingpin.Flag("enable-pprof", "Whether to serve pprof profiles for performance debugging.").Default("false").Envar("ENABLE_PPROF").Bool()
+	pprofPort                                = kingpin.Flag("pprof-port", "The port to serve pprof profiles on.").Default("6060").Envar("PPROF_PORT").Int()
+	otlpMetricsEndpoint                      = kingpin.Flag("otlp-metrics-endpoint", "The otlp/http url to export metrics to, for example http://otel-collector:4318/v1/metrics; empty disables the export.").Envar("OTLP_METRICS_ENDPOINT").String()
+	otlpExportInterval                       = kingpin.Flag("otlp-export-interval", "The interval at which metrics are exported to the otlp endpoint.").Default("60s").Envar("OTLP_EXPORT_INTERVAL").Duration()
+	decisionWebhookURL                       = kingpin.Flag("decision-webhook-url", "The url each change of minReplicas is posted to as json; empty disables the webhook.").Envar("DECISION_WEBHOOK_URL").String()
+	decisionWebhookRetries                   = kingpin.Flag("decision-webhook-retries", "The number of times posting a change to the decision webhook is retried with exponential backoff.").Default("3").Envar("DECISION_WEBHOOK_RETRIES").Int()
+	decisionWebhookRetryBackoff              = kingpin.Flag("decision-webhook-retry-backoff", "The initial time to wait before retrying to post a change to the decision webhook, doubling with each retry.").Default("1s").Envar("DECISION_WEBHOOK_RETRY_BACKOFF").Duration()
+	listRetries                              = kingpin.Flag("list-retries", "The number of times listing the hpas is retried with exponential backoff before waiting for the next poll iteration.").Default("3").Envar("LIST_RETRIES").Int()
+	listRetryBackoff                         = kingpin.Flag("list-retry-backoff", "The initial time to wait before retrying to list the hpas, doubling with each retry.").Default("5s").Envar("LIST_RETRY_BACKOFF").Duration()
+	listPageSize                             = kingpin.Flag("list-page-size", "The maximum number of hpas listed and processed at once; 0 lists all hpas at once.").Default("500").Envar("LIST_PAGE_SIZE").Int64()
+	cleanUpDisabledState                     = kingpin.Flag("clean-up-disabled-state", "Whether to remove the state annotation, and the computed annotations, from hpas that are explicitly disabled.").Default("false").Envar("CLEAN_UP_DISABLED_STATE").Bool()
+	writeComputedAnnotations                 = kingpin.Flag("write-computed-annotations", "Whether to write the last request rate and target minReplicas to annotations on the hpa whenever it's updated.").Default("false").Envar("WRITE_COMPUTED_ANNOTATIONS").Bool()
+	fairNamespaceScheduling                  = kingpin.Flag("fair-namespace-scheduling", "Whether to process the hpas of each listed page round-robin across namespaces, so a namespace with many slow hpas can't delay all others.").Default("false").Envar("FAIR_NAMESPACE_SCHEDULING").Bool()
+	spreadProcessing                         = kingpin.Flag("spread-processing", "Whether to process each hpa at its own jittered time within the poll interval, instead of all hpas in a burst every poll.").Default("false").Envar("SPREAD_PROCESSING").Bool()
+	maxChangesPerIteration                   = kingpin.Flag("max-changes-per-iteration", "The maximum number of hpas updated per poll iteration, preferring the largest changes of minReplicas; the other changes are deferred to the next poll. 0 doesn't limit the number of changes.").Default("0").Envar("MAX_CHANGES_PER_ITERATION").Int()
+	shardCount                               = kingpin.Flag("shard-count", "The number of replicas of this application that divide the hpas among them; 1 processes all hpas in every replica.").Default("1").Envar("SHARD_COUNT").Int()
+	shardIndex                               = kingpin.Flag("shard-index", "The index of this replica among the shard count, from 0 up to the shard count; it only processes the hpas hashed to this index.").Default("0").Envar("SHARD_INDEX").Int()
+	minUpdateInterval                        = kingpin.Flag("min-update-interval", "The minimum time between consecutive updates of minReplicas of the same hpa, even if the target changed; 0 disables the minimum.").Default("0s").Envar("MIN_UPDATE_INTERVAL").Duration()
+	updateFailureBackoff                     = kingpin.Flag("update-failure-backoff", "The time updates of an hpa are skipped after its update failed, doubling with each consecutive failure and reset by a successful update; 0 retries failed updates every iteration.").Default("0s").Envar("UPDATE_FAILURE_BACKOFF").Duration()
+	maxUpdateFailureBackoff                  = kingpin.Flag("max-update-failure-backoff", "The maximum time updates of an hpa are skipped after consecutive failures.").Default("30m").Envar("MAX_UPDATE_FAILURE_BACKOFF").Duration()
+	hpaAllowlistValue                        = kingpin.Flag("hpa-allowlist", "Comma-separated namespace/name pairs of the only hpas to process, for a careful rollout; empty processes all hpas.").Envar("HPA_ALLOWLIST").String()
+	reportStatusCondition                    = kingpin.Flag("report-status-condition", "Whether to set a HPAScalerReconciled condition in the autoscaling v2 status of processed hpas, describing the outcome of the last processing.").Default("false").Envar("REPORT_STATUS_CONDITION").Bool()
+	scaleToZeroEnabled                       = kingpin.Flag("scale-to-zero-enabled", "Whether hpas can opt in to a minReplicas of 0; requires the HPAScaleToZero feature gate to be enabled in the cluster.").Default("false").Envar("SCALE_TO_ZERO_ENABLED").Bool()
+	maintenanceWindowValue                   = kingpin.Flag("maintenance-window", "Comma-separated daily time ranges in UTC, like 22:00-02:00, during which no hpa is updated; metrics are still exported.").Envar("MAINTENANCE_WINDOW").String()
+	metricPrefix                             = kingpin.Flag("metric-prefix", "The prefix of the names of all metrics exported by this application.").Default(defaultMetricPrefix).Envar("METRIC_PREFIX").String()
+	targetMinReplicasBucketsValue            = kingpin.Flag("target-min-replicas-buckets", "Comma-separated upper bounds of the buckets of the target_min_replicas histogram; empty uses 1, 2, 4 up to 1024.").Envar("TARGET_MIN_REPLICAS_BUCKETS").String()
+
+	// the hpas processed in the last complete poll iteration, to remove the metric series of hpas that are gone
+	processedHorizontalPodAutoscalers = map[namespacedName]bool{}
+
+	// the hpas to process regardless of their annotations, parsed from --hpa-allowlist
+	hpaAllowlist = map[string]bool{}
+
+	// the annotation keys, can be overridden with --annotation-prefix
+	annotations = newHPAScalerAnnotations(defaultAnnotationPrefix)
+
+	// short-circuits queries to prometheus servers that keep failing
+	prometheusCircuitBreaker *circuitBreaker
+
+	// skips updates of hpas whose recent updates failed
+	updateBackoffs *updateBackoffTracker
+
+	// throttles updates to the kubernetes api
+	updateRateLimiter flowcontrol.RateLimiter
+
+	// remembers when manual edits of minReplicas were noticed
+	manualEdits = newManualEditTracker()
+
+	// keeps a single info series per hpa
+	hpaInfos = newHPAInfoTracker(hpaInfoVector)
+
+	// caches query responses within a single poll iteration
+	queryCache = newPrometheusQueryCache()
+
+	// seed random number, can be overridden with --jitter-seed
 	r = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	// define prometheus counter
 	hpaTotals = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "estafette_hpa_scaler_totals",
+			Name: "totals",
 			Help: "Number of processed HorizontalPodAutoscalers.",
 		},
-		[]string{"namespace", "status", "initiator"},
+		[]string{"namespace", "status", "reason", "initiator"},
 	)
 
 	// create gauge for tracking minimum number of replicas per hpa
 	minReplicasVector = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "estafette_hpa_scaler_min_replicas",
+		Name: "min_replicas",
 		Help: "The minimum number of replicas per hpa as set by this application.",
 	}, []string{"hpa", "namespace"})
 
+	// create histogram for tracking the distribution of the target minimum number of replicas across all hpas
+	targetMinReplicasHistogram = newTargetMinReplicasHistogram(nil)
+
 	// create gauge for tracking actual number of replicas per hpa
 	actualReplicasVector = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "estafette_hpa_scaler_actual_replicas",
+		Name: "actual_replicas",
 		Help: "The actual number of replicas per hpa as set by this application.",
 	}, []string{"hpa", "namespace"})
 
 	// create gauge for tracking request rate used to set minimum number of replicas per hpa
 	requestRateVector = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "estafette_hpa_scaler_request_rate",
+		Name: "request_rate",
 		Help: "The request rate used for setting minimum number of replicas per hpa as set by this application.",
 	}, []string{"hpa", "namespace"})
+
+	// create gauge for tracking which prometheus server each hpa targets
+	hpaInfoVector = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hpa_info",
+		Help: "Information about each hpa processed by this application, always set to 1.",
+	}, []string{"hpa", "namespace", "prometheus_server_url", "enabled"})
+
+	// create gauge for tracking the time since the last change of minimum number of replicas per hpa
+	secondsSinceLastChangeVector = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "seconds_since_last_change",
+		Help: "The number of seconds since minimum number of replicas per hpa was last changed by this application.",
+	}, []string{"hpa", "namespace"})
+
+	// create gauge for tracking the start of the last poll iteration
+	heartbeatGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "heartbeat_timestamp_seconds",
+		Help: "The unix time at which the last poll iteration started.",
+	})
+
+	// create gauge exposing the build information of this application
+	buildInfoVector = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "The build information of this application, always set to 1.",
+	}, []string{"version", "branch", "revision", "goversion"})
+
+	// define prometheus counter for failures to list the hpas
+	listErrorTotals = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "list_errors",
+			Help: "Number of failed attempts to list the HorizontalPodAutoscalers in the cluster.",
+		},
+	)
+
+	// define prometheus counter for state annotations that are ignored because they're invalid
+	invalidStateTotals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "invalid_state_totals",
+			Help: "Number of times the state annotation of a HorizontalPodAutoscaler was read but invalid, and thus ignored.",
+		},
+		[]string{"hpa", "namespace"},
+	)
+
+	// define prometheus counter for query cache hits and misses
+	prometheusQueryCacheTotals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prometheus_query_cache_totals",
+			Help: "Number of prometheus query cache lookups by result.",
+		},
+		[]string{"result"},
+	)
+
+	// define prometheus counter for tracking how often minimum number of replicas per hpa is capped
+	maxMinReplicasCappedTotals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "max_min_replicas_capped_totals",
+			Help: "Number of times the minimum number of replicas per hpa was capped to the maximum set for this application.",
+		},
+		[]string{"hpa", "namespace"},
+	)
+
+	// define prometheus counter for tracking which prometheus server answered the queries
+	prometheusQueryServerTotals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prometheus_query_server_totals",
+			Help: "Number of successful prometheus queries by the prometheus server that answered them.",
+		},
+		[]string{"prometheus_server_url"},
+	)
+
+	// create gauge for tracking whether the circuit breaker per prometheus server is open
+	prometheusCircuitBreakerStateVector = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prometheus_circuit_breaker_open",
+		Help: "Whether queries to the prometheus server are short-circuited because of consecutive failures.",
+	}, []string{"prometheus_server_url"})
 )
 
 func init() {
-	// metrics have to be registered to be exposed
-	prometheus.MustRegister(hpaTotals)
-	prometheus.MustRegister(minReplicasVector)
-	prometheus.MustRegister(actualReplicasVector)
-	prometheus.MustRegister(requestRateVector)
+	// the build variables are set at link time, so they're available at this point already
+	buildInfoVector.WithLabelValues(version, branch, revision, goVersion).Set(1)
+}
+
+// Registers the metrics with the prefix prepended to their names; metrics have to be registered to be exposed
+func registerMetrics(registerer prometheus.Registerer, prefix string) {
+	registerer = prometheus.WrapRegistererWithPrefix(prefix, registerer)
+
+	registerer.MustRegister(hpaTotals)
+	registerer.MustRegister(minReplicasVector)
+	registerer.MustRegister(targetMinReplicasHistogram)
+	registerer.MustRegister(actualReplicasVector)
+	registerer.MustRegister(requestRateVector)
+	registerer.MustRegister(prometheusCircuitBreakerStateVector)
+	registerer.MustRegister(buildInfoVector)
+	registerer.MustRegister(hpaInfoVector)
+	registerer.MustRegister(secondsSinceLastChangeVector)
+	registerer.MustRegister(prometheusQueryCacheTotals)
+	registerer.MustRegister(prometheusQueryServerTotals)
+	registerer.MustRegister(maxMinReplicasCappedTotals)
+	registerer.MustRegister(listErrorTotals)
+	registerer.MustRegister(invalidStateTotals)
+	registerer.MustRegister(heartbeatGauge)
+}
+
+// Returns the prefix of the metric names set with --metric-prefix, or the default prefix if it's not set
+func getMetricPrefix() string {
+	if *metricPrefix == "" {
+		return defaultMetricPrefix
+	}
+
+	return *metricPrefix
 }
 
 func main() {
 	// parse command line parameters
-	kingpin.Parse()
+	command := kingpin.Parse()
+
+	if *printConfig {
+		if err := printEffectiveConfig(os.Stdout, kingpin.CommandLine); err != nil {
+			log.Fatal().Err(err).Msg("Failed printing effective configuration")
+		}
+		return
+	}
 
 	// init log format from envvar ESTAFETTE_LOG_FORMAT
 	foundation.InitLoggingFromEnv(foundation.NewApplicationInfo(appgroup, app, version, branch, revision, buildDate))
 
-	// init /liveness endpoint
-	foundation.InitLiveness()
+	// override the log level set from envvar ESTAFETTE_LOG_LEVEL
+	if err := setLogLevel(*logLevel); err != nil {
+		log.Fatal().Err(err).Msgf("Failed setting log level %v", *logLevel)
+	}
+
+	annotations = newHPAScalerAnnotations(*annotationPrefix)
+
+	var err error
+	hpaAllowlist, err = parseHPAAllowlist(*hpaAllowlistValue)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing hpa allowlist")
+	}
+	if len(hpaAllowlist) > 0 {
+		log.Info().Msgf("Only processing the %v hpas in the allowlist", len(hpaAllowlist))
+	}
+
+	maintenanceWindows, err = parseMaintenanceWindows(*maintenanceWindowValue)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing maintenance window")
+	}
+	if len(maintenanceWindows) > 0 {
+		log.Info().Msgf("Not updating hpas during maintenance window %v", *maintenanceWindowValue)
+	}
+
+	if *prometheusServerURLMapFile != "" {
+		if err := prometheusServerURLMap.load(*prometheusServerURLMapFile); err != nil {
+			log.Fatal().Err(err).Msg("Failed loading prometheus server url map")
+		}
+	}
+
+	if *prometheusProxyURL != "" {
+		proxy, err := getProxyFunc(*prometheusProxyURL)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Invalid prometheus proxy url %v", *prometheusProxyURL)
+		}
+		prometheusHTTPClient = newPrometheusHTTPClient(proxy)
+	}
+
+	if *prometheusServiceAccountToken {
+		prometheusBearerToken = newBearerTokenSource(serviceAccountTokenPath, serviceAccountTokenRefreshInterval)
+		if _, err := prometheusBearerToken.get(time.Now()); err != nil {
+			log.Fatal().Err(err).Msg("Failed reading service account token")
+		}
+	}
+
+	if *cloudMonitoringProject != "" {
+		client, err := newCloudMonitoringHTTPClient(context.Background())
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed creating Cloud Monitoring client from the application default credentials")
+		}
+		cloudMonitoring = client
+	}
+
+	if command == validateQueryCommand.FullCommand() {
+		if err := runValidateQuery(context.Background(), os.Stdout, *validateQueryQuery, *validateQueryRequestsPerReplica); err != nil {
+			log.Fatal().Err(err).Msg("Failed validating prometheus query")
+		}
+		return
+	}
+
+	targetMinReplicasBuckets, err := parseHistogramBuckets(*targetMinReplicasBucketsValue)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing target min replicas buckets")
+	}
+	if len(targetMinReplicasBuckets) > 0 {
+		targetMinReplicasHistogram = newTargetMinReplicasHistogram(targetMinReplicasBuckets)
+	}
+
+	// the metrics are registered once the flags are parsed, so their names can get the prefix passed with --metric-prefix
+	registerMetrics(prometheus.DefaultRegisterer, getMetricPrefix())
+
+	if *shardCount > 1 && (*shardIndex < 0 || *shardIndex >= *shardCount) {
+		log.Fatal().Msgf("Shard index %v is out of range for shard count %v", *shardIndex, *shardCount)
+	}
+
+	// init /liveness endpoint, failing when the poll loop stalls
+	recordHeartbeat(time.Now())
+	log.Info().Msgf("Serving /liveness on port %v", *livenessPort)
+	initLiveness(*livenessPort)
+
+	// init /validate endpoint, rejecting hpas with invalid annotations at admission
+	if *webhookEnabled {
+		initWebhook(*webhookPort, *webhookTLSCertFile, *webhookTLSKeyFile)
+	}
+
+	// init /debug/pprof endpoints, off by default since profiles expose internals
+	if *enablePprof {
+		initPprof(*pprofPort)
+	}
+
+	if *jitterSeed != 0 {
+		log.Info().Msgf("Seeding jitter with %v", *jitterSeed)
+		r = rand.New(rand.NewSource(*jitterSeed))
+	}
 
 	// creates the in-cluster config
 	kubeClientConfig, err := rest.InClusterConfig()
@@ -127,320 +537,2087 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed creating kubernetes clientset")
 	}
 
-	foundation.InitMetrics()
+	log.Info().Msgf("Serving /metrics on port %v", *metricsPort)
+	initMetrics(*metricsPort)
+
+	prometheusCircuitBreaker = newCircuitBreaker(*prometheusCircuitBreakerFailureThreshold, *prometheusCircuitBreakerCooldown)
+
+	updateBackoffs = newUpdateBackoffTracker(*updateFailureBackoff, *maxUpdateFailureBackoff)
+
+	if *updateQPS > 0 {
+		updateRateLimiter = flowcontrol.NewTokenBucketRateLimiter(*updateQPS, *updateBurst)
+	}
+
+	if *spreadProcessing {
+		hpaScheduler = newHorizontalPodAutoscalerScheduler(pollIntervalSeconds*time.Second, r)
+	}
 
 	gracefulShutdown, waitGroup := foundation.InitGracefulShutdownHandling()
 
+	// cancelled on shutdown, to abort in-flight kubernetes and prometheus requests
+	ctx := foundation.InitCancellationContext(context.Background())
+
+	if *otlpMetricsEndpoint != "" {
+		initOTLPExport(ctx, *otlpMetricsEndpoint, *otlpExportInterval)
+	}
+
+	if *decisionWebhookURL != "" {
+		decisionWebhook = newDecisionWebhookSender(*decisionWebhookURL, *decisionWebhookRetries, *decisionWebhookRetryBackoff)
+	}
+
+	// read hpas and replica sets from caches, to avoid listing all of them every iteration
+	if *useInformers {
+		sharedInformerCache, err = startInformerCache(ctx, k8sClient, 0)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed syncing informer caches")
+		}
+	}
+
+	// reload the prometheus server url map when it changes, so updating the configmap doesn't require a restart
+	if *prometheusServerURLMapFile != "" {
+		if err := prometheusServerURLMap.watch(ctx, *prometheusServerURLMapFile); err != nil {
+			log.Warn().Err(err).Msgf("Failed watching prometheus server url map file %v, changes require a restart", *prometheusServerURLMapFile)
+		}
+	}
+
 	go func(waitGroup *sync.WaitGroup) {
-		// loop indefinitely
-		for {
+		// loop until shutdown
+		for ctx.Err() == nil {
+
+			runReconcileIteration(ctx, k8sClient, waitGroup)
+
+			// sleep random time around 90 seconds, or until the next hpa is due when processing is spread
+			sleepTime := time.Duration(applyJitter(pollIntervalSeconds)) * time.Second
+			if hpaScheduler != nil {
+				sleepTime = hpaScheduler.waitTime(time.Now())
+			}
+			log.Info().Msgf("Sleeping for %v...", sleepTime)
+			select {
+			case <-time.After(sleepTime):
+			case <-ctx.Done():
+			}
+		}
+	}(waitGroup)
+
+	handleGracefulShutdown(gracefulShutdown, waitGroup, *shutdownTimeout)
+}
+
+// reconcileIterationResult is the aggregate outcome of a single poll iteration
+type reconcileIterationResult struct {
+	statusCounts map[string]int
+	hpaCount     int
+	duration     time.Duration
+	err          error
+}
+
+// Runs a single poll iteration: records the heartbeat for the liveness probe, processes the hpas and logs a summary of the outcome
+func runReconcileIteration(ctx context.Context, kubeClient kubernetes.Interface, waitGroup *sync.WaitGroup) (result reconcileIterationResult) {
+	iterationStart := time.Now()
+	recordHeartbeat(iterationStart)
+
+	result.statusCounts, result.hpaCount, result.err = pollHorizontalPodAutoscalers(ctx, kubeClient, waitGroup)
+	result.duration = time.Since(iterationStart)
+
+	if result.err != nil {
+		log.Error().Err(result.err).Msg("Could not list the horizontal pod autoscalers in the cluster.")
+	}
+
+	if result.err == nil || result.hpaCount > 0 {
+		summary := log.Info()
+		for status, count := range result.statusCounts {
+			summary = summary.Int(status, count)
+		}
+		summary.
+			Dur("duration", result.duration).
+			Msgf("Processed %v horizontal pod autoscalers in %v", result.hpaCount, result.duration)
+	}
+
+	return result
+}
+
+// Processes the hpas in all namespaces page by page, so memory use stays bounded in clusters with many hpas
+func pollHorizontalPodAutoscalers(ctx context.Context, kubeClient kubernetes.Interface, waitGroup *sync.WaitGroup) (statusCounts map[string]int, hpaCount int, err error) {
+	replicaSets := &replicaSetsHolder{replicaSetList: nil}
+	queryCache.Clear()
+
+	statusCounts = map[string]int{"succeeded": 0, "skipped": 0, "failed": 0, "paused": 0, "disabled": 0, "maintenance": 0}
+	processed := map[namespacedName]bool{}
+
+	if *maxChangesPerIteration > 0 {
+		changePlan = newChangePlanner()
+		defer func() { changePlan = nil }()
+	}
+
+	// counts the result of the hpa and reports it in its status condition
+	countResult := func(hpa *autoscalingv1.HorizontalPodAutoscaler, result processingResult, err error) {
+		hpaTotals.With(prometheus.Labels{"namespace": hpa.Namespace, "status": result.Status, "reason": result.Reason, "initiator": "poller"}).Inc()
+		statusCounts[result.Status]++
+		hpaCount++
+
+		// hpas without the annotation aren't ours to report on
+		if *reportStatusCondition && result.Reason != reasonNotEnabled {
+			if _, conditionErr := setStatusCondition(ctx, kubeClient, hpa, "poller", result, err, metav1.Now()); conditionErr != nil {
+				log.Warn().Err(conditionErr).Msgf("Setting status condition of hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+			}
+		}
+	}
 
+	// processes the hpa, tracking it as in flight for the shutdown
+	process := func(hpa *autoscalingv1.HorizontalPodAutoscaler) (processingResult, error) {
+		waitGroup.Add(1)
+		defer waitGroup.Done()
+		inFlight.start(namespacedName{hpa.Namespace, hpa.Name}, time.Now())
+		defer inFlight.finish(namespacedName{hpa.Namespace, hpa.Name})
+
+		return processHorizontalPodAutoscaler(ctx, kubeClient, hpa, replicaSets, "poller")
+	}
+
+	// with spread processing the hpas are listed once per interval instead of every iteration, unless they're read from the informer cache anyway
+	var listedHPAs []autoscalingv1.HorizontalPodAutoscaler
+	fromScheduler := false
+	if hpaScheduler != nil && sharedInformerCache == nil {
+		listedHPAs, fromScheduler = hpaScheduler.listed(time.Now())
+	}
+
+	listOptions := metav1.ListOptions{Limit: *listPageSize}
+	for {
+		var hpas *autoscalingv1.HorizontalPodAutoscalerList
+		if fromScheduler {
+			log.Info().Msgf("Using %v horizontal pod autoscalers listed earlier in the poll interval", len(listedHPAs))
+			hpas = &autoscalingv1.HorizontalPodAutoscalerList{Items: listedHPAs}
+		} else {
 			log.Info().Msg("Listing horizontal pod autoscalers for all namespaces...")
-			hpas, err := k8sClient.AutoscalingV1().HorizontalPodAutoscalers("").List(metav1.ListOptions{})
-			replicaSets := &replicaSetsHolder{replicaSetList: nil}
+			hpas, err = listHorizontalPodAutoscalers(ctx, kubeClient, listOptions, *listRetries, *listRetryBackoff)
+			if err != nil {
+				return statusCounts, hpaCount, err
+			}
+
+			log.Info().Msgf("Listed %v horizontal pod autoscalers", len(hpas.Items))
+			listedHPAs = append(listedHPAs, hpas.Items...)
+		}
+
+		if *fairNamespaceScheduling {
+			hpas.Items = interleaveHorizontalPodAutoscalersByNamespace(hpas.Items)
+		}
+
+		// loop all hpas
+		for _, hpa := range hpas.Items {
+			if ctx.Err() != nil {
+				break
+			}
+
+			// another replica takes care of this hpa, to avoid duplicate prometheus queries
+			if !isHorizontalPodAutoscalerInShard(hpa.Namespace, hpa.Name, *shardIndex, *shardCount) {
+				continue
+			}
+
+			// not its turn yet, but its metrics are still current
+			if hpaScheduler != nil && !hpaScheduler.due(namespacedName{hpa.Namespace, hpa.Name}, time.Now()) {
+				processed[namespacedName{hpa.Namespace, hpa.Name}] = true
+				continue
+			}
+
+			// the hpa might have changed since it was listed, not least by its own processing an interval ago
+			if fromScheduler {
+				current, err := kubeClient.AutoscalingV1().HorizontalPodAutoscalers(hpa.Namespace).Get(ctx, hpa.Name, metav1.GetOptions{})
+				if err != nil {
+					// a deleted hpa is dropped with the next listing
+					log.Warn().Err(err).Msgf("Getting hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+					processed[namespacedName{hpa.Namespace, hpa.Name}] = true
+					continue
+				}
+				hpa = *current
+			}
+
+			result, err := process(&hpa)
+			processed[namespacedName{hpa.Namespace, hpa.Name}] = true
+
+			// deferred changes are counted once it's known whether they're applied in this iteration
+			if changePlan == nil || result.Reason != reasonDeferred {
+				countResult(&hpa, result, err)
+			}
+
+			if hpaScheduler != nil {
+				hpaScheduler.processed(namespacedName{hpa.Namespace, hpa.Name}, time.Now())
+			}
 
 			if err != nil {
-				log.Error().Err(err).Msg("Could not list the horizontal pod autoscalers in the cluster.")
-			} else {
-				log.Info().Msgf("Cluster has %v horizontal pod autoscalers", len(hpas.Items))
-
-				// loop all hpas
-				if hpas.Items != nil {
-					for _, hpa := range hpas.Items {
-						waitGroup.Add(1)
-						status, err := processHorizontalPodAutoscaler(k8sClient, &hpa, replicaSets, "poller")
-						hpaTotals.With(prometheus.Labels{"namespace": hpa.Namespace, "status": status, "initiator": "poller"}).Inc()
-						waitGroup.Done()
-
-						if err != nil {
-							log.Warn().Err(err).Msg("")
-							continue
-						}
+				log.Warn().Err(err).Msg("")
+				continue
+			}
+		}
+
+		if ctx.Err() != nil {
+			return statusCounts, hpaCount, nil
+		}
+		if hpas.Continue == "" {
+			if changePlan != nil {
+				// apply the largest changes only, the others are computed again in the next iteration
+				selected, deferred := changePlan.selectChanges(*maxChangesPerIteration)
+				for _, change := range selected {
+					result, err := process(change.hpa)
+					countResult(change.hpa, result, err)
+					if err != nil {
+						log.Warn().Err(err).Msg("")
 					}
 				}
+				for _, change := range deferred {
+					log.Info().Msgf("[poller] HorizontalPodAutosclaler %v.%v - Deferring change of minReplicas by %v to the next iteration, because at most %v hpas are changed per iteration", change.hpa.Name, change.hpa.Namespace, change.delta, *maxChangesPerIteration)
+					countResult(change.hpa, processingResult{"skipped", reasonDeferred}, nil)
+				}
+			}
+
+			// only a complete iteration tells which hpas are gone
+			deleteMetricsOfUnprocessedHorizontalPodAutoscalers(processed)
+			if hpaScheduler != nil {
+				hpaScheduler.retain(processed)
+				if !fromScheduler {
+					hpaScheduler.list(listedHPAs, time.Now())
+				}
 			}
+			return statusCounts, hpaCount, nil
+		}
+		listOptions.Continue = hpas.Continue
+	}
+}
+
+// Lists the hpas in all namespaces, retrying with exponential backoff so transient api outages don't cost a full poll iteration
+func listHorizontalPodAutoscalers(ctx context.Context, kubeClient kubernetes.Interface, listOptions metav1.ListOptions, retries int, backoff time.Duration) (hpas *autoscalingv1.HorizontalPodAutoscalerList, err error) {
+	if sharedInformerCache != nil {
+		return sharedInformerCache.listHorizontalPodAutoscalers()
+	}
+
+	for attempt := 0; ; attempt++ {
+		hpas, err = kubeClient.AutoscalingV1().HorizontalPodAutoscalers("").List(ctx, listOptions)
+		if err == nil {
+			return hpas, nil
+		}
 
-			// sleep random time around 90 seconds
-			sleepTime := applyJitter(90)
-			log.Info().Msgf("Sleeping for %v seconds...", sleepTime)
-			time.Sleep(time.Duration(sleepTime) * time.Second)
+		listErrorTotals.Inc()
+
+		if attempt >= retries {
+			return hpas, err
 		}
-	}(waitGroup)
 
-	foundation.HandleGracefulShutdown(gracefulShutdown, waitGroup)
+		log.Warn().Err(err).Msgf("Listing horizontal pod autoscalers failed, retrying in %v...", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return hpas, err
+		}
+		backoff *= 2
+	}
 }
 
-func processHorizontalPodAutoscaler(kubeClient *kubernetes.Clientset, hpa *autoscalingv1.HorizontalPodAutoscaler, replicaSets *replicaSetsHolder, initiator string) (status string, err error) {
+func processHorizontalPodAutoscaler(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, replicaSets *replicaSetsHolder, initiator string) (result processingResult, err error) {
 	if hpa != nil && hpa.Annotations != nil {
 		desiredState := getDesiredHorizontalPodAutoscalerState(hpa)
 
-		status, err := makeHorizontalPodAutoscalerChanges(kubeClient, hpa, replicaSets, initiator, desiredState)
+		// an explicit opt-out always wins, whatever defaults apply to hpas without the annotation
+		if enabled, ok := hpa.Annotations[annotations.Enabled]; ok && enabled == "false" {
+			deleteHorizontalPodAutoscalerMetrics(hpa.Name, hpa.Namespace)
+			// the info series is kept, so disabled hpas still show up as such
+			hpaInfos.Set(hpa.Name, hpa.Namespace, desiredState.PrometheusServerURL, desiredState.Enabled)
+			if *cleanUpDisabledState {
+				if err := removeStateAnnotations(ctx, kubeClient, hpa, initiator); err != nil {
+					return processingResult{"failed", getFailedReason(err)}, err
+				}
+			}
+			return processingResult{"disabled", reasonDisabled}, nil
+		}
+
+		hpaInfos.Set(hpa.Name, hpa.Namespace, desiredState.PrometheusServerURL, desiredState.Enabled)
+
+		if !isHorizontalPodAutoscalerAllowed(hpaAllowlist, hpa.Namespace, hpa.Name) {
+			deleteHorizontalPodAutoscalerMetrics(hpa.Name, hpa.Namespace)
+			return processingResult{"skipped", reasonNotAllowed}, nil
+		}
+
+		result, err := makeHorizontalPodAutoscalerChanges(ctx, kubeClient, hpa, replicaSets, initiator, desiredState)
+		setSecondsSinceLastChange(hpa, time.Now())
+		if err != nil {
+			return result, err
+		}
+
+		if result.Reason == reasonNotEnabled {
+			deleteHorizontalPodAutoscalerMetrics(hpa.Name, hpa.Namespace)
+		}
+
+		if *scaleDownMode == scaleDownModeNativeBehavior && desiredState.Enabled == "true" && desiredState.Paused != "true" {
+			updated, err := applyNativeScaleDownBehavior(ctx, kubeClient, hpa, initiator, desiredState)
+			if err != nil {
+				return processingResult{"failed", getFailedReason(err)}, err
+			}
+			if updated && result.Status != "succeeded" {
+				result = processingResult{"succeeded", reasonUpdated}
+			}
+		}
+
+		return result, nil
+	}
 
-		return status, err
+	if hpa != nil {
+		deleteHorizontalPodAutoscalerMetrics(hpa.Name, hpa.Namespace)
 	}
 
-	return "skipped", nil
+	return processingResult{"skipped", reasonNotEnabled}, nil
 }
 
 func getDesiredHorizontalPodAutoscalerState(hpa *autoscalingv1.HorizontalPodAutoscaler) (state HPAScalerState) {
+	state, _ = parseDesiredHorizontalPodAutoscalerState(hpa)
+
+	return
+}
+
+// Returns the state from the annotations of the hpa, along with an error for each annotation that has an invalid value and falls back to its default
+func parseDesiredHorizontalPodAutoscalerState(hpa *autoscalingv1.HorizontalPodAutoscaler) (state HPAScalerState, errs []error) {
 	var ok bool
 
 	// get annotations or set default value
-	state.Enabled, ok = hpa.Annotations[annotationHPAScaler]
+	state.Enabled, ok = hpa.Annotations[annotations.Enabled]
 	if !ok {
 		state.Enabled = "false"
 	}
 
-	state.PrometheusQuery, ok = hpa.Annotations[annotationHPAScalerPrometheusQuery]
+	state.PrometheusQuery, ok = hpa.Annotations[annotations.PrometheusQuery]
 	if !ok {
 		state.PrometheusQuery = ""
 	}
 
-	requestsPerReplicaString, ok := hpa.Annotations[annotationHPAScalerRequestsPerReplica]
+	state.QueryWindow, ok = hpa.Annotations[annotations.QueryWindow]
+	if !ok {
+		state.QueryWindow = defaultQueryWindow
+	} else if !prometheusDurationRegexp.MatchString(state.QueryWindow) {
+		errs = append(errs, &ParseError{Annotation: annotations.QueryWindow, Value: state.QueryWindow, Err: errors.New("should be a prometheus duration like 5m")})
+		state.QueryWindow = defaultQueryWindow
+	}
+
+	state.OverrideMinReplicasQuery, ok = hpa.Annotations[annotations.OverrideMinReplicasQuery]
+	if !ok {
+		state.OverrideMinReplicasQuery = ""
+	}
+
+	recordingRule := ""
+	requestsPerReplicaString, ok := hpa.Annotations[annotations.RequestsPerReplica]
 	if !ok {
 		state.RequestsPerReplica = 1
 	} else {
 		i, err := strconv.ParseFloat(requestsPerReplicaString, 64)
-		if err == nil {
+		if err == nil && i >= 0 && !math.IsInf(i, 0) {
 			state.RequestsPerReplica = i
+		} else if name := strings.TrimPrefix(requestsPerReplicaString, recordingRulePrefix); err != nil && name != requestsPerReplicaString && metricNameRegex.MatchString(name) {
+			// a recording rule, resolved with a query below; there's no static value to fall back to if it has no result
+			recordingRule = name
+			state.RequestsPerReplica = 0
 		} else {
+			if err == nil {
+				err = errors.New("should be a finite number not below 0")
+			}
+			errs = append(errs, &ParseError{Annotation: annotations.RequestsPerReplica, Value: requestsPerReplicaString, Err: err})
 			state.RequestsPerReplica = 1
 		}
 	}
 
-	deltaString, ok := hpa.Annotations[annotationHPAScalerDelta]
+	state.RequestsPerReplicaQuery, ok = hpa.Annotations[annotations.RequestsPerReplicaQuery]
 	if !ok {
-		state.Delta = 0
+		state.RequestsPerReplicaQuery = recordingRule
+	}
+
+	state.ConcurrencyQuery, ok = hpa.Annotations[annotations.ConcurrencyQuery]
+	if !ok {
+		state.ConcurrencyQuery = ""
+	}
+
+	concurrencyPerReplicaString, ok := hpa.Annotations[annotations.ConcurrencyPerReplica]
+	if !ok {
+		state.ConcurrencyPerReplica = 0
+		if state.ConcurrencyQuery != "" {
+			errs = append(errs, &ParseError{Annotation: annotations.ConcurrencyPerReplica, Value: "", Err: errors.New("should be set along with the concurrency query")})
+		}
 	} else {
-		i, err := strconv.ParseFloat(deltaString, 64)
-		if err == nil {
-			state.Delta = i
+		i, err := strconv.ParseFloat(concurrencyPerReplicaString, 64)
+		if err == nil && i > 0 && !math.IsInf(i, 0) {
+			state.ConcurrencyPerReplica = i
 		} else {
-			state.Delta = 0
+			errs = append(errs, &ParseError{Annotation: annotations.ConcurrencyPerReplica, Value: concurrencyPerReplicaString, Err: errors.New("should be a positive number")})
+			state.ConcurrencyPerReplica = 0
 		}
 	}
 
-	prometheusServerURLState, ok := hpa.Annotations[annotationHPAScalerPrometheusServerURL]
-	if !ok {
-		prometheusServerURLState = *prometheusServerURL
+	// without a valid concurrency per replica there's nothing to divide the concurrency by, so the query isn't used
+	if state.ConcurrencyPerReplica <= 0 {
+		state.ConcurrencyQuery = ""
 	}
 
-	state.PrometheusServerURL = prometheusServerURLState
+	state.ScaleToZero, ok = hpa.Annotations[annotations.ScaleToZero]
+	if !ok {
+		state.ScaleToZero = "false"
+	}
 
-	scaleDownMaxRatioString, ok := hpa.Annotations[annotationHPAScalerScaleDownMaxRatio]
+	minimumReplicasLowerBoundString, ok := hpa.Annotations[annotations.MinimumReplicasLowerBound]
 	if !ok {
-		state.ScaleDownMaxRatio = 1
+		state.MinimumReplicasLowerBound = 0
 	} else {
-		i, err := strconv.ParseFloat(scaleDownMaxRatioString, 64)
-		if err == nil {
-			state.ScaleDownMaxRatio = i
+		i, err := strconv.ParseInt(minimumReplicasLowerBoundString, 0, 32)
+		if err == nil && i >= 1 {
+			state.MinimumReplicasLowerBound = int32(i)
 		} else {
-			state.ScaleDownMaxRatio = 1
+			errs = append(errs, &ParseError{Annotation: annotations.MinimumReplicasLowerBound, Value: minimumReplicasLowerBoundString, Err: fmt.Errorf("should be at least 1, use %v to go lower", annotations.ScaleToZero)})
+			state.MinimumReplicasLowerBound = 0
 		}
 	}
 
-	state.EnableScaleDownRatioDeploymentChecking, ok = hpa.Annotations[annotationHPAScalerEnableScaleDownRatioDeploymentChecking]
+	coldStartMinReplicasString, ok := hpa.Annotations[annotations.ColdStartMinReplicas]
 	if !ok {
-		state.EnableScaleDownRatioDeploymentChecking = "false"
+		state.ColdStartMinReplicas = 0
+	} else {
+		i, err := strconv.ParseInt(coldStartMinReplicasString, 0, 32)
+		if err == nil && i >= 0 {
+			state.ColdStartMinReplicas = int32(i)
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.ColdStartMinReplicas, Value: coldStartMinReplicasString, Err: errors.New("should be a non-negative integer")})
+			state.ColdStartMinReplicas = 0
+		}
 	}
 
-	return
-}
-
-func makeHorizontalPodAutoscalerChanges(kubeClient *kubernetes.Clientset, hpa *autoscalingv1.HorizontalPodAutoscaler, replicaSets *replicaSetsHolder, initiator string, desiredState HPAScalerState) (status string, err error) {
-	status = "failed"
-
-	// check if hpa-scaler is enabled for this hpa and query is not empty and requests per replica larger than zero
-	if desiredState.Enabled == "true" {
-		minimumReplicasLowerBoundString := os.Getenv("MINIMUM_REPLICAS_LOWER_BOUND")
-		minimumReplicasLowerBound := int32(3)
-		if i, err := strconv.ParseInt(minimumReplicasLowerBoundString, 0, 32); err == nil {
-			minimumReplicasLowerBound = int32(i)
+	roundToMultipleString, ok := hpa.Annotations[annotations.RoundToMultiple]
+	if !ok {
+		state.RoundToMultiple = 1
+	} else {
+		i, err := strconv.ParseInt(roundToMultipleString, 0, 32)
+		if err == nil && i >= 1 {
+			state.RoundToMultiple = int32(i)
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.RoundToMultiple, Value: roundToMultipleString, Err: errors.New("should be at least 1")})
+			state.RoundToMultiple = 1
 		}
+	}
 
-		minPodCountBasedOnPrometheusQuery, requestRate, err := getMinPodCountBasedOnPrometheusQuery(kubeClient, hpa, desiredState)
+	prometheusQueryRangeSecondsString, ok := hpa.Annotations[annotations.PrometheusQueryRangeSeconds]
+	if !ok {
+		state.PrometheusQueryRangeSeconds = 0
+	} else {
+		i, err := strconv.Atoi(prometheusQueryRangeSecondsString)
+		if err == nil {
+			state.PrometheusQueryRangeSeconds = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.PrometheusQueryRangeSeconds, Value: prometheusQueryRangeSecondsString, Err: err})
+			state.PrometheusQueryRangeSeconds = 0
+		}
+	}
 
-		if err != nil {
-			return status, err
+	prometheusQueryStepSecondsString, ok := hpa.Annotations[annotations.PrometheusQueryStepSeconds]
+	if !ok {
+		state.PrometheusQueryStepSeconds = 0
+	} else {
+		i, err := strconv.Atoi(prometheusQueryStepSecondsString)
+		if err == nil {
+			state.PrometheusQueryStepSeconds = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.PrometheusQueryStepSeconds, Value: prometheusQueryStepSecondsString, Err: err})
+			state.PrometheusQueryStepSeconds = 0
 		}
+	}
 
-		minPodCountBasedOnCurrentPodCount := minPodCountBasedOnPrometheusQuery
+	state.PrometheusQueryAggregation, ok = hpa.Annotations[annotations.PrometheusQueryAggregation]
+	if !ok {
+		state.PrometheusQueryAggregation = queryAggregationFirst
+	} else if state.PrometheusQueryAggregation != queryAggregationFirst && state.PrometheusQueryAggregation != queryAggregationSum && state.PrometheusQueryAggregation != queryAggregationPerSeriesCeilSum {
+		errs = append(errs, &ParseError{Annotation: annotations.PrometheusQueryAggregation, Value: state.PrometheusQueryAggregation, Err: fmt.Errorf("should be one of %v, %v or %v", queryAggregationFirst, queryAggregationSum, queryAggregationPerSeriesCeilSum)})
+		state.PrometheusQueryAggregation = queryAggregationFirst
+	}
 
-		deploymentInProgress := false
+	state.PrometheusQueryMode, ok = hpa.Annotations[annotations.PrometheusQueryMode]
+	if !ok {
+		state.PrometheusQueryMode = prometheusQueryModeRate
+	} else if state.PrometheusQueryMode != prometheusQueryModeRate && state.PrometheusQueryMode != prometheusQueryModeCounter && state.PrometheusQueryMode != prometheusQueryModeGauge {
+		errs = append(errs, &ParseError{Annotation: annotations.PrometheusQueryMode, Value: state.PrometheusQueryMode, Err: fmt.Errorf("should be one of %v, %v or %v", prometheusQueryModeRate, prometheusQueryModeCounter, prometheusQueryModeGauge)})
+		state.PrometheusQueryMode = prometheusQueryModeRate
+	}
 
-		if desiredState.EnableScaleDownRatioDeploymentChecking == "true" {
-			// We only actually check if a deployment is in progress if this feature is explicitly enabled with an annotation.
-			deploymentInProgress = isDeploymentInProgress(kubeClient, hpa, replicaSets)
+	prometheusCounterIntervalSecondsString, ok := hpa.Annotations[annotations.PrometheusCounterIntervalSeconds]
+	if !ok {
+		state.PrometheusCounterIntervalSeconds = 60
+	} else {
+		i, err := strconv.Atoi(prometheusCounterIntervalSecondsString)
+		if err == nil && i > 0 {
+			state.PrometheusCounterIntervalSeconds = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.PrometheusCounterIntervalSeconds, Value: prometheusCounterIntervalSecondsString, Err: errors.New("should be a positive number of seconds")})
+			state.PrometheusCounterIntervalSeconds = 60
+		}
+	}
+
+	state.HTTPMetricsURL, ok = hpa.Annotations[annotations.HTTPMetricsURL]
+	if !ok {
+		state.HTTPMetricsURL = ""
+	}
+
+	state.HTTPMetricsJSONPath, ok = hpa.Annotations[annotations.HTTPMetricsJSONPath]
+	if !ok {
+		state.HTTPMetricsJSONPath = ""
+	}
+	if state.HTTPMetricsURL != "" {
+		if _, err := parseHTTPMetricsJSONPath(state.HTTPMetricsJSONPath); err != nil || state.HTTPMetricsJSONPath == "" {
+			errs = append(errs, &ParseError{Annotation: annotations.HTTPMetricsJSONPath, Value: state.HTTPMetricsJSONPath, Err: errors.New("should be a jsonpath expression selecting the request rate")})
+		}
+	}
+
+	state.CloudMonitoringQuery, ok = hpa.Annotations[annotations.CloudMonitoringQuery]
+	if !ok {
+		state.CloudMonitoringQuery = ""
+	}
+
+	state.CloudMonitoringProject, ok = hpa.Annotations[annotations.CloudMonitoringProject]
+	if !ok {
+		state.CloudMonitoringProject = *cloudMonitoringProject
+	}
+	if state.CloudMonitoringQuery != "" && state.CloudMonitoringProject == "" {
+		errs = append(errs, &ParseError{Annotation: annotations.CloudMonitoringProject, Value: state.CloudMonitoringProject, Err: errors.New("should be the project to run the cloud monitoring query in, or set --cloud-monitoring-project")})
+	}
+
+	state.RateUnit, ok = hpa.Annotations[annotations.RateUnit]
+	if !ok {
+		state.RateUnit = rateUnitPerSecond
+	} else if state.RateUnit != rateUnitPerSecond && state.RateUnit != rateUnitPerMinute {
+		errs = append(errs, &ParseError{Annotation: annotations.RateUnit, Value: state.RateUnit, Err: fmt.Errorf("should be one of %v or %v", rateUnitPerSecond, rateUnitPerMinute)})
+		state.RateUnit = rateUnitPerSecond
+	}
+
+	targetLatencyString, ok := hpa.Annotations[annotations.TargetLatency]
+	if !ok {
+		state.TargetLatency = 0
+	} else {
+		i, err := strconv.ParseFloat(targetLatencyString, 64)
+		if err == nil {
+			state.TargetLatency = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.TargetLatency, Value: targetLatencyString, Err: err})
+			state.TargetLatency = 0
+		}
+	}
+
+	latencyGainString, ok := hpa.Annotations[annotations.LatencyGain]
+	if !ok {
+		state.LatencyGain = 1
+	} else {
+		i, err := strconv.ParseFloat(latencyGainString, 64)
+		if err == nil {
+			state.LatencyGain = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.LatencyGain, Value: latencyGainString, Err: err})
+			state.LatencyGain = 1
+		}
+	}
+
+	deltaString, ok := hpa.Annotations[annotations.Delta]
+	if !ok {
+		state.Delta = 0
+	} else {
+		i, err := strconv.ParseFloat(deltaString, 64)
+		if err == nil {
+			state.Delta = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.Delta, Value: deltaString, Err: err})
+			state.Delta = 0
+		}
+	}
+
+	deltaRatioString, ok := hpa.Annotations[annotations.DeltaRatio]
+	if !ok {
+		state.DeltaRatio = 0
+	} else {
+		i, err := strconv.ParseFloat(deltaRatioString, 64)
+		if err == nil && i >= 0 {
+			state.DeltaRatio = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.DeltaRatio, Value: deltaRatioString, Err: errors.New("should be a number of at least 0")})
+			state.DeltaRatio = 0
+		}
+	}
+
+	safetyFactorString, ok := hpa.Annotations[annotations.SafetyFactor]
+	if !ok {
+		state.SafetyFactor = 1
+	} else {
+		i, err := strconv.ParseFloat(safetyFactorString, 64)
+		if err == nil && i > 0 {
+			state.SafetyFactor = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.SafetyFactor, Value: safetyFactorString, Err: errors.New("should be a positive number")})
+			state.SafetyFactor = 1
+		}
+	}
+
+	prometheusServerURLState, ok := hpa.Annotations[annotations.PrometheusServerURL]
+	if !ok {
+		prometheusServerURLState = prometheusServerURLMap.get(hpa.Namespace, *prometheusServerURL)
+	} else if err := validateServerURL(prometheusServerURLState); err != nil {
+		// a malformed url would otherwise only fail with a confusing error once it's queried
+		defaultPrometheusServerURL := prometheusServerURLMap.get(hpa.Namespace, *prometheusServerURL)
+		log.Warn().Err(err).Msgf("Hpa %v in namespace %v has invalid prometheus server url %v, using %v instead", hpa.Name, hpa.Namespace, prometheusServerURLState, defaultPrometheusServerURL)
+		errs = append(errs, &ParseError{Annotation: annotations.PrometheusServerURL, Value: prometheusServerURLState, Err: err})
+		prometheusServerURLState = defaultPrometheusServerURL
+	}
+
+	state.PrometheusServerURL = prometheusServerURLState
+
+	state.PrometheusSecondaryServerURL, ok = hpa.Annotations[annotations.PrometheusSecondaryServerURL]
+	if !ok {
+		state.PrometheusSecondaryServerURL = *prometheusSecondaryServerURL
+	}
+
+	prometheusServerURLsString, ok := hpa.Annotations[annotations.PrometheusServerURLs]
+	if ok {
+		state.PrometheusServerURLs = parsePrometheusServerURLs(prometheusServerURLsString)
+	}
+
+	state.PrometheusServerAggregation, ok = hpa.Annotations[annotations.PrometheusServerAggregation]
+	if !ok {
+		state.PrometheusServerAggregation = serverAggregationSum
+	} else if state.PrometheusServerAggregation != serverAggregationSum && state.PrometheusServerAggregation != serverAggregationMax {
+		errs = append(errs, &ParseError{Annotation: annotations.PrometheusServerAggregation, Value: state.PrometheusServerAggregation, Err: fmt.Errorf("should be one of %v or %v", serverAggregationSum, serverAggregationMax)})
+		state.PrometheusServerAggregation = serverAggregationSum
+	}
+
+	state.PrometheusPathPrefix, ok = hpa.Annotations[annotations.PrometheusPathPrefix]
+	if !ok {
+		state.PrometheusPathPrefix = *prometheusPathPrefix
+	}
+
+	scaleDownMaxRatioString, ok := hpa.Annotations[annotations.ScaleDownMaxRatio]
+	if !ok {
+		state.ScaleDownMaxRatio = 1
+	} else {
+		i, err := strconv.ParseFloat(scaleDownMaxRatioString, 64)
+		if err == nil {
+			state.ScaleDownMaxRatio = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.ScaleDownMaxRatio, Value: scaleDownMaxRatioString, Err: err})
+			state.ScaleDownMaxRatio = 1
+		}
+	}
+
+	state.EnableScaleDownRatioDeploymentChecking, ok = hpa.Annotations[annotations.EnableScaleDownRatioDeploymentChecking]
+	if !ok {
+		state.EnableScaleDownRatioDeploymentChecking = "false"
+	}
+
+	state.DeploymentInProgressPredicate, ok = hpa.Annotations[annotations.DeploymentInProgressPredicate]
+	if !ok {
+		state.DeploymentInProgressPredicate = deploymentInProgressPredicateReplicaSets
+	} else if _, known := deploymentInProgressPredicates[state.DeploymentInProgressPredicate]; !known {
+		errs = append(errs, &ParseError{Annotation: annotations.DeploymentInProgressPredicate, Value: state.DeploymentInProgressPredicate, Err: fmt.Errorf("should be one of %v or %v", deploymentInProgressPredicateReplicaSets, deploymentInProgressPredicateReadyReplicas)})
+		state.DeploymentInProgressPredicate = deploymentInProgressPredicateReplicaSets
+	}
+
+	deploymentInProgressReplicaSetsString, ok := hpa.Annotations[annotations.DeploymentInProgressReplicaSets]
+	if !ok {
+		state.DeploymentInProgressReplicaSets = 1
+	} else {
+		i, err := strconv.Atoi(deploymentInProgressReplicaSetsString)
+		if err == nil && i >= 1 {
+			state.DeploymentInProgressReplicaSets = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.DeploymentInProgressReplicaSets, Value: deploymentInProgressReplicaSetsString, Err: errors.New("should be at least 1")})
+			state.DeploymentInProgressReplicaSets = 1
+		}
+	}
+
+	state.DisableScaleDownFloor, ok = hpa.Annotations[annotations.DisableScaleDownFloor]
+	if !ok {
+		state.DisableScaleDownFloor = "false"
+	}
+
+	state.ManageMaxReplicas, ok = hpa.Annotations[annotations.ManageMaxReplicas]
+	if !ok {
+		state.ManageMaxReplicas = "true"
+	}
+
+	respectManualEditsSecondsString, ok := hpa.Annotations[annotations.RespectManualEditsSeconds]
+	if !ok {
+		state.RespectManualEditsSeconds = 0
+	} else {
+		i, err := strconv.Atoi(respectManualEditsSecondsString)
+		if err == nil {
+			state.RespectManualEditsSeconds = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.RespectManualEditsSeconds, Value: respectManualEditsSecondsString, Err: err})
+			state.RespectManualEditsSeconds = 0
+		}
+	}
+
+	bufferReplicasString, ok := hpa.Annotations[annotations.BufferReplicas]
+	if !ok {
+		state.BufferReplicas = 0
+	} else {
+		i, err := strconv.ParseInt(bufferReplicasString, 0, 32)
+		if err == nil {
+			state.BufferReplicas = int32(i)
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.BufferReplicas, Value: bufferReplicasString, Err: err})
+			state.BufferReplicas = 0
+		}
+	}
+
+	targetWindowSizeString, ok := hpa.Annotations[annotations.TargetWindowSize]
+	if !ok {
+		state.TargetWindowSize = 1
+	} else {
+		i, err := strconv.Atoi(targetWindowSizeString)
+		if err == nil {
+			state.TargetWindowSize = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.TargetWindowSize, Value: targetWindowSizeString, Err: err})
+			state.TargetWindowSize = 1
+		}
+	}
+
+	state.TargetWindowMode, ok = hpa.Annotations[annotations.TargetWindowMode]
+	if !ok {
+		state.TargetWindowMode = targetWindowModeMax
+	} else if state.TargetWindowMode != targetWindowModeMax && state.TargetWindowMode != targetWindowModeMedian {
+		errs = append(errs, &ParseError{Annotation: annotations.TargetWindowMode, Value: state.TargetWindowMode, Err: fmt.Errorf("should be one of %v or %v", targetWindowModeMax, targetWindowModeMedian)})
+		state.TargetWindowMode = targetWindowModeMax
+	}
+
+	requestRateWindowSizeString, ok := hpa.Annotations[annotations.RequestRateWindowSize]
+	if !ok {
+		state.RequestRateWindowSize = 1
+	} else {
+		i, err := strconv.Atoi(requestRateWindowSizeString)
+		if err == nil {
+			state.RequestRateWindowSize = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.RequestRateWindowSize, Value: requestRateWindowSizeString, Err: err})
+			state.RequestRateWindowSize = 1
+		}
+	}
+
+	maxRateDropRatioString, ok := hpa.Annotations[annotations.MaxRateDropRatio]
+	if !ok {
+		state.MaxRateDropRatio = 0
+	} else {
+		i, err := strconv.ParseFloat(maxRateDropRatioString, 64)
+		if err == nil {
+			state.MaxRateDropRatio = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.MaxRateDropRatio, Value: maxRateDropRatioString, Err: err})
+			state.MaxRateDropRatio = 0
+		}
+	}
+
+	scaleDownStabilizationPollsString, ok := hpa.Annotations[annotations.ScaleDownStabilizationPolls]
+	if !ok {
+		state.ScaleDownStabilizationPolls = 1
+	} else {
+		i, err := strconv.Atoi(scaleDownStabilizationPollsString)
+		if err == nil && i >= 1 {
+			state.ScaleDownStabilizationPolls = i
+		} else {
+			if err == nil {
+				err = errors.New("should be at least 1")
+			}
+			errs = append(errs, &ParseError{Annotation: annotations.ScaleDownStabilizationPolls, Value: scaleDownStabilizationPollsString, Err: err})
+			state.ScaleDownStabilizationPolls = 1
+		}
+	}
+
+	warmupGraceSecondsString, ok := hpa.Annotations[annotations.WarmupGraceSeconds]
+	if !ok {
+		state.WarmupGraceSeconds = 0
+	} else {
+		i, err := strconv.Atoi(warmupGraceSecondsString)
+		if err == nil && i >= 0 {
+			state.WarmupGraceSeconds = i
+		} else {
+			if err == nil {
+				err = errors.New("should not be negative")
+			}
+			errs = append(errs, &ParseError{Annotation: annotations.WarmupGraceSeconds, Value: warmupGraceSecondsString, Err: err})
+			state.WarmupGraceSeconds = 0
+		}
+	}
+
+	replicasSmoothingFactorString, ok := hpa.Annotations[annotations.ReplicasSmoothingFactor]
+	if !ok {
+		state.ReplicasSmoothingFactor = 1
+	} else {
+		f, err := strconv.ParseFloat(replicasSmoothingFactorString, 64)
+		if err == nil && f > 0 && f <= 1 {
+			state.ReplicasSmoothingFactor = f
+		} else {
+			if err == nil {
+				err = errors.New("should be larger than 0 and at most 1")
+			}
+			errs = append(errs, &ParseError{Annotation: annotations.ReplicasSmoothingFactor, Value: replicasSmoothingFactorString, Err: err})
+			state.ReplicasSmoothingFactor = 1
+		}
+	}
+
+	state.Paused, ok = hpa.Annotations[annotations.Paused]
+	if !ok {
+		state.Paused = "false"
+	}
+
+	state.RatchetUpOnly, ok = hpa.Annotations[annotations.RatchetUpOnly]
+	if !ok {
+		state.RatchetUpOnly = "false"
+	}
+
+	minChangeString, ok := hpa.Annotations[annotations.MinChange]
+	if !ok {
+		state.MinChange = 1
+	} else {
+		i, err := strconv.ParseInt(minChangeString, 0, 32)
+		if err == nil {
+			state.MinChange = int32(i)
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.MinChange, Value: minChangeString, Err: err})
+			state.MinChange = 1
+		}
+	}
+
+	minChangeRatioString, ok := hpa.Annotations[annotations.MinChangeRatio]
+	if !ok {
+		state.MinChangeRatio = 0
+	} else {
+		i, err := strconv.ParseFloat(minChangeRatioString, 64)
+		if err == nil {
+			state.MinChangeRatio = i
+		} else {
+			errs = append(errs, &ParseError{Annotation: annotations.MinChangeRatio, Value: minChangeRatioString, Err: err})
+			state.MinChangeRatio = 0
+		}
+	}
+
+	return
+}
+
+func makeHorizontalPodAutoscalerChanges(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, replicaSets *replicaSetsHolder, initiator string, desiredState HPAScalerState) (result processingResult, err error) {
+
+	// check if hpa-scaler is enabled for this hpa and query is not empty and requests per replica larger than zero
+	if desiredState.Enabled == "true" {
+		minimumReplicasLowerBound := getMinimumReplicasLowerBound(ctx, kubeClient, hpa, replicaSets, desiredState)
+
+		overrideMinReplicas, overridden := getOverrideMinReplicas(ctx, hpa, desiredState)
+
+		minPodCountBasedOnPrometheusQuery, requestRate, err := getMinPodCountBasedOnPrometheusQuery(ctx, kubeClient, hpa, desiredState)
+
+		if err != nil && !overridden {
+			return processingResult{"failed", getFailedReason(err)}, err
+		}
+		if err != nil {
+			log.Warn().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Retrieving request rate failed, but minReplicas is overridden", initiator, hpa.Name, hpa.Namespace)
+		}
+
+		minPodCountBasedOnCurrentPodCount := minPodCountBasedOnPrometheusQuery
+
+		// With the native scale down behavior kubernetes itself limits the scale down rate, so the built-in ratio logic is skipped.
+		// The same goes for hpas that only want to follow the request rate.
+		if *scaleDownMode != scaleDownModeNativeBehavior && desiredState.DisableScaleDownFloor != "true" {
+			deploymentInProgress := false
+
+			if desiredState.EnableScaleDownRatioDeploymentChecking == "true" && !*disableDeploymentChecking {
+				// We only actually check if a deployment is in progress if this feature is explicitly enabled with an annotation, and not disabled globally.
+				deploymentInProgress = isDeploymentInProgress(ctx, kubeClient, hpa, replicaSets, desiredState)
+			}
+
+			// We smooth the current replicas over the recent polls, so a transient surge doesn't allow a big scale down once it's over.
+			if desiredState.ReplicasSmoothingFactor > 0 && desiredState.ReplicasSmoothingFactor < 1 {
+				lastState, _ := getLastState(hpa)
+				desiredState.SmoothedReplicas = getSmoothedReplicas(lastState.SmoothedReplicas, hpa.Status.CurrentReplicas, desiredState.ReplicasSmoothingFactor)
+			}
+
+			if !deploymentInProgress {
+				scaleDownState := desiredState
+				if *scaleDownRatioPerMinute {
+					scaleDownState.ScaleDownMaxRatio = getScaleDownMaxRatioSinceLastUpdate(hpa, desiredState.ScaleDownMaxRatio, time.Now())
+				}
+				minPodCountBasedOnCurrentPodCount = getMinPodCountBasedOnCurrentPodCount(kubeClient, hpa, scaleDownState)
+			}
+		}
+
+		log.Debug().
+			Float64("requestRate", requestRate).
+			Int32("minPodCountBasedOnPrometheusQuery", minPodCountBasedOnPrometheusQuery).
+			Int32("minPodCountBasedOnCurrentPodCount", minPodCountBasedOnCurrentPodCount).
+			Float64("desiredState.RequestsPerReplica", desiredState.RequestsPerReplica).
+			Float64("desiredState.Delta", desiredState.Delta).
+			Float64("desiredState.ScaleDownMaxRatio", desiredState.ScaleDownMaxRatio).
+			Float64("requestRate/desiredState.RequestsPerReplica", requestRate/desiredState.RequestsPerReplica).
+			Float64("desiredState.Delta + requestRate/desiredState.RequestsPerReplica", desiredState.Delta+requestRate/desiredState.RequestsPerReplica).
+			Float64("math.Ceil(desiredState.Delta + requestRate/desiredState.RequestsPerReplica)", math.Ceil(desiredState.Delta+requestRate/desiredState.RequestsPerReplica)).
+			Int32("int32(math.Ceil(desiredState.Delta + requestRate/desiredState.RequestsPerReplica))", int32(math.Ceil(desiredState.Delta+requestRate/desiredState.RequestsPerReplica))).
+			Int32("int32(math.Floor(float64(*hpa.Status.CurrentReplicas) * desiredState.ScaleDownMaxRatio))", int32(math.Floor(float64(hpa.Status.CurrentReplicas)*desiredState.ScaleDownMaxRatio))).
+			Msgf("Calculated values for hpa %v in namespace %v", hpa.Name, hpa.Namespace)
+
+		// We pick the larger minimum of the two.
+		targetNumberOfMinReplicas := minPodCountBasedOnPrometheusQuery
+		if minPodCountBasedOnCurrentPodCount > targetNumberOfMinReplicas {
+			targetNumberOfMinReplicas = minPodCountBasedOnCurrentPodCount
+		}
+
+		// We smooth the target over the most recent targets to reduce flapping.
+		if desiredState.TargetWindowSize > 1 {
+			lastState, _ := getLastState(hpa)
+			targetNumberOfMinReplicas, desiredState.RecentTargets = getWindowedTarget(lastState.RecentTargets, targetNumberOfMinReplicas, desiredState.TargetWindowSize, desiredState.TargetWindowMode)
+		}
+
+		// We keep the most recent request rates, whose maximum the target was calculated from.
+		if desiredState.RequestRateWindowSize > 1 {
+			lastState, _ := getLastState(hpa)
+			desiredState.RecentRequestRates = lastState.RecentRequestRates
+			if err == nil {
+				_, desiredState.RecentRequestRates = getWindowedRequestRate(lastState.RecentRequestRates, requestRate, desiredState.RequestRateWindowSize)
+			}
+		}
+
+		// We keep a fixed number of extra replicas on top of the calculated minimum.
+		targetNumberOfMinReplicas += desiredState.BufferReplicas
+
+		// We only override the minimum pod count if we don't go below the hard-coded minimum.
+		updatedReason := reasonUpdated
+		if targetNumberOfMinReplicas < minimumReplicasLowerBound {
+			targetNumberOfMinReplicas = minimumReplicasLowerBound
+			updatedReason = reasonClampedLower
+		}
+
+		// We round up to a multiple, for example the number of zones, so the replicas can be spread evenly.
+		targetNumberOfMinReplicas = roundUpToMultiple(targetNumberOfMinReplicas, desiredState.RoundToMultiple)
+
+		// The result of the override query takes precedence over all calculations above, only the lower and upper bounds still apply.
+		if overridden {
+			log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Overriding calculated minReplicas of %v with %v", initiator, hpa.Name, hpa.Namespace, targetNumberOfMinReplicas, overrideMinReplicas)
+			targetNumberOfMinReplicas = overrideMinReplicas
+			updatedReason = reasonOverridden
+			if targetNumberOfMinReplicas < minimumReplicasLowerBound {
+				targetNumberOfMinReplicas = minimumReplicasLowerBound
+				updatedReason = reasonClampedLower
+			}
+		}
+
+		// We never go above the cluster wide maximum, whatever the annotations of the hpa say.
+		if *maxMinReplicas > 0 && targetNumberOfMinReplicas > *maxMinReplicas {
+			log.Warn().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Capping minReplicas of %v to the maximum of %v", initiator, hpa.Name, hpa.Namespace, targetNumberOfMinReplicas, *maxMinReplicas)
+			maxMinReplicasCappedTotals.WithLabelValues(hpa.Name, hpa.Namespace).Inc()
+			targetNumberOfMinReplicas = *maxMinReplicas
+			updatedReason = reasonClampedUpper
+		}
+
+		// We leave maxReplicas alone if the hpa manages it itself, so minReplicas can't go above it.
+		if desiredState.ManageMaxReplicas == "false" && targetNumberOfMinReplicas > hpa.Spec.MaxReplicas {
+			targetNumberOfMinReplicas = hpa.Spec.MaxReplicas
+			updatedReason = reasonClampedUpper
+		}
+
+		currentNumberOfMinReplicas := *hpa.Spec.MinReplicas
+		actualNumberOfReplicas := hpa.Status.CurrentReplicas
+
+		// We count the polls in a row that wanted to scale down, any other target resets the count.
+		if desiredState.ScaleDownStabilizationPolls > 1 && targetNumberOfMinReplicas < currentNumberOfMinReplicas {
+			lastState, _ := getLastState(hpa)
+			desiredState.ConsecutiveLowReadings = lastState.ConsecutiveLowReadings + 1
+		}
+
+		// We remember the last rollout, after which freshly started pods might not serve their share of requests yet.
+		if desiredState.WarmupGraceSeconds > 0 && !*disableDeploymentChecking {
+			desiredState.LastRolloutSeen = getLastRolloutSeen(ctx, kubeClient, hpa, replicaSets, desiredState, time.Now())
+		}
+
+		// We store the request rate with the state, to detect suspicious drops in the next poll.
+		desiredState.LastRequestRate = requestRate
+
+		// set prometheus gauge values
+		minReplicasVector.WithLabelValues(hpa.Name, hpa.Namespace).Set(float64(targetNumberOfMinReplicas))
+		targetMinReplicasHistogram.Observe(float64(targetNumberOfMinReplicas))
+		actualReplicasVector.WithLabelValues(hpa.Name, hpa.Namespace).Set(float64(actualNumberOfReplicas))
+		requestRateVector.WithLabelValues(hpa.Name, hpa.Namespace).Set(requestRate)
+
+		if desiredState.Paused == "true" {
+			// don't update hpa, minReplicas is pinned by an operator
+			log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because it's paused, minReplicas would have changed from %v to %v", initiator, hpa.Name, hpa.Namespace, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+			return processingResult{"paused", reasonPaused}, nil
+		}
+
+		if isInMaintenanceWindow(maintenanceWindows, time.Now()) {
+			// don't update hpa, autoscaling is frozen cluster-wide
+			log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because of the maintenance window, minReplicas would have changed from %v to %v", initiator, hpa.Name, hpa.Namespace, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+			return processingResult{"maintenance", reasonMaintenance}, nil
+		}
+
+		if isManualEditRespected(hpa, desiredState, time.Now()) {
+			// don't update hpa, minReplicas was recently changed by someone else
+			log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because minReplicas was edited manually, minReplicas would have changed from %v to %v", initiator, hpa.Name, hpa.Namespace, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+			return processingResult{"skipped", reasonCooldown}, nil
+		}
+
+		if desiredState.RatchetUpOnly == "true" && targetNumberOfMinReplicas < currentNumberOfMinReplicas {
+			// don't scale down, lowering minReplicas of this hpa is left to an operator
+			log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because it only ratchets up, minReplicas would have changed from %v to %v", initiator, hpa.Name, hpa.Namespace, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+			if err := updateRecentTargets(ctx, kubeClient, hpa, initiator, desiredState); err != nil {
+				return processingResult{"failed", getFailedReason(err)}, err
+			}
+			return processingResult{"skipped", reasonRatchet}, nil
+		}
+
+		if targetNumberOfMinReplicas < currentNumberOfMinReplicas && isRequestRateDropSuspicious(hpa, desiredState, requestRate) {
+			// don't scale down, the query might be broken; the new rate is stored so a drop that persists is followed in the next poll
+			log.Warn().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because the request rate of %v dropped by more than ratio %v since the last poll, minReplicas would have changed from %v to %v", initiator, hpa.Name, hpa.Namespace, requestRate, desiredState.MaxRateDropRatio, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+			if err := updateStateAnnotation(ctx, kubeClient, hpa, initiator, desiredState); err != nil {
+				return processingResult{"failed", getFailedReason(err)}, err
+			}
+			return processingResult{"skipped", reasonRateDrop}, nil
+		}
+
+		if targetNumberOfMinReplicas < currentNumberOfMinReplicas && isInWarmupGracePeriod(desiredState, time.Now()) {
+			// don't scale down, the request rate is likely too low while the pods of the last rollout warm up
+			log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because it's less than %v seconds since its last rollout at %v, minReplicas would have changed from %v to %v", initiator, hpa.Name, hpa.Namespace, desiredState.WarmupGraceSeconds, desiredState.LastRolloutSeen, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+			if err := updateRecentTargets(ctx, kubeClient, hpa, initiator, desiredState); err != nil {
+				return processingResult{"failed", getFailedReason(err)}, err
+			}
+			return processingResult{"skipped", reasonWarmup}, nil
+		}
+
+		if targetNumberOfMinReplicas < currentNumberOfMinReplicas && desiredState.ConsecutiveLowReadings < desiredState.ScaleDownStabilizationPolls && desiredState.ScaleDownStabilizationPolls > 1 {
+			// don't scale down yet, a single low reading might be a dip; the count is stored so the next poll continues it
+			log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because only %v of %v polls in a row wanted to scale down, minReplicas would have changed from %v to %v", initiator, hpa.Name, hpa.Namespace, desiredState.ConsecutiveLowReadings, desiredState.ScaleDownStabilizationPolls, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+			if err := updateStateAnnotation(ctx, kubeClient, hpa, initiator, desiredState); err != nil {
+				return processingResult{"failed", getFailedReason(err)}, err
+			}
+			return processingResult{"skipped", reasonStabilizing}, nil
+		}
+
+		if targetNumberOfMinReplicas == currentNumberOfMinReplicas {
+			// don't update minReplicas, but keep track of the recent targets
+			if err := updateRecentTargets(ctx, kubeClient, hpa, initiator, desiredState); err != nil {
+				return processingResult{"failed", getFailedReason(err)}, err
+			}
+			return processingResult{"skipped", reasonNoChange}, nil
+		}
+
+		minReplicasChange := targetNumberOfMinReplicas - currentNumberOfMinReplicas
+		if minReplicasChange < 0 {
+			minReplicasChange = -minReplicasChange
+		}
+		// A target clamped to a limit the current minReplicas is beyond is applied however small the change, so the hpa doesn't stay beyond it.
+		enforcingLimit := (updatedReason == reasonClampedUpper && currentNumberOfMinReplicas > targetNumberOfMinReplicas) || (updatedReason == reasonClampedLower && currentNumberOfMinReplicas < targetNumberOfMinReplicas)
+		if !enforcingLimit && minReplicasChange < desiredState.MinChange {
+			// don't update hpa, the change is too small to prevent flapping
+			log.Debug().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because the change of minReplicas from %v to %v is smaller than %v", initiator, hpa.Name, hpa.Namespace, currentNumberOfMinReplicas, targetNumberOfMinReplicas, desiredState.MinChange)
+			if err := updateRecentTargets(ctx, kubeClient, hpa, initiator, desiredState); err != nil {
+				return processingResult{"failed", getFailedReason(err)}, err
+			}
+			return processingResult{"skipped", reasonBelowMinChange}, nil
+		}
+		if !enforcingLimit && float64(minReplicasChange) < desiredState.MinChangeRatio*float64(currentNumberOfMinReplicas) {
+			// don't update hpa, the change is too small relative to the current minReplicas to prevent flapping
+			log.Debug().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because the change of minReplicas from %v to %v is smaller than ratio %v", initiator, hpa.Name, hpa.Namespace, currentNumberOfMinReplicas, targetNumberOfMinReplicas, desiredState.MinChangeRatio)
+			if err := updateRecentTargets(ctx, kubeClient, hpa, initiator, desiredState); err != nil {
+				return processingResult{"failed", getFailedReason(err)}, err
+			}
+			return processingResult{"skipped", reasonBelowMinChange}, nil
+		}
+
+		if isUpdateDebounced(hpa, *minUpdateInterval, time.Now()) {
+			// don't update hpa, it was updated too recently
+			log.Debug().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because it was updated less than %v ago, minReplicas would have changed from %v to %v", initiator, hpa.Name, hpa.Namespace, *minUpdateInterval, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+			return processingResult{"skipped", reasonDebounced}, nil
+		}
+
+		hpaKey := hpa.Namespace + "/" + hpa.Name
+		if backingOff, retryIn := updateBackoffs.BackingOff(hpaKey, time.Now()); backingOff {
+			// don't update hpa, its last updates failed and would most likely fail again
+			log.Debug().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because its last updates failed, retrying in %v, minReplicas would have changed from %v to %v", initiator, hpa.Name, hpa.Namespace, retryIn, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+			return processingResult{"skipped", reasonBackoff}, nil
+		}
+
+		if initiator == "poller" && changePlan != nil && !changePlan.allow(hpa, targetNumberOfMinReplicas-currentNumberOfMinReplicas) {
+			// don't update hpa yet, it's applied at the end of the iteration if it's among the largest changes
+			return processingResult{"skipped", reasonDeferred}, nil
+		}
+
+		// throttle updates to avoid hitting the api server's limits
+		if err := waitForUpdateRateLimiter(ctx); err != nil {
+			log.Error().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Waiting for update rate limiter failed", initiator, hpa.Name, hpa.Namespace)
+			return processingResult{"failed", reasonUpdateFailed}, &UpdateError{Err: err}
+		}
+
+		// update hpa
+		log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Updating hpa because minReplicas has changed from %v to %v...", initiator, hpa.Name, hpa.Namespace, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+
+		// serialize state and store it in the annotation; a next scale down needs as many low readings again
+		desiredState.ConsecutiveLowReadings = 0
+		desiredState.LastUpdated = time.Now().Format(time.RFC3339)
+		desiredState.MinReplicas = &targetNumberOfMinReplicas
+		hpaScalerStateByteArray, err := json.Marshal(desiredState)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return processingResult{"failed", reasonUpdateFailed}, &UpdateError{Err: err}
+		}
+		hpa.Annotations[annotations.State] = string(hpaScalerStateByteArray)
+		if *writeComputedAnnotations {
+			// only written along with minReplicas, to avoid an update on every poll
+			hpa.Annotations[annotations.LastRequestRate] = strconv.FormatFloat(requestRate, 'f', -1, 64)
+			hpa.Annotations[annotations.TargetMinReplicas] = strconv.FormatInt(int64(targetNumberOfMinReplicas), 10)
+		}
+		hpa.Spec.MinReplicas = &targetNumberOfMinReplicas
+
+		if *hpa.Spec.MinReplicas >= hpa.Spec.MaxReplicas && desiredState.ManageMaxReplicas != "false" {
+			targetNumberOfMaxReplicas := *hpa.Spec.MinReplicas + int32(1)
+			hpa.Spec.MaxReplicas = targetNumberOfMaxReplicas
+		}
+
+		// never send an hpa kubernetes would reject, or that scales in unintended ways, because of a bug in the calculations above
+		if err := validateReplicas(hpa, minimumReplicasLowerBound); err != nil {
+			log.Error().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Not updating hpa because its replicas are invalid", initiator, hpa.Name, hpa.Namespace)
+			updateBackoffs.RecordFailure(hpaKey, time.Now())
+			return processingResult{"failed", reasonInvalidReplicas}, err
+		}
+
+		// update hpa, because the data and state annotation have changed
+		hpa, err = kubeClient.AutoscalingV1().HorizontalPodAutoscalers(hpa.Namespace).Update(ctx, hpa, metav1.UpdateOptions{})
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			updateBackoffs.RecordFailure(hpaKey, time.Now())
+			return processingResult{"failed", reasonUpdateFailed}, &UpdateError{Err: err}
+		}
+		updateBackoffs.RecordSuccess(hpaKey)
+
+		decisionWebhook.Notify(ctx, DecisionWebhookPayload{
+			HPA:            hpa.Name,
+			Namespace:      hpa.Namespace,
+			OldMinReplicas: currentNumberOfMinReplicas,
+			NewMinReplicas: targetNumberOfMinReplicas,
+			RequestRate:    requestRate,
+			Timestamp:      desiredState.LastUpdated,
+		})
+
+		log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Updated hpa successfully...", initiator, hpa.Name, hpa.Namespace)
+
+		return processingResult{"succeeded", updatedReason}, nil
+	}
+
+	return processingResult{"skipped", reasonNotEnabled}, nil
+}
+
+// Sets the time since the last change from the state annotation, or removes it for hpas that haven't been changed yet
+func setSecondsSinceLastChange(hpa *autoscalingv1.HorizontalPodAutoscaler, now time.Time) {
+	lastChange, ok := getLastChange(hpa)
+	if !ok {
+		secondsSinceLastChangeVector.DeleteLabelValues(hpa.Name, hpa.Namespace)
+		return
+	}
+
+	secondsSinceLastChangeVector.WithLabelValues(hpa.Name, hpa.Namespace).Set(now.Sub(lastChange).Seconds())
+}
+
+// Returns the exponentially smoothed replica count, starting from the current replicas if there's no previous value; it's rounded to 2 decimals so it settles instead of changing the state on every poll
+func getSmoothedReplicas(previous float64, currentReplicas int32, factor float64) float64 {
+	if previous <= 0 {
+		return float64(currentReplicas)
+	}
+
+	smoothed := factor*float64(currentReplicas) + (1-factor)*previous
+
+	return math.Round(smoothed*100) / 100
+}
+
+// Adds the target to the most recent targets, keeping at most windowSize of them, and returns their max or median along with the updated targets
+func getWindowedTarget(recentTargets []int32, target int32, windowSize int, mode string) (windowedTarget int32, updatedTargets []int32) {
+	updatedTargets = append(append([]int32{}, recentTargets...), target)
+	if len(updatedTargets) > windowSize {
+		updatedTargets = updatedTargets[len(updatedTargets)-windowSize:]
+	}
+
+	sortedTargets := append([]int32{}, updatedTargets...)
+	sort.Slice(sortedTargets, func(i, j int) bool { return sortedTargets[i] < sortedTargets[j] })
+
+	if mode == targetWindowModeMedian {
+		// for an even number of targets take the upper of the middle two, to err on the safe side
+		return sortedTargets[len(sortedTargets)/2], updatedTargets
+	}
+
+	return sortedTargets[len(sortedTargets)-1], updatedTargets
+}
+
+// Adds the request rate to the most recent request rates, keeping at most windowSize of them, and returns their max along with the updated rates
+func getWindowedRequestRate(recentRequestRates []float64, requestRate float64, windowSize int) (windowedRequestRate float64, updatedRequestRates []float64) {
+	updatedRequestRates = append(append([]float64{}, recentRequestRates...), requestRate)
+	if len(updatedRequestRates) > windowSize {
+		updatedRequestRates = updatedRequestRates[len(updatedRequestRates)-windowSize:]
+	}
+
+	for _, rate := range updatedRequestRates {
+		windowedRequestRate = math.Max(windowedRequestRate, rate)
+	}
+
+	return windowedRequestRate, updatedRequestRates
+}
+
+// Stores the recent targets and request rates in the state annotation when minReplicas itself isn't updated, so the windows keep moving
+func updateRecentTargets(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, initiator string, desiredState HPAScalerState) error {
+	if desiredState.TargetWindowSize <= 1 && desiredState.RequestRateWindowSize <= 1 && desiredState.ScaleDownStabilizationPolls <= 1 && desiredState.WarmupGraceSeconds <= 0 && desiredState.SmoothedReplicas <= 0 && desiredState.MaxRateDropRatio <= 0 {
+		return nil
+	}
+
+	lastState, _ := getLastState(hpa)
+	if reflect.DeepEqual(lastState.RecentTargets, desiredState.RecentTargets) && reflect.DeepEqual(lastState.RecentRequestRates, desiredState.RecentRequestRates) && lastState.ConsecutiveLowReadings == desiredState.ConsecutiveLowReadings && lastState.LastRolloutSeen == desiredState.LastRolloutSeen && lastState.SmoothedReplicas == desiredState.SmoothedReplicas && (desiredState.MaxRateDropRatio <= 0 || lastState.LastRequestRate == desiredState.LastRequestRate) {
+		return nil
+	}
+
+	return updateStateAnnotation(ctx, kubeClient, hpa, initiator, desiredState)
+}
+
+// Stores the desired state in the state annotation without changing minReplicas, keeping the details of the last change
+func updateStateAnnotation(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, initiator string, desiredState HPAScalerState) error {
+	lastState, _ := getLastState(hpa)
+
+	desiredState.LastUpdated = lastState.LastUpdated
+	desiredState.MinReplicas = lastState.MinReplicas
+	hpaScalerStateByteArray, err := json.Marshal(desiredState)
+	if err != nil {
+		return &UpdateError{Err: err}
+	}
+
+	if err := waitForUpdateRateLimiter(ctx); err != nil {
+		log.Error().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Waiting for update rate limiter failed", initiator, hpa.Name, hpa.Namespace)
+		return &UpdateError{Err: err}
+	}
+
+	hpa.Annotations[annotations.State] = string(hpaScalerStateByteArray)
+	_, err = kubeClient.AutoscalingV1().HorizontalPodAutoscalers(hpa.Namespace).Update(ctx, hpa, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Updating state annotation failed", initiator, hpa.Name, hpa.Namespace)
+		return &UpdateError{Err: err}
+	}
+
+	return nil
+}
+
+// Removes the state annotation and the computed annotations written by the controller, so they don't linger on an hpa it no longer manages
+func removeStateAnnotations(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, initiator string) error {
+	stateAnnotations := []string{annotations.State, annotations.LastRequestRate, annotations.TargetMinReplicas}
+
+	present := false
+	for _, annotation := range stateAnnotations {
+		if _, ok := hpa.Annotations[annotation]; ok {
+			present = true
+		}
+	}
+	if !present {
+		return nil
+	}
+
+	if err := waitForUpdateRateLimiter(ctx); err != nil {
+		log.Error().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Waiting for update rate limiter failed", initiator, hpa.Name, hpa.Namespace)
+		return &UpdateError{Err: err}
+	}
+
+	log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Removing state annotation because hpa is disabled...", initiator, hpa.Name, hpa.Namespace)
+	for _, annotation := range stateAnnotations {
+		delete(hpa.Annotations, annotation)
+	}
+	_, err := kubeClient.AutoscalingV1().HorizontalPodAutoscalers(hpa.Namespace).Update(ctx, hpa, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error().Err(err).Msgf("[%v] HorizontalPodAutosclaler %v.%v - Removing state annotation failed", initiator, hpa.Name, hpa.Namespace)
+		return &UpdateError{Err: err}
+	}
+
+	return nil
+}
+
+// Returns whether minReplicas was last updated less than the minimum update interval ago, according to the state annotation
+func isUpdateDebounced(hpa *autoscalingv1.HorizontalPodAutoscaler, minUpdateInterval time.Duration, now time.Time) bool {
+	if minUpdateInterval <= 0 {
+		return false
+	}
+
+	lastChange, ok := getLastChange(hpa)
+	if !ok {
+		return false
+	}
+
+	return now.Sub(lastChange) < minUpdateInterval
+}
+
+// Returns whether the request rate dropped by more than the max rate drop ratio since the rate stored in the state annotation
+func isRequestRateDropSuspicious(hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState, requestRate float64) bool {
+	if desiredState.MaxRateDropRatio <= 0 {
+		return false
+	}
+
+	lastState, ok := getLastState(hpa)
+	if !ok || lastState.LastRequestRate <= 0 {
+		return false
+	}
+
+	return requestRate < lastState.LastRequestRate*(1-desiredState.MaxRateDropRatio)
+}
+
+// Removes the metric series of the hpas processed in the previous poll iteration but not in this one, because they were deleted or moved to another shard
+func deleteMetricsOfUnprocessedHorizontalPodAutoscalers(processed map[namespacedName]bool) {
+	for key := range processedHorizontalPodAutoscalers {
+		if !processed[key] {
+			deleteHorizontalPodAutoscalerMetrics(key.name, key.namespace)
+		}
+	}
+
+	processedHorizontalPodAutoscalers = processed
+}
+
+// Removes the series of the per hpa gauges and counters, so hpas that are no longer scaled don't keep reporting stale values
+func deleteHorizontalPodAutoscalerMetrics(name, namespace string) {
+	minReplicasVector.DeleteLabelValues(name, namespace)
+	actualReplicasVector.DeleteLabelValues(name, namespace)
+	requestRateVector.DeleteLabelValues(name, namespace)
+	secondsSinceLastChangeVector.DeleteLabelValues(name, namespace)
+	maxMinReplicasCappedTotals.DeleteLabelValues(name, namespace)
+	invalidStateTotals.DeleteLabelValues(name, namespace)
+	hpaInfos.Delete(name, namespace)
+}
+
+// Returns whether minReplicas differs from the value last written by this application and that manual edit should still be respected
+func isManualEditRespected(hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState, now time.Time) bool {
+	if desiredState.RespectManualEditsSeconds <= 0 {
+		return false
+	}
+
+	key := hpa.Namespace + "/" + hpa.Name
+
+	lastState, ok := getLastState(hpa)
+	if !ok || lastState.MinReplicas == nil || *lastState.MinReplicas == *hpa.Spec.MinReplicas {
+		manualEdits.Forget(key)
+		return false
+	}
+
+	detectedAt := manualEdits.Detect(key, now)
+
+	return now.Sub(detectedAt) < time.Duration(desiredState.RespectManualEditsSeconds)*time.Second
+}
+
+// Returns the state last written to the state annotation, if present and valid
+func getLastState(hpa *autoscalingv1.HorizontalPodAutoscaler) (state HPAScalerState, ok bool) {
+	stateString, ok := hpa.Annotations[annotations.State]
+	if !ok {
+		return state, false
+	}
+
+	state, err := parseHPAScalerState(stateString)
+	if err != nil {
+		// a manually edited or corrupted state shouldn't block processing, so it's treated as if there's no state yet
+		log.Warn().Err(err).Msgf("State annotation of hpa %v in namespace %v is invalid, ignoring it", hpa.Name, hpa.Namespace)
+		invalidStateTotals.WithLabelValues(hpa.Name, hpa.Namespace).Inc()
+		return HPAScalerState{}, false
+	}
+
+	return state, true
+}
+
+// Unmarshals the state annotation and validates the fields read back from it; fields missing from older or partial states keep their zero value
+func parseHPAScalerState(stateString string) (state HPAScalerState, err error) {
+	if err = json.Unmarshal([]byte(stateString), &state); err != nil {
+		return HPAScalerState{}, err
+	}
+
+	if state.LastUpdated != "" {
+		if _, err = time.Parse(time.RFC3339, state.LastUpdated); err != nil {
+			return HPAScalerState{}, fmt.Errorf("Field lastUpdated has invalid value %v: %v", state.LastUpdated, err)
+		}
+	}
+
+	if state.MinReplicas != nil && *state.MinReplicas < 0 {
+		return HPAScalerState{}, fmt.Errorf("Field minReplicas has invalid value %v: should not be negative", *state.MinReplicas)
+	}
+
+	for _, target := range state.RecentTargets {
+		if target < 0 {
+			return HPAScalerState{}, fmt.Errorf("Field recentTargets has invalid value %v: should not contain negative targets", state.RecentTargets)
+		}
+	}
+
+	for _, requestRate := range state.RecentRequestRates {
+		if requestRate < 0 {
+			return HPAScalerState{}, fmt.Errorf("Field recentRequestRates has invalid value %v: should not contain negative rates", state.RecentRequestRates)
+		}
+	}
+
+	if state.LastRequestRate < 0 {
+		return HPAScalerState{}, fmt.Errorf("Field lastRequestRate has invalid value %v: should not be negative", state.LastRequestRate)
+	}
+
+	if state.LastRolloutSeen != "" {
+		if _, err = time.Parse(time.RFC3339, state.LastRolloutSeen); err != nil {
+			return HPAScalerState{}, fmt.Errorf("Field lastRolloutSeen has invalid value %v: %v", state.LastRolloutSeen, err)
+		}
+	}
+
+	if state.ConsecutiveLowReadings < 0 {
+		return HPAScalerState{}, fmt.Errorf("Field consecutiveLowReadings has invalid value %v: should not be negative", state.ConsecutiveLowReadings)
+	}
+
+	if state.SmoothedReplicas < 0 {
+		return HPAScalerState{}, fmt.Errorf("Field smoothedReplicas has invalid value %v: should not be negative", state.SmoothedReplicas)
+	}
+
+	return state, nil
+}
+
+// Returns when minReplicas was last changed according to the state annotation, if present and valid
+func getLastChange(hpa *autoscalingv1.HorizontalPodAutoscaler) (lastChange time.Time, ok bool) {
+	state, ok := getLastState(hpa)
+	if !ok {
+		return lastChange, false
+	}
+
+	lastChange, err := time.Parse(time.RFC3339, state.LastUpdated)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Parsing last updated time %v of hpa %v in namespace %v failed", state.LastUpdated, hpa.Name, hpa.Namespace)
+		return lastChange, false
+	}
+
+	return lastChange, true
+}
+
+// Returns the hard minimum pod count, which is 0 for hpas that opted in to scaling to zero if the cluster supports it;
+// otherwise the lower bound of the hpa, of its namespace, the global one from the environment or 3, whichever is set first
+func getMinimumReplicasLowerBound(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, replicaSets *replicaSetsHolder, desiredState HPAScalerState) int32 {
+	if desiredState.ScaleToZero == "true" {
+		if *scaleToZeroEnabled {
+			return 0
+		}
+		log.Warn().Msgf("Hpa %v in namespace %v wants to scale to zero, but it's not enabled for this controller; set --scale-to-zero-enabled once the HPAScaleToZero feature gate is enabled in the cluster", hpa.Name, hpa.Namespace)
+	}
+
+	// the hpa's own lower bound overrides the global one
+	if desiredState.MinimumReplicasLowerBound > 0 {
+		return desiredState.MinimumReplicasLowerBound
+	}
+
+	// the namespace's lower bound overrides the global one for all its hpas
+	if namespaceLowerBound := getNamespaceMinimumReplicasLowerBound(ctx, kubeClient, hpa.Namespace, replicaSets); namespaceLowerBound > 0 {
+		return namespaceLowerBound
+	}
+
+	return getGlobalMinimumReplicasLowerBound()
+}
+
+// Returns the lower bound from the MINIMUM_REPLICAS_LOWER_BOUND envvar, or 3 if it isn't set or invalid
+func getGlobalMinimumReplicasLowerBound() int32 {
+	minimumReplicasLowerBoundString := os.Getenv("MINIMUM_REPLICAS_LOWER_BOUND")
+	minimumReplicasLowerBound := int32(3)
+	if i, err := strconv.ParseInt(minimumReplicasLowerBoundString, 0, 32); err == nil {
+		minimumReplicasLowerBound = int32(i)
+	}
+
+	return minimumReplicasLowerBound
+}
+
+// Returns the lower bound from the annotation on the namespace, or 0 if the namespace has none or can't be retrieved; it's retrieved once per namespace per iteration
+func getNamespaceMinimumReplicasLowerBound(ctx context.Context, kubeClient kubernetes.Interface, namespaceName string, replicaSets *replicaSetsHolder) int32 {
+	if lowerBound, ok := replicaSets.namespaceLowerBounds[namespaceName]; ok {
+		return lowerBound
+	}
+
+	lowerBound := int32(0)
+	namespace, err := kubeClient.CoreV1().Namespaces().Get(ctx, namespaceName, metav1.GetOptions{})
+	if err != nil {
+		log.Warn().Err(err).Msgf("Retrieving namespace %v failed, ignoring its minimum replicas lower bound", namespaceName)
+	} else if lowerBoundString, ok := namespace.Annotations[annotations.MinimumReplicasLowerBound]; ok {
+		i, err := strconv.ParseInt(lowerBoundString, 0, 32)
+		if err == nil && i >= 1 {
+			lowerBound = int32(i)
+		} else {
+			log.Warn().Msgf("Namespace %v has invalid value %v for annotation %v, it should be at least 1; ignoring it", namespaceName, lowerBoundString, annotations.MinimumReplicasLowerBound)
+		}
+	}
+
+	if replicaSets.namespaceLowerBounds == nil {
+		replicaSets.namespaceLowerBounds = map[string]int32{}
+	}
+	replicaSets.namespaceLowerBounds[namespaceName] = lowerBound
+
+	return lowerBound
+}
+
+// Returns what the minimum pod count should be based on the Prometheus query specified
+// If the Prometheus query is not specified, it returns 0
+func getMinPodCountBasedOnPrometheusQuery(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) (minPodCount int32, requestRate float64, err error) {
+	minPodCount = 0
+	requestRate = 0
+
+	if (len(desiredState.PrometheusQuery) > 0 || len(desiredState.HTTPMetricsURL) > 0 || len(desiredState.CloudMonitoringQuery) > 0) && (desiredState.RequestsPerReplica > 0 || len(desiredState.RequestsPerReplicaQuery) > 0) {
+		// fill in the placeholders, so for example the lookback can be tuned without rewriting the query
+		desiredState.PrometheusQuery, err = renderPrometheusQuery(desiredState.PrometheusQuery, desiredState.QueryWindow)
+		if err != nil {
+			log.Error().Err(err).Msgf("Rendering prometheus query for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+			return 0, 0, &QueryError{Err: err}
 		}
 
-		if !deploymentInProgress {
-			minPodCountBasedOnCurrentPodCount = getMinPodCountBasedOnCurrentPodCount(kubeClient, hpa, desiredState)
+		// get request rate with prometheus query, or from the http metrics endpoint or cloud monitoring for those not running prometheus
+		var requestRates []float64
+		if len(desiredState.HTTPMetricsURL) > 0 {
+			requestRates, err = getRequestRatesFromHTTPMetricsEndpoint(ctx, hpa, desiredState)
+		} else if len(desiredState.CloudMonitoringQuery) > 0 {
+			requestRates, err = getRequestRatesFromCloudMonitoring(ctx, hpa, desiredState)
+		} else if desiredState.PrometheusQueryMode == prometheusQueryModeCounter {
+			requestRates, err = getCounterRates(ctx, hpa, desiredState, time.Now())
+		} else if len(desiredState.PrometheusServerURLs) > 0 {
+			requestRates, err = getRequestRatesFromPrometheusServers(ctx, hpa, desiredState)
+		} else {
+			var queryResponse PrometheusQueryResponse
+			queryResponse, err = executePrometheusQueryWithFallback(ctx, hpa, desiredState, desiredState.PrometheusQuery, desiredState.PrometheusQueryRangeSeconds, desiredState.PrometheusQueryStepSeconds)
+			if err != nil {
+				return 0, 0, &QueryError{Err: err}
+			}
+			requestRates, err = queryResponse.GetValues()
+		}
+		if err != nil {
+			log.Error().Err(err).Msgf("Retrieving request rate from query response body for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+			return 0, 0, &QueryError{Err: err}
 		}
 
-		log.Debug().
-			Float64("requestRate", requestRate).
-			Int32("minPodCountBasedOnPrometheusQuery", minPodCountBasedOnPrometheusQuery).
-			Int32("minPodCountBasedOnCurrentPodCount", minPodCountBasedOnCurrentPodCount).
-			Float64("desiredState.RequestsPerReplica", desiredState.RequestsPerReplica).
-			Float64("desiredState.Delta", desiredState.Delta).
-			Float64("desiredState.ScaleDownMaxRatio", desiredState.ScaleDownMaxRatio).
-			Float64("requestRate/desiredState.RequestsPerReplica", requestRate/desiredState.RequestsPerReplica).
-			Float64("desiredState.Delta + requestRate/desiredState.RequestsPerReplica", desiredState.Delta+requestRate/desiredState.RequestsPerReplica).
-			Float64("math.Ceil(desiredState.Delta + requestRate/desiredState.RequestsPerReplica)", math.Ceil(desiredState.Delta+requestRate/desiredState.RequestsPerReplica)).
-			Int32("int32(math.Ceil(desiredState.Delta + requestRate/desiredState.RequestsPerReplica))", int32(math.Ceil(desiredState.Delta+requestRate/desiredState.RequestsPerReplica))).
-			Int32("int32(math.Floor(float64(*hpa.Status.CurrentReplicas) * desiredState.ScaleDownMaxRatio))", int32(math.Floor(float64(hpa.Status.CurrentReplicas)*desiredState.ScaleDownMaxRatio))).
-			Msgf("Calculated values for hpa %v in namespace %v", hpa.Name, hpa.Namespace)
+		if desiredState.TargetLatency > 0 {
+			// the query returns a latency instead of a rate, for which the slowest series counts
+			latency := requestRates[0]
+			for _, rate := range requestRates {
+				latency = math.Max(latency, rate)
+			}
+			return getMinPodCountBasedOnLatency(hpa.Status.CurrentReplicas, latency, desiredState), latency, nil
+		}
 
-		// We pick the larger minimum of the two.
-		targetNumberOfMinReplicas := minPodCountBasedOnPrometheusQuery
-		if minPodCountBasedOnCurrentPodCount > targetNumberOfMinReplicas {
-			targetNumberOfMinReplicas = minPodCountBasedOnCurrentPodCount
+		// normalize the rates to per second, the unit of requests per replica; a gauge, like the number of active sessions, is used as is
+		if desiredState.RateUnit == rateUnitPerMinute && desiredState.PrometheusQueryMode != prometheusQueryModeGauge {
+			for i := range requestRates {
+				requestRates[i] /= 60
+			}
 		}
 
-		// We only override the minimum pod count if we don't go below the hard-coded minimum.
-		if targetNumberOfMinReplicas < minimumReplicasLowerBound {
-			targetNumberOfMinReplicas = minimumReplicasLowerBound
+		requestsPerReplica, err := getRequestsPerReplica(ctx, hpa, desiredState)
+		if err != nil {
+			return 0, 0, err
 		}
 
-		currentNumberOfMinReplicas := *hpa.Spec.MinReplicas
-		actualNumberOfReplicas := hpa.Status.CurrentReplicas
+		// a multiplier for a safety margin on top of the calculated replicas
+		safetyFactor := desiredState.SafetyFactor
+		if safetyFactor <= 0 {
+			safetyFactor = 1
+		}
 
-		// set prometheus gauge values
-		minReplicasVector.WithLabelValues(hpa.Name, hpa.Namespace).Set(float64(targetNumberOfMinReplicas))
-		actualReplicasVector.WithLabelValues(hpa.Name, hpa.Namespace).Set(float64(actualNumberOfReplicas))
-		requestRateVector.WithLabelValues(hpa.Name, hpa.Namespace).Set(requestRate)
+		// calculate target # of replicas
+		switch desiredState.PrometheusQueryAggregation {
+		case queryAggregationSum:
+			for _, rate := range requestRates {
+				requestRate += rate
+			}
+			minPodCount = int32(math.Ceil(desiredState.Delta + getReplicasForRequestRate(requestRate, requestsPerReplica, safetyFactor, desiredState.DeltaRatio)))
+
+		case queryAggregationPerSeriesCeilSum:
+			// each series gets its own rounded up number of replicas, for example one per region
+			replicas := 0.0
+			for _, rate := range requestRates {
+				requestRate += rate
+				replicas += math.Ceil(getReplicasForRequestRate(rate, requestsPerReplica, safetyFactor, desiredState.DeltaRatio))
+			}
+			minPodCount = int32(math.Ceil(desiredState.Delta + replicas))
 
-		if targetNumberOfMinReplicas == currentNumberOfMinReplicas {
-			// don't update hpa
-			return "skipped", nil
+		default:
+			requestRate = requestRates[0]
+			minPodCount = int32(math.Ceil(desiredState.Delta + getReplicasForRequestRate(requestRate, requestsPerReplica, safetyFactor, desiredState.DeltaRatio)))
 		}
 
-		// update hpa
-		log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Updating hpa because minReplicas has changed from %v to %v...", initiator, hpa.Name, hpa.Namespace, currentNumberOfMinReplicas, targetNumberOfMinReplicas)
+		// hold the target at the highest request rate of the recent polls, so it only decays once a dip is sustained
+		if desiredState.RequestRateWindowSize > 1 {
+			lastState, _ := getLastState(hpa)
+			windowedRequestRate, _ := getWindowedRequestRate(lastState.RecentRequestRates, requestRate, desiredState.RequestRateWindowSize)
+			if windowedMinPodCount := int32(math.Ceil(desiredState.Delta + getReplicasForRequestRate(windowedRequestRate, requestsPerReplica, safetyFactor, desiredState.DeltaRatio))); windowedMinPodCount > minPodCount {
+				minPodCount = windowedMinPodCount
+			}
+		}
+	}
 
-		// serialize state and store it in the annotation
-		desiredState.LastUpdated = time.Now().Format(time.RFC3339)
-		hpaScalerStateByteArray, err := json.Marshal(desiredState)
+	// hpas sized by their requests in flight get enough replicas for those as well, whichever needs more
+	if len(desiredState.ConcurrencyQuery) > 0 {
+		concurrencyMinPodCount, concurrency, err := getMinPodCountBasedOnConcurrency(ctx, hpa, desiredState)
 		if err != nil {
-			log.Error().Err(err).Msg("")
-			return status, err
+			return 0, 0, err
 		}
-		hpa.Annotations[annotationHPAScalerState] = string(hpaScalerStateByteArray)
-		hpa.Spec.MinReplicas = &targetNumberOfMinReplicas
 
-		if *hpa.Spec.MinReplicas >= hpa.Spec.MaxReplicas {
-			targetNumberOfMaxReplicas := *hpa.Spec.MinReplicas + int32(1)
-			hpa.Spec.MaxReplicas = targetNumberOfMaxReplicas
+		log.Debug().Msgf("Concurrency of %v for hpa %v in namespace %v needs %v replicas, the request rate needs %v", concurrency, hpa.Name, hpa.Namespace, concurrencyMinPodCount, minPodCount)
+		if concurrencyMinPodCount > minPodCount {
+			minPodCount = concurrencyMinPodCount
 		}
+	}
 
-		// update hpa, because the data and state annotation have changed
-		hpa, err = kubeClient.AutoscalingV1().HorizontalPodAutoscalers(hpa.Namespace).Update(hpa)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			return status, err
-		}
+	return minPodCount, requestRate, nil
+}
 
-		status = "succeeded"
+// Returns the unrounded replicas needed for the request rate, multiplied by the safety factor and with the headroom of the delta ratio on top
+func getReplicasForRequestRate(requestRate, requestsPerReplica, safetyFactor, deltaRatio float64) float64 {
+	replicas := safetyFactor * requestRate / requestsPerReplica
 
-		log.Info().Msgf("[%v] HorizontalPodAutosclaler %v.%v - Updated hpa successfully...", initiator, hpa.Name, hpa.Namespace)
+	// the headroom is added rather than multiplying by 1 + deltaRatio, so 10% on top of 10 replicas is exactly 11 instead of slightly more
+	return replicas + replicas*deltaRatio
+}
+
+// Returns the pod count proportionally adjusting the current pod count to the relative distance of the latency from the target latency, amplified by the gain
+func getMinPodCountBasedOnLatency(currentReplicas int32, latency float64, desiredState HPAScalerState) int32 {
+	relativeError := (latency - desiredState.TargetLatency) / desiredState.TargetLatency
+
+	podCount := math.Ceil(desiredState.Delta + float64(currentReplicas)*(1+desiredState.LatencyGain*relativeError))
+	if podCount < 0 {
+		return 0
+	}
+
+	return int32(podCount)
+}
+
+// Returns the per second rate of each series of the counter query, from the increase between two point queries an interval apart
+func getCounterRates(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState, now time.Time) ([]float64, error) {
+	interval := time.Duration(desiredState.PrometheusCounterIntervalSeconds) * time.Second
+
+	earlierQueryResponse, err := executePrometheusQueryURLWithFallback(ctx, hpa, desiredState, func(prometheusServerURL string) string {
+		return getPrometheusPointQueryURL(prometheusServerURL, desiredState.PrometheusQuery, now.Add(-interval))
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		return status, nil
+	laterQueryResponse, err := executePrometheusQueryURLWithFallback(ctx, hpa, desiredState, func(prometheusServerURL string) string {
+		return getPrometheusPointQueryURL(prometheusServerURL, desiredState.PrometheusQuery, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return laterQueryResponse.GetCounterRates(earlierQueryResponse, interval.Seconds())
+}
+
+// Returns the requests per replica from the Prometheus query specified, falling back to the static value if the query isn't specified or fails.
+// The static value is validated when parsing the annotations, so only a query without result and nothing to fall back to returns an error.
+func getRequestsPerReplica(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) (float64, error) {
+	if len(desiredState.RequestsPerReplicaQuery) == 0 {
+		return desiredState.RequestsPerReplica, nil
+	}
+
+	queryResponse, err := executePrometheusQueryWithFallback(ctx, hpa, desiredState, desiredState.RequestsPerReplicaQuery, 0, 0)
+	if err == nil {
+		var requestsPerReplica float64
+		requestsPerReplica, err = queryResponse.GetValue()
+		if err == nil && requestsPerReplica > 0 {
+			return requestsPerReplica, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("Requests per replica %v should be larger than 0", requestsPerReplica)
+		}
 	}
 
-	status = "skipped"
+	// dividing by a static value of 0 would result in an infinite number of replicas
+	if desiredState.RequestsPerReplica <= 0 {
+		log.Error().Err(err).Msgf("Retrieving requests per replica for hpa %v in namespace %v failed, without static requests per replica to fall back to", hpa.Name, hpa.Namespace)
+		return 0, &QueryError{Err: err}
+	}
 
-	return status, nil
+	log.Warn().Err(err).Msgf("Retrieving requests per replica for hpa %v in namespace %v failed, falling back to static requests per replica %v", hpa.Name, hpa.Namespace, desiredState.RequestsPerReplica)
+	return desiredState.RequestsPerReplica, nil
 }
 
-// Returns what the minimum pod count should be based on the Prometheus query specified
-// If the Prometheus query is not specified, it returns 0
-func getMinPodCountBasedOnPrometheusQuery(kubeClient *kubernetes.Clientset, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) (minPodCount int32, requestRate float64, err error) {
-	minPodCount = 0
-	requestRate = 0
+// Returns the minReplicas from the override query, if it's set and has a result; a failing query or one without result doesn't override anything
+func getOverrideMinReplicas(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) (minReplicas int32, ok bool) {
+	if len(desiredState.OverrideMinReplicasQuery) == 0 {
+		return 0, false
+	}
 
-	if len(desiredState.PrometheusQuery) > 0 && desiredState.RequestsPerReplica > 0 {
-		// get request rate with prometheus query
+	queryResponse, err := executePrometheusQueryWithFallback(ctx, hpa, desiredState, desiredState.OverrideMinReplicasQuery, 0, 0)
+	if err != nil {
+		log.Warn().Err(err).Msgf("Executing override min replicas query for hpa %v in namespace %v failed, not overriding", hpa.Name, hpa.Namespace)
+		return 0, false
+	}
+
+	if len(queryResponse.Data.Result) == 0 {
+		// the override isn't active, for example outside the scheduled event
+		return 0, false
+	}
+
+	value, err := queryResponse.GetValue()
+	if err != nil || math.IsNaN(value) || value < 0 || value > math.MaxInt32 {
+		log.Warn().Err(err).Msgf("Override min replicas query for hpa %v in namespace %v returned invalid value %v, not overriding", hpa.Name, hpa.Namespace, value)
+		return 0, false
+	}
+
+	return int32(math.Ceil(value)), true
+}
+
+// Returns the url for an instant query, or for a range query over the last rangeSeconds if that's larger than zero
+func getPrometheusQueryURL(prometheusServerURL, prometheusQuery string, rangeSeconds, stepSeconds int, now time.Time) string {
+	if rangeSeconds <= 0 {
 		// http://prometheus.production.svc/api/v1/query?query=sum%28rate%28nginx_http_requests_total%7Bhost%21~%22%5E%28%3F%3A%5B0-9.%5D%2B%29%24%22%2Clocation%3D%22%40searchfareapi_gcloud%22%7D%5B10m%5D%29%29%20by%20%28location%29
-		prometheusQueryURL := fmt.Sprintf("%v/api/v1/query?query=%v", desiredState.PrometheusServerURL, url.QueryEscape(desiredState.PrometheusQuery))
-		resp, err := pester.Get(prometheusQueryURL)
-		if err != nil {
-			log.Error().Err(err).Msgf("Executing prometheus query for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
-			return 0, 0, err
+		return fmt.Sprintf("%v/api/v1/query?query=%v", prometheusServerURL, url.QueryEscape(prometheusQuery))
+	}
+
+	stepSeconds = getPrometheusQueryStepSeconds(rangeSeconds, stepSeconds)
+
+	// align the end of the range to the step, so identical range queries within the same step share the url and thus the cached response
+	end := now.Unix() - now.Unix()%int64(stepSeconds)
+	start := end - int64(rangeSeconds)
+
+	return fmt.Sprintf("%v/api/v1/query_range?query=%v&start=%v&end=%v&step=%v", prometheusServerURL, url.QueryEscape(prometheusQuery), start, end, stepSeconds)
+}
+
+// Returns an error if the server url can't be parsed or lacks a scheme or host
+func validateServerURL(serverURL string) error {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return errors.New("should be an absolute url with scheme and host, like http://prometheus.monitoring.svc")
+	}
+
+	return nil
+}
+
+// Returns the url the Prometheus api paths are appended to, the server url followed by the path prefix if any
+func getPrometheusBaseURL(prometheusServerURL, pathPrefix string) string {
+	pathPrefix = strings.Trim(pathPrefix, "/")
+	if pathPrefix == "" {
+		return prometheusServerURL
+	}
+
+	return strings.TrimSuffix(prometheusServerURL, "/") + "/" + pathPrefix
+}
+
+// Returns the url for an instant query evaluated at the specified time
+func getPrometheusPointQueryURL(prometheusServerURL, prometheusQuery string, at time.Time) string {
+	return fmt.Sprintf("%v/api/v1/query?query=%v&time=%v", prometheusServerURL, url.QueryEscape(prometheusQuery), at.Unix())
+}
+
+// Returns the step if it divides the range into a reasonable number of points, otherwise a tenth of the range
+func getPrometheusQueryStepSeconds(rangeSeconds, stepSeconds int) int {
+	defaultStepSeconds := rangeSeconds / 10
+	if defaultStepSeconds < 1 {
+		defaultStepSeconds = 1
+	}
+
+	if stepSeconds <= 0 {
+		return defaultStepSeconds
+	}
+
+	// prometheus refuses range queries with more than 11000 points
+	if stepSeconds > rangeSeconds || rangeSeconds/stepSeconds > 11000 {
+		log.Warn().Msgf("Query step of %v seconds doesn't fit a range of %v seconds, using step of %v seconds instead", stepSeconds, rangeSeconds, defaultStepSeconds)
+		return defaultStepSeconds
+	}
+
+	return stepSeconds
+}
+
+// Executes the Prometheus query against the primary Prometheus server, falling back to the secondary server if that fails
+func executePrometheusQueryWithFallback(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState, prometheusQuery string, rangeSeconds, stepSeconds int) (queryResponse PrometheusQueryResponse, err error) {
+	return executePrometheusQueryURLWithFallback(ctx, hpa, desiredState, func(prometheusServerURL string) string {
+		return getPrometheusQueryURL(prometheusServerURL, prometheusQuery, rangeSeconds, stepSeconds, time.Now())
+	})
+}
+
+// Executes the Prometheus query url returned for the primary Prometheus server, falling back to the url for the secondary server if that fails
+func executePrometheusQueryURLWithFallback(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState, getQueryURL func(prometheusServerURL string) string) (queryResponse PrometheusQueryResponse, err error) {
+	prometheusServerURLs := []string{desiredState.PrometheusServerURL}
+	if desiredState.PrometheusSecondaryServerURL != "" && desiredState.PrometheusSecondaryServerURL != desiredState.PrometheusServerURL {
+		prometheusServerURLs = append(prometheusServerURLs, desiredState.PrometheusSecondaryServerURL)
+	}
+
+	for i, prometheusServerURL := range prometheusServerURLs {
+		prometheusQueryURL := getQueryURL(getPrometheusBaseURL(prometheusServerURL, desiredState.PrometheusPathPrefix))
+		queryResponse, err = executePrometheusQuery(ctx, hpa, prometheusServerURL, prometheusQueryURL)
+		if err == nil {
+			prometheusQueryServerTotals.WithLabelValues(prometheusServerURL).Inc()
+			return queryResponse, nil
+		}
+
+		if i < len(prometheusServerURLs)-1 {
+			log.Warn().Err(err).Msgf("Querying prometheus server %v for hpa %v in namespace %v failed, falling back to prometheus server %v", prometheusServerURL, hpa.Name, hpa.Namespace, prometheusServerURLs[i+1])
 		}
+	}
 
-		defer resp.Body.Close()
+	return queryResponse, err
+}
 
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Error().Err(err).Msgf("Reading prometheus query response body for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
-			return 0, 0, err
+// Executes the Prometheus query url against the Prometheus server and unmarshals the response
+func executePrometheusQuery(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, prometheusServerURL, prometheusQueryURL string) (queryResponse PrometheusQueryResponse, err error) {
+	if queryResponse, ok := queryCache.Get(prometheusServerURL, prometheusQueryURL); ok {
+		return queryResponse, nil
+	}
+
+	if !prometheusCircuitBreaker.Allow(prometheusServerURL) {
+		return queryResponse, fmt.Errorf("Circuit breaker for prometheus server %v is open, skipping query for hpa %v in namespace %v", prometheusServerURL, hpa.Name, hpa.Namespace)
+	}
+
+	backoff := *prometheusQueryRetryBackoff
+	for attempt := 0; ; attempt++ {
+		queryResponse, err = getPrometheusQueryResponse(ctx, hpa, prometheusQueryURL)
+		if err == nil {
+			break
 		}
 
-		queryResponse, err := UnmarshalPrometheusQueryResponse(body)
-		if err != nil {
-			log.Error().Err(err).Msgf("Unmarshalling prometheus query response body for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
-			return 0, 0, err
+		// a shutdown or poll timeout says nothing about the health of the server, so it doesn't count towards opening the breaker
+		if ctx.Err() != nil {
+			prometheusCircuitBreaker.Abandon(prometheusServerURL)
+			return queryResponse, err
+		}
+
+		if attempt >= *prometheusQueryRetries {
+			prometheusCircuitBreaker.RecordFailure(prometheusServerURL)
+			return queryResponse, err
+		}
+
+		log.Warn().Err(err).Msgf("Prometheus query for hpa %v in namespace %v failed, retrying in %v...", hpa.Name, hpa.Namespace, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
 		}
+		backoff *= 2
+	}
+
+	prometheusCircuitBreaker.RecordSuccess(prometheusServerURL)
+	queryCache.Set(prometheusServerURL, prometheusQueryURL, queryResponse)
+
+	return queryResponse, nil
+}
+
+// Gets the Prometheus query url, and reads and unmarshals the response as a single attempt
+func getPrometheusQueryResponse(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, prometheusQueryURL string) (queryResponse PrometheusQueryResponse, err error) {
+	req, err := http.NewRequest("GET", prometheusQueryURL, nil)
+	if err != nil {
+		return queryResponse, err
+	}
+	req.Header.Set("User-Agent", getUserAgent(*prometheusUserAgent))
 
-		requestRate, err = queryResponse.GetRequestRate()
+	if prometheusBearerToken != nil {
+		token, err := prometheusBearerToken.get(time.Now())
 		if err != nil {
-			log.Error().Err(err).Msgf("Retrieving request rate from query response body for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
-			return 0, 0, err
+			log.Error().Err(err).Msgf("Reading bearer token for prometheus query for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+			return queryResponse, err
 		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
-		// calculate target # of replicas
-		minPodCount = int32(math.Ceil(desiredState.Delta + requestRate/desiredState.RequestsPerReplica))
+	resp, err := prometheusHTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Error().Err(err).Msgf("Executing prometheus query for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+		return queryResponse, err
 	}
 
-	return minPodCount, requestRate, nil
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error().Err(err).Msgf("Reading prometheus query response body for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+		return queryResponse, err
+	}
+
+	queryResponse, err = UnmarshalPrometheusQueryResponse(body)
+	if err != nil {
+		log.Error().Err(err).Msgf("Unmarshalling prometheus query response body for hpa %v in namespace %v failed", hpa.Name, hpa.Namespace)
+		return queryResponse, err
+	}
+
+	return queryResponse, nil
+}
+
+// Returns the User-Agent header identifying the requests of this application in access logs, unless it's overridden
+func getUserAgent(override string) string {
+	if override != "" {
+		return override
+	}
+
+	name := app
+	if name == "" {
+		name = "estafette-k8s-hpa-scaler"
+	}
+	if version == "" {
+		return name
+	}
+
+	return fmt.Sprintf("%v/%v", name, version)
 }
 
 // Returns what the minimum pod count should be based on the current pod count and the maximum scale down ratio
-func getMinPodCountBasedOnCurrentPodCount(kubeClient *kubernetes.Clientset, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) (podCount int32) {
+func getMinPodCountBasedOnCurrentPodCount(kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) (podCount int32) {
 	actualNumberOfReplicas := hpa.Status.CurrentReplicas
 
+	// Without replicas there's nothing to scale down from, so a cold start ramps up from the configured floor instead.
+	if actualNumberOfReplicas <= 0 {
+		return desiredState.ColdStartMinReplicas
+	}
+
+	// With smoothing enabled we scale down from the smoothed replicas instead of the instantaneous count.
+	if desiredState.SmoothedReplicas > 0 {
+		actualNumberOfReplicas = int32(math.Round(desiredState.SmoothedReplicas))
+	}
+
 	// We use Floor() because we want to opt on the side of scaling down slower.
 	maxScaleDown := int32(math.Floor(float64(actualNumberOfReplicas) * desiredState.ScaleDownMaxRatio))
 
 	// If the (number of replicas) * (scale down max ratio) is zero, that would completely prevent scaling down, which we don't want.
 	if maxScaleDown == 0 {
-		return actualNumberOfReplicas - 1
+		maxScaleDown = 1
+	}
+
+	podCount = actualNumberOfReplicas - maxScaleDown
+
+	// A ratio of 1 or more would otherwise result in a negative pod count.
+	if podCount < 0 {
+		return 0
 	}
 
-	return actualNumberOfReplicas - maxScaleDown
+	return podCount
 }
 
-// Returns whether the application associated with the HPA is being deployed right now. (We consider an application being deployed if it has more than one non empty replicasets.)
-func isDeploymentInProgress(kubeClient *kubernetes.Clientset, hpa *autoscalingv1.HorizontalPodAutoscaler, replicaSets *replicaSetsHolder) bool {
-	app := hpa.Labels["app"]
+// Returns the value rounded up to the nearest multiple; a multiple of 1 or less leaves the value as is.
+func roundUpToMultiple(value, multiple int32) int32 {
+	if multiple <= 1 || value <= 0 || value%multiple == 0 {
+		return value
+	}
+
+	return (value/multiple + 1) * multiple
+}
+
+// Returns the scale down ratio allowed by a per minute ratio, compounded over the minutes since minReplicas was last updated; without a last update a single minute is assumed.
+func getScaleDownMaxRatioSinceLastUpdate(hpa *autoscalingv1.HorizontalPodAutoscaler, ratioPerMinute float64, now time.Time) float64 {
+	if ratioPerMinute >= 1 {
+		return ratioPerMinute
+	}
+
+	lastState, ok := getLastState(hpa)
+	if !ok || lastState.LastUpdated == "" {
+		return ratioPerMinute
+	}
+
+	lastUpdated, err := time.Parse(time.RFC3339, lastState.LastUpdated)
+	if err != nil || !now.After(lastUpdated) {
+		return ratioPerMinute
+	}
+
+	// the fraction of replicas that remains after scaling down by the ratio each minute
+	remaining := math.Pow(1-ratioPerMinute, now.Sub(lastUpdated).Minutes())
+
+	return 1 - remaining
+}
+
+// Returns whether the application associated with the HPA is being deployed right now. By default we consider an application being deployed if it has more than one non empty replicasets,
+// the annotations of the hpa can select another predicate or threshold.
+func isDeploymentInProgress(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, replicaSets *replicaSetsHolder, desiredState HPAScalerState) bool {
+	predicateName := desiredState.DeploymentInProgressPredicate
+	if predicateName == "" {
+		predicateName = deploymentInProgressPredicateReplicaSets
+	}
+	predicate, ok := deploymentInProgressPredicates[predicateName]
+	if !ok {
+		log.Warn().Msgf("Hpa %v in namespace %v has unknown deployment in progress predicate %v, using %v", hpa.Name, hpa.Namespace, predicateName, deploymentInProgressPredicateReplicaSets)
+		predicateName = deploymentInProgressPredicateReplicaSets
+		predicate = deploymentInProgressPredicates[predicateName]
+	}
+
+	// hpas of the same app only share the result if they use the same predicate
+	target := fmt.Sprintf("%v/%v/%v", getDeploymentCheckingTarget(hpa), predicateName, desiredState.DeploymentInProgressReplicaSets)
+	if inProgress, ok := replicaSets.deploymentsInProgress[target]; ok {
+		return inProgress
+	}
 
 	if replicaSets.replicaSetList == nil {
-		replicaSets.replicaSetList = getReplicaSets(kubeClient)
+		replicaSets.replicaSetList = getReplicaSets(ctx, kubeClient)
 	}
 
 	var replicaSetsForApp []*appsv1.ReplicaSet
+	var deployment *appsv1.Deployment
+	if *deploymentCheckingMode == deploymentCheckingModeOwnerReference || *deploymentCheckingMode == deploymentCheckingModeRevision {
+		deployment = getScaleTargetDeployment(ctx, kubeClient, hpa)
+		if deployment != nil {
+			replicaSetsForApp = getReplicaSetsOwnedByDeployment(deployment, replicaSets.replicaSetList)
+		}
+	} else {
+		replicaSetsForApp = getReplicaSetsWithAppLabel(hpa, replicaSets.replicaSetList)
+		if predicateName == deploymentInProgressPredicateReadyReplicas {
+			// the replica sets are matched by label, but the ready replicas are only known by the deployment
+			deployment = getScaleTargetDeployment(ctx, kubeClient, hpa)
+		}
+	}
+
+	inProgress := predicate(replicaSetsForApp, deployment, desiredState)
+
+	if replicaSets.deploymentsInProgress == nil {
+		replicaSets.deploymentsInProgress = map[string]bool{}
+	}
+	replicaSets.deploymentsInProgress[target] = inProgress
+
+	return inProgress
+}
+
+// Returns the key of the app whose replica sets are checked for the HPA, so HPAs resolving to the same app share the result.
+func getDeploymentCheckingTarget(hpa *autoscalingv1.HorizontalPodAutoscaler) string {
+	if *deploymentCheckingMode == deploymentCheckingModeOwnerReference || *deploymentCheckingMode == deploymentCheckingModeRevision {
+		return fmt.Sprintf("%v/%v/%v", hpa.Namespace, hpa.Spec.ScaleTargetRef.Kind, hpa.Spec.ScaleTargetRef.Name)
+	}
+
+	// the replica sets are matched on their app label across all namespaces
+	return "app=" + hpa.Labels["app"]
+}
+
+// Returns the replica sets sharing the "app" label with the HPA.
+func getReplicaSetsWithAppLabel(hpa *autoscalingv1.HorizontalPodAutoscaler, replicaSetList *appsv1.ReplicaSetList) (replicaSetsForApp []*appsv1.ReplicaSet) {
+	app := hpa.Labels["app"]
 
-	for _, rs := range replicaSets.replicaSetList.Items {
-		if rs.Labels["app"] == app {
-			replicaSetsForApp = append(replicaSetsForApp, &rs)
+	for i := range replicaSetList.Items {
+		if replicaSetList.Items[i].Labels["app"] == app {
+			replicaSetsForApp = append(replicaSetsForApp, &replicaSetList.Items[i])
 		}
 	}
 
-	nonEmptyReplicaSetCount := 0
+	return replicaSetsForApp
+}
+
+// Returns the Deployment targeted by the scaleTargetRef of the HPA, or nil if it targets something else or can't be retrieved.
+func getScaleTargetDeployment(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler) *appsv1.Deployment {
+	if hpa.Spec.ScaleTargetRef.Kind != "Deployment" {
+		log.Warn().Msgf("Hpa %v in namespace %v targets a %v instead of a Deployment, can't check whether a deployment is in progress", hpa.Name, hpa.Namespace, hpa.Spec.ScaleTargetRef.Kind)
+		return nil
+	}
+
+	deployment, err := kubeClient.AppsV1().Deployments(hpa.Namespace).Get(ctx, hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
+	if err != nil {
+		log.Error().Err(err).Msgf("Retrieving deployment %v targeted by hpa %v in namespace %v failed", hpa.Spec.ScaleTargetRef.Name, hpa.Name, hpa.Namespace)
+		return nil
+	}
+
+	return deployment
+}
 
-	for _, rs := range replicaSetsForApp {
-		if rs.Status.Replicas > 0 {
-			nonEmptyReplicaSetCount++
+// Returns the replica sets with an ownerReference to the Deployment.
+func getReplicaSetsOwnedByDeployment(deployment *appsv1.Deployment, replicaSetList *appsv1.ReplicaSetList) (replicaSetsForApp []*appsv1.ReplicaSet) {
+	for i := range replicaSetList.Items {
+		for _, ownerReference := range replicaSetList.Items[i].OwnerReferences {
+			if ownerReference.UID == deployment.UID {
+				replicaSetsForApp = append(replicaSetsForApp, &replicaSetList.Items[i])
+				break
+			}
 		}
 	}
 
-	return nonEmptyReplicaSetCount > 1
+	return replicaSetsForApp
 }
 
-// Retrieves all the replica sets present in the cluster.
-func getReplicaSets(kubeClient *kubernetes.Clientset) *appsv1.ReplicaSetList {
+// Retrieves all the replica sets present in the cluster, from the informer cache if it's enabled.
+func getReplicaSets(ctx context.Context, kubeClient kubernetes.Interface) *appsv1.ReplicaSetList {
+	if sharedInformerCache != nil {
+		replicaSets, err := sharedInformerCache.listReplicaSets()
+		if err == nil {
+			return replicaSets
+		}
+		log.Error().Err(err).Msg("Could not list the replicasets from the cache, listing them from the cluster instead.")
+	}
+
 	log.Info().Msg("Listing replicasets for all namespaces...")
-	replicaSets, err := kubeClient.AppsV1().ReplicaSets("").List(metav1.ListOptions{})
+	replicaSets, err := kubeClient.AppsV1().ReplicaSets("").List(ctx, metav1.ListOptions{})
 
 	if err != nil {
 		log.Error().Err(err).Msg("Could not list the replicasets in the cluster.")
@@ -450,8 +2627,52 @@ func getReplicaSets(kubeClient *kubernetes.Clientset) *appsv1.ReplicaSetList {
 	return replicaSets
 }
 
+// Returns an error if the replicas of the HPA don't satisfy 0 < minReplicas <= maxReplicas; minReplicas can only be 0 if the lower bound allows scaling to zero.
+func validateReplicas(hpa *autoscalingv1.HorizontalPodAutoscaler, minimumReplicasLowerBound int32) error {
+	if hpa.Spec.MinReplicas == nil {
+		return fmt.Errorf("Hpa %v in namespace %v has no minReplicas", hpa.Name, hpa.Namespace)
+	}
+
+	minReplicas := *hpa.Spec.MinReplicas
+	if minReplicas < 0 || (minReplicas == 0 && minimumReplicasLowerBound > 0) {
+		return fmt.Errorf("Hpa %v in namespace %v has invalid minReplicas %v: should be larger than 0", hpa.Name, hpa.Namespace, minReplicas)
+	}
+
+	if minReplicas > hpa.Spec.MaxReplicas {
+		return fmt.Errorf("Hpa %v in namespace %v has minReplicas %v larger than maxReplicas %v", hpa.Name, hpa.Namespace, minReplicas, hpa.Spec.MaxReplicas)
+	}
+
+	return nil
+}
+
+// Blocks until the rate limiter allows another update to the kubernetes api, returning an error if the context is cancelled before that
+func waitForUpdateRateLimiter(ctx context.Context) error {
+	if updateRateLimiter == nil {
+		return nil
+	}
+
+	return updateRateLimiter.Wait(ctx)
+}
+
+// Sets the global level from which log messages and higher are outputted.
+func setLogLevel(level string) error {
+	zerologLevel, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	zerolog.SetGlobalLevel(zerologLevel)
+
+	return nil
+}
+
 func applyJitter(input int) (output int) {
-	deviation := int(0.25 * float64(input))
+	deviation := getJitterDeviation(input)
 
 	return input - deviation + r.Intn(2*deviation)
 }
+
+// Returns how much the jitter can deviate from the input either way
+func getJitterDeviation(input int) int {
+	return int(0.25 * float64(input))
+}
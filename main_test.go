@@ -0,0 +1,3643 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func newTestHorizontalPodAutoscaler(minReplicas, maxReplicas, currentReplicas int32) *autoscalingv1.HorizontalPodAutoscaler {
+	return &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-app",
+			Namespace:   "my-namespace",
+			Annotations: map[string]string{},
+		},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			MinReplicas: &minReplicas,
+			MaxReplicas: maxReplicas,
+		},
+		Status: autoscalingv1.HorizontalPodAutoscalerStatus{
+			CurrentReplicas: currentReplicas,
+		},
+	}
+}
+
+// newTestPrometheusServer serves the value for each known query and an empty result for any other query
+func newTestPrometheusServer(values map[string]string) *httptest.Server {
+	// avoid responses cached for an earlier test server listening on the same port
+	queryCache.Clear()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := values[r.URL.Query().Get("query")]
+		if !ok {
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1513161148.757,"%v"]}]}}`, value)
+	}))
+}
+
+// newTestPrometheusServerWithSeries serves a result series per value for each known query
+func newTestPrometheusServerWithSeries(values map[string][]string) *httptest.Server {
+	// avoid responses cached for an earlier test server listening on the same port
+	queryCache.Clear()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		series := []string{}
+		for i, value := range values[r.URL.Query().Get("query")] {
+			series = append(series, fmt.Sprintf(`{"metric":{"region":"region-%v"},"value":[1513161148.757,"%v"]}`, i, value))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%v]}}`, strings.Join(series, ","))
+	}))
+}
+
+func newTestReplicaSet(name string, labels map[string]string, ownerUID types.UID, replicas int32) appsv1.ReplicaSet {
+	replicaSet := appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "my-namespace",
+			Labels:    labels,
+		},
+		Status: appsv1.ReplicaSetStatus{
+			Replicas: replicas,
+		},
+	}
+	if ownerUID != "" {
+		replicaSet.OwnerReferences = []metav1.OwnerReference{{Kind: "Deployment", Name: "my-app", UID: ownerUID}}
+	}
+
+	return replicaSet
+}
+
+func newTestReplicaSetWithRevision(name string, ownerUID types.UID, revision string, replicas int32) appsv1.ReplicaSet {
+	replicaSet := newTestReplicaSet(name, nil, ownerUID, replicas)
+	replicaSet.Annotations = map[string]string{"deployment.kubernetes.io/revision": revision}
+
+	return replicaSet
+}
+
+func newTestNamespace(annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "my-namespace",
+			Annotations: annotations,
+		},
+	}
+}
+
+func countUpdateActions(kubeClient *fake.Clientset) (count int) {
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "update" {
+			count++
+		}
+	}
+	return
+}
+
+func countListReplicaSetsActions(kubeClient *fake.Clientset) (count int) {
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "replicasets" {
+			count++
+		}
+	}
+	return
+}
+
+func TestGetDesiredHorizontalPodAutoscalerState(t *testing.T) {
+	t.Run("DefaultsRateUnitToPerSecond", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+
+		// act
+		state := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, rateUnitPerSecond, state.RateUnit)
+	})
+
+	t.Run("UsesValidPrometheusServerURLFromAnnotation", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-prometheus-server-url": "http://prometheus-eu.monitoring.svc:9090"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, "http://prometheus-eu.monitoring.svc:9090", state.PrometheusServerURL)
+	})
+
+	t.Run("FallsBackToDefaultPrometheusServerURLForURLWithoutScheme", func(t *testing.T) {
+
+		*prometheusServerURL = "http://prometheus.monitoring.svc"
+		defer func() { *prometheusServerURL = "" }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-prometheus-server-url": "prometheus-eu.monitoring.svc:9090"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 1, len(errs))
+		assert.Equal(t, "http://prometheus.monitoring.svc", state.PrometheusServerURL)
+	})
+
+	t.Run("FallsBackToDefaultPrometheusServerURLForURLWithoutHost", func(t *testing.T) {
+
+		*prometheusServerURL = "http://prometheus.monitoring.svc"
+		defer func() { *prometheusServerURL = "" }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-prometheus-server-url": "http://"}
+
+		// act
+		state := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, "http://prometheus.monitoring.svc", state.PrometheusServerURL)
+	})
+
+	t.Run("FallsBackToDefaultPrometheusServerURLForUnparseableURL", func(t *testing.T) {
+
+		*prometheusServerURL = "http://prometheus.monitoring.svc"
+		defer func() { *prometheusServerURL = "" }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-prometheus-server-url": "http://prometheus.monitoring.svc:port"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 1, len(errs))
+		assert.Equal(t, "http://prometheus.monitoring.svc", state.PrometheusServerURL)
+	})
+
+	t.Run("AcceptsGaugeQueryMode", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-prometheus-query-mode": "gauge"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, prometheusQueryModeGauge, state.PrometheusQueryMode)
+	})
+
+	t.Run("ReturnsErrorForUnknownRateUnit", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-rate-unit": "per-hour"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 1, len(errs))
+		assert.Equal(t, rateUnitPerSecond, state.RateUnit)
+	})
+
+	t.Run("DefaultsDeploymentInProgressToMoreThanOneReplicaSet", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+
+		// act
+		state := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, deploymentInProgressPredicateReplicaSets, state.DeploymentInProgressPredicate)
+		assert.Equal(t, 1, state.DeploymentInProgressReplicaSets)
+	})
+
+	t.Run("ReturnsErrorsForUnknownDeploymentInProgressPredicateAndInvalidThreshold", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-deployment-in-progress-predicate": "pods", "estafette.io/hpa-scaler-deployment-in-progress-replica-sets": "0"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 2, len(errs))
+		assert.Equal(t, deploymentInProgressPredicateReplicaSets, state.DeploymentInProgressPredicate)
+		assert.Equal(t, 1, state.DeploymentInProgressReplicaSets)
+	})
+
+	t.Run("ParsesDeltaRatio", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-delta-ratio": "0.1"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 0, len(errs))
+		assert.Equal(t, 0.1, state.DeltaRatio)
+	})
+
+	t.Run("ReturnsErrorForNegativeDeltaRatio", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-delta-ratio": "-0.1"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 1, len(errs))
+		assert.Equal(t, float64(0), state.DeltaRatio)
+	})
+
+	t.Run("DefaultsQueryWindowToTenMinutes", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+
+		// act
+		state := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, "10m", state.QueryWindow)
+	})
+
+	t.Run("ReturnsErrorForInvalidQueryWindow", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-query-window": "5 minutes"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 1, len(errs))
+		assert.Equal(t, "10m", state.QueryWindow)
+	})
+
+	t.Run("DropsConcurrencyQueryWithoutValidConcurrencyPerReplica", func(t *testing.T) {
+
+		for _, value := range []string{"", "0", "-1", "NaN", "Inf", "many"} {
+			hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+			hpa.Annotations["estafette.io/hpa-scaler-concurrency-query"] = "in_flight"
+			if value != "" {
+				hpa.Annotations["estafette.io/hpa-scaler-concurrency-per-replica"] = value
+			}
+
+			// act
+			state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+			assert.Equal(t, 1, len(errs), value)
+			assert.Equal(t, "", state.ConcurrencyQuery, value)
+		}
+	})
+
+	t.Run("KeepsConcurrencyQueryWithValidConcurrencyPerReplica", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-concurrency-query"] = "in_flight"
+		hpa.Annotations["estafette.io/hpa-scaler-concurrency-per-replica"] = "2.5"
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Empty(t, errs)
+		assert.Equal(t, "in_flight", state.ConcurrencyQuery)
+		assert.Equal(t, 2.5, state.ConcurrencyPerReplica)
+	})
+
+	t.Run("ResolvesRequestsPerReplicaRecordingRuleWithQuery", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-requests-per-replica"] = "rule:service:requests_per_replica:capacity"
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Empty(t, errs)
+		assert.Equal(t, float64(0), state.RequestsPerReplica)
+		assert.Equal(t, "service:requests_per_replica:capacity", state.RequestsPerReplicaQuery)
+	})
+
+	t.Run("PrefersExplicitRequestsPerReplicaQueryOverRecordingRule", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-requests-per-replica"] = "rule:service:requests_per_replica:capacity"
+		hpa.Annotations["estafette.io/hpa-scaler-requests-per-replica-query"] = "max(capacity)"
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Empty(t, errs)
+		assert.Equal(t, "max(capacity)", state.RequestsPerReplicaQuery)
+	})
+
+	t.Run("UsesLiteralRequestsPerReplicaWithoutQuery", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-requests-per-replica"] = "2.5"
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Empty(t, errs)
+		assert.Equal(t, 2.5, state.RequestsPerReplica)
+		assert.Equal(t, "", state.RequestsPerReplicaQuery)
+	})
+
+	t.Run("ReturnsErrorForRequestsPerReplicaThatIsNeitherNumberNorMarkedRecordingRule", func(t *testing.T) {
+
+		for _, value := range []string{"lots", "service:requests_per_replica:capacity", "rule:", "NaN", "Inf", "-2"} {
+			hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+			hpa.Annotations["estafette.io/hpa-scaler-requests-per-replica"] = value
+
+			// act
+			state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+			assert.Equal(t, 1, len(errs), value)
+			assert.Equal(t, float64(1), state.RequestsPerReplica, value)
+			assert.Equal(t, "", state.RequestsPerReplicaQuery, value)
+		}
+	})
+
+	t.Run("ReturnsErrorForRequestsPerReplicaThatIsNeitherNumberNorMetricName", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-requests-per-replica"] = "2.5 per second"
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 1, len(errs))
+		assert.Equal(t, float64(1), state.RequestsPerReplica)
+		assert.Equal(t, "", state.RequestsPerReplicaQuery)
+	})
+}
+
+func TestMakeHorizontalPodAutoscalerChanges(t *testing.T) {
+	t.Run("UpdatesMinReplicasIfChanged", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, Paused: "false"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, reasonUpdated, result.Reason)
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("DoesNotUpdateIfMinReplicasIsUnchanged", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(8, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonNoChange, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+
+	t.Run("ReturnsQueryFailedIfPrometheusQueryFails", func(t *testing.T) {
+
+		failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "not json")
+		}))
+		defer failingServer.Close()
+		queryCache.Clear()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, PrometheusServerURL: failingServer.URL, PrometheusQuery: "requests", RequestsPerReplica: 20}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.NotNil(t, err)
+		var queryError *QueryError
+		assert.True(t, errors.As(err, &queryError))
+		assert.Equal(t, "failed", result.Status)
+		assert.Equal(t, reasonQueryFailed, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+
+	t.Run("ReturnsUpdateErrorIfUpdatingHPAFails", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		kubeClient.PrependReactor("update", "horizontalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("conflict")
+		})
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.NotNil(t, err)
+		var updateError *UpdateError
+		assert.True(t, errors.As(err, &updateError))
+		assert.Equal(t, "failed", result.Status)
+		assert.Equal(t, reasonUpdateFailed, result.Reason)
+	})
+
+	t.Run("BacksOffAfterUpdatingHPAFails", func(t *testing.T) {
+
+		updateBackoffs = newUpdateBackoffTracker(time.Minute, 30*time.Minute)
+		defer func() { updateBackoffs = nil }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		kubeClient.PrependReactor("update", "horizontalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("invalid")
+		})
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+		_, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa.DeepCopy(), &replicaSetsHolder{}, "test", desiredState)
+		assert.NotNil(t, err)
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa.DeepCopy(), &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonBackoff, result.Reason)
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+	})
+
+	t.Run("DoesNotUpdateIfPaused", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, Paused: "true"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "paused", result.Status)
+		assert.Equal(t, reasonPaused, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(3), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("DoesNotScaleDownIfRatchetingUpOnly", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(12, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, RatchetUpOnly: "true"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonRatchet, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(12), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ScalesUpIfRatchetingUpOnly", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, RatchetUpOnly: "true"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ScalesDownOnlyAfterThreeConsecutiveLowReadings", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(12, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, ScaleDownStabilizationPolls: 3}
+
+		// act
+		results := []processingResult{}
+		for i := 0; i < 3; i++ {
+			result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+			assert.Nil(t, err)
+			results = append(results, result)
+		}
+
+		assert.Equal(t, processingResult{"skipped", reasonStabilizing}, results[0])
+		assert.Equal(t, processingResult{"skipped", reasonStabilizing}, results[1])
+		assert.Equal(t, processingResult{"succeeded", reasonUpdated}, results[2])
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+		lastState, _ := getLastState(hpa)
+		assert.Equal(t, 0, lastState.ConsecutiveLowReadings)
+	})
+
+	t.Run("ResetsConsecutiveLowReadingsIfTargetIsNotLower", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(8, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"consecutiveLowReadings":2}`}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, ScaleDownStabilizationPolls: 3}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, reasonNoChange, result.Reason)
+		lastState, _ := getLastState(hpa)
+		assert.Equal(t, 0, lastState.ConsecutiveLowReadings)
+	})
+
+	t.Run("ScalesUpWithoutWaitingForStabilization", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, ScaleDownStabilizationPolls: 3}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ScalesDownFromSmoothedReplicasAfterSurge", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(16, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"smoothedReplicas":20}`}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, ReplicasSmoothingFactor: 0.5}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(12), *hpa.Spec.MinReplicas)
+		lastState, _ := getLastState(hpa)
+		assert.Equal(t, float64(15), lastState.SmoothedReplicas)
+	})
+
+	t.Run("DoesNotScaleDownDuringWarmupAfterRollout", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(12, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"lastRolloutSeen":"` + time.Now().Add(-time.Minute).Format(time.RFC3339) + `"}`}
+		replicaSet := newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 10)
+		kubeClient := fake.NewSimpleClientset(hpa, &replicaSet)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, WarmupGraceSeconds: 300}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonWarmup, result.Reason)
+		assert.Equal(t, int32(12), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("StoresRolloutInProgressAndDoesNotScaleDown", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(12, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		oldReplicaSet := newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 5)
+		newReplicaSet := newTestReplicaSet("my-app-2", map[string]string{"app": "my-app"}, "", 5)
+		kubeClient := fake.NewSimpleClientset(hpa, &oldReplicaSet, &newReplicaSet)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, WarmupGraceSeconds: 300}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, reasonWarmup, result.Reason)
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		lastState, _ := getLastState(hpa)
+		assert.NotEqual(t, "", lastState.LastRolloutSeen)
+	})
+
+	t.Run("ScalesDownAfterWarmup", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(12, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"lastRolloutSeen":"` + time.Now().Add(-10*time.Minute).Format(time.RFC3339) + `"}`}
+		replicaSet := newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 10)
+		kubeClient := fake.NewSimpleClientset(hpa, &replicaSet)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, WarmupGraceSeconds: 300}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("DoesNotUpdateDuringMaintenanceWindowButExportsMetrics", func(t *testing.T) {
+
+		sinceMidnight := time.Duration(time.Now().UTC().Hour()) * time.Hour
+		maintenanceWindows = []maintenanceWindow{{start: sinceMidnight, end: (sinceMidnight + 2*time.Hour) % (24 * time.Hour)}}
+		defer func() { maintenanceWindows = nil }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "maintenance", result.Status)
+		assert.Equal(t, reasonMaintenance, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(3), *hpa.Spec.MinReplicas)
+		assert.Equal(t, float64(8), testutil.ToFloat64(minReplicasVector.WithLabelValues(hpa.Name, hpa.Namespace)))
+	})
+
+	t.Run("UpdatesOutsideMaintenanceWindow", func(t *testing.T) {
+
+		sinceMidnight := time.Duration(time.Now().UTC().Hour()) * time.Hour
+		maintenanceWindows = []maintenanceWindow{{start: (sinceMidnight + 2*time.Hour) % (24 * time.Hour), end: (sinceMidnight + 4*time.Hour) % (24 * time.Hour)}}
+		defer func() { maintenanceWindows = nil }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("DoesNotUpdateIfChangeIsSmallerThanMinChange", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 12)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.1, MinChange: 2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonBelowMinChange, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(10), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("UpdatesIfChangeIsAtLeastMinChange", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 12)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.1, MinChange: 1}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(11), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("DoesNotUpdateIfChangeIsSmallerThanMinChangeRatio", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(100, 200, 104)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.01, MinChange: 1, MinChangeRatio: 0.05}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonBelowMinChange, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(100), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("UpdatesIfChangeIsAtLeastMinChangeRatio", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(100, 200, 106)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.01, MinChange: 1, MinChangeRatio: 0.05}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(105), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("DoesNotUpdateIfMinChangeRatioIsMetButMinChangeIsNot", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(100, 200, 106)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.01, MinChange: 10, MinChangeRatio: 0.05}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, int32(100), *hpa.Spec.MinReplicas)
+	})
+}
+
+func TestRunReconcileIteration(t *testing.T) {
+	t.Run("ReturnsStatusCountsAndRecordsHeartbeat", func(t *testing.T) {
+
+		recordHeartbeat(time.Now().Add(-time.Hour))
+		firstHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		firstHPA.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		secondHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		secondHPA.Name = "my-other-app"
+		kubeClient := fake.NewSimpleClientset(firstHPA, secondHPA)
+
+		// act
+		result := runReconcileIteration(context.Background(), kubeClient, &sync.WaitGroup{})
+
+		assert.Nil(t, result.err)
+		assert.Equal(t, 2, result.hpaCount)
+		assert.Equal(t, 1, result.statusCounts["succeeded"])
+		assert.Equal(t, 1, result.statusCounts["skipped"])
+		assert.True(t, getHeartbeatAge(time.Now()) < time.Minute)
+	})
+
+	t.Run("ReturnsErrorIfListingFails", func(t *testing.T) {
+
+		kubeClient := fake.NewSimpleClientset()
+		kubeClient.PrependReactor("list", "horizontalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("api server unavailable")
+		})
+
+		// act
+		result := runReconcileIteration(context.Background(), kubeClient, &sync.WaitGroup{})
+
+		assert.NotNil(t, result.err)
+		assert.Equal(t, 0, result.hpaCount)
+	})
+
+	t.Run("ReturnsCountsOfPagesProcessedBeforeListingFails", func(t *testing.T) {
+
+		*listPageSize = 1
+		defer func() { *listPageSize = 0 }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "false"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		listCalls := 0
+		kubeClient.PrependReactor("list", "horizontalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			listCalls++
+			if listCalls == 1 {
+				return true, &autoscalingv1.HorizontalPodAutoscalerList{ListMeta: metav1.ListMeta{Continue: "page-2"}, Items: []autoscalingv1.HorizontalPodAutoscaler{*hpa}}, nil
+			}
+			return true, nil, errors.New("api server unavailable")
+		})
+
+		// act
+		result := runReconcileIteration(context.Background(), kubeClient, &sync.WaitGroup{})
+
+		assert.NotNil(t, result.err)
+		assert.Equal(t, 1, result.hpaCount)
+		assert.Equal(t, 1, result.statusCounts["disabled"])
+	})
+}
+
+func TestListHorizontalPodAutoscalers(t *testing.T) {
+	t.Run("RetriesUntilListSucceeds", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		failures := 2
+		kubeClient.PrependReactor("list", "horizontalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if failures > 0 {
+				failures--
+				return true, nil, errors.New("api server unavailable")
+			}
+			return false, nil, nil
+		})
+		listErrorsBefore := testutil.ToFloat64(listErrorTotals)
+
+		// act
+		hpas, err := listHorizontalPodAutoscalers(context.Background(), kubeClient, metav1.ListOptions{}, 3, time.Millisecond)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(hpas.Items))
+		assert.Equal(t, float64(2), testutil.ToFloat64(listErrorTotals)-listErrorsBefore)
+	})
+
+	t.Run("ReturnsErrorIfRetriesAreExhausted", func(t *testing.T) {
+
+		kubeClient := fake.NewSimpleClientset()
+		kubeClient.PrependReactor("list", "horizontalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("api server unavailable")
+		})
+		listErrorsBefore := testutil.ToFloat64(listErrorTotals)
+
+		// act
+		_, err := listHorizontalPodAutoscalers(context.Background(), kubeClient, metav1.ListOptions{}, 2, time.Millisecond)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, float64(3), testutil.ToFloat64(listErrorTotals)-listErrorsBefore)
+	})
+}
+
+func TestPollHorizontalPodAutoscalers(t *testing.T) {
+	t.Run("ProcessesAllPages", func(t *testing.T) {
+
+		*listPageSize = 1
+		defer func() { *listPageSize = 0 }()
+		firstHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		firstHPA.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		secondHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		secondHPA.Name = "my-other-app"
+		secondHPA.Annotations = map[string]string{"estafette.io/hpa-scaler": "false"}
+		kubeClient := fake.NewSimpleClientset(firstHPA, secondHPA)
+		listCalls := 0
+		kubeClient.PrependReactor("list", "horizontalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			listCalls++
+			if listCalls == 1 {
+				return true, &autoscalingv1.HorizontalPodAutoscalerList{ListMeta: metav1.ListMeta{Continue: "page-2"}, Items: []autoscalingv1.HorizontalPodAutoscaler{*firstHPA}}, nil
+			}
+			return true, &autoscalingv1.HorizontalPodAutoscalerList{Items: []autoscalingv1.HorizontalPodAutoscaler{*secondHPA}}, nil
+		})
+
+		// act
+		statusCounts, hpaCount, err := pollHorizontalPodAutoscalers(context.Background(), kubeClient, &sync.WaitGroup{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, hpaCount)
+		assert.Equal(t, 2, listCalls)
+		assert.Equal(t, 1, statusCounts["succeeded"])
+		assert.Equal(t, 1, statusCounts["disabled"])
+	})
+
+	t.Run("ProcessesOnlyDueHPAsWhenProcessingIsSpread", func(t *testing.T) {
+
+		hpaScheduler = newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		defer func() { hpaScheduler = nil }()
+		dueHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		dueHPA.Name = "due-app"
+		dueHPA.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		laterHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		laterHPA.Name = "later-app"
+		laterHPA.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		hpaScheduler.nextRuns[namespacedName{"my-namespace", "due-app"}] = time.Now().Add(-time.Second)
+		hpaScheduler.nextRuns[namespacedName{"my-namespace", "later-app"}] = time.Now().Add(time.Minute)
+		minReplicasVector.WithLabelValues("later-app", "my-namespace").Set(5)
+		kubeClient := fake.NewSimpleClientset(dueHPA, laterHPA)
+
+		// act
+		statusCounts, hpaCount, err := pollHorizontalPodAutoscalers(context.Background(), kubeClient, &sync.WaitGroup{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, hpaCount)
+		assert.Equal(t, 1, statusCounts["succeeded"])
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		assert.True(t, hpaScheduler.nextRuns[namespacedName{"my-namespace", "due-app"}].After(time.Now()))
+		// the metrics of the hpa that isn't due yet are kept
+		assert.True(t, minReplicasVector.DeleteLabelValues("later-app", "my-namespace"))
+		minReplicasVector.DeleteLabelValues("due-app", "my-namespace")
+	})
+
+	t.Run("ListsHPAsOncePerIntervalWhenProcessingIsSpread", func(t *testing.T) {
+
+		hpaScheduler = newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		defer func() { hpaScheduler = nil }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Name = "spread-app"
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		hpaScheduler.nextRuns[namespacedName{"my-namespace", "spread-app"}] = time.Now().Add(-time.Second)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		firstStatusCounts, _, err := pollHorizontalPodAutoscalers(context.Background(), kubeClient, &sync.WaitGroup{})
+		assert.Nil(t, err)
+		hpaScheduler.nextRuns[namespacedName{"my-namespace", "spread-app"}] = time.Now().Add(-time.Second)
+
+		// act
+		statusCounts, hpaCount, err := pollHorizontalPodAutoscalers(context.Background(), kubeClient, &sync.WaitGroup{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, firstStatusCounts["succeeded"])
+		assert.Equal(t, 1, hpaCount)
+		// the hpa is read again, so the minReplicas set in the first iteration isn't changed once more
+		assert.Equal(t, 1, statusCounts["skipped"])
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		listActions := 0
+		for _, action := range kubeClient.Actions() {
+			if action.GetVerb() == "list" && action.GetResource().Resource == "horizontalpodautoscalers" {
+				listActions++
+			}
+		}
+		assert.Equal(t, 1, listActions)
+		minReplicasVector.DeleteLabelValues("spread-app", "my-namespace")
+	})
+
+	t.Run("UpdatesOnlyHPAsWithLargestChangesIfChangesPerIterationAreLimited", func(t *testing.T) {
+
+		*maxChangesPerIteration = 2
+		defer func() { *maxChangesPerIteration = 0 }()
+		objects := []runtime.Object{}
+		for i, currentReplicas := range []int32{5, 20, 10, 15, 6} {
+			hpa := newTestHorizontalPodAutoscaler(3, 20, currentReplicas)
+			hpa.Name = fmt.Sprintf("app-%v", i)
+			hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+			objects = append(objects, hpa)
+		}
+		kubeClient := fake.NewSimpleClientset(objects...)
+
+		// act
+		statusCounts, hpaCount, err := pollHorizontalPodAutoscalers(context.Background(), kubeClient, &sync.WaitGroup{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 5, hpaCount)
+		assert.Equal(t, 2, statusCounts["succeeded"])
+		assert.Equal(t, 3, statusCounts["skipped"])
+		assert.Equal(t, 2, countUpdateActions(kubeClient))
+		updated := []string{}
+		for _, action := range kubeClient.Actions() {
+			if updateAction, ok := action.(k8stesting.UpdateAction); ok {
+				updated = append(updated, updateAction.GetObject().(*autoscalingv1.HorizontalPodAutoscaler).Name)
+			}
+		}
+		assert.ElementsMatch(t, []string{"app-1", "app-3"}, updated)
+		assert.Nil(t, changePlan)
+		for i := 0; i < 5; i++ {
+			minReplicasVector.DeleteLabelValues(fmt.Sprintf("app-%v", i), "my-namespace")
+		}
+	})
+
+	t.Run("DeletesMetricsOfRemovedHPAs", func(t *testing.T) {
+
+		firstHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		firstHPA.Name = "kept-app"
+		firstHPA.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		secondHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		secondHPA.Name = "removed-app"
+		secondHPA.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		kubeClient := fake.NewSimpleClientset(firstHPA, secondHPA)
+		_, _, err := pollHorizontalPodAutoscalers(context.Background(), kubeClient, &sync.WaitGroup{})
+		assert.Nil(t, err)
+		assert.Equal(t, float64(8), testutil.ToFloat64(minReplicasVector.WithLabelValues("removed-app", "my-namespace")))
+		infoLabels := hpaInfos.labels[namespacedName{namespace: "my-namespace", name: "removed-app"}]
+		assert.Equal(t, 4, len(infoLabels))
+		maxMinReplicasCappedTotals.WithLabelValues("removed-app", "my-namespace").Inc()
+		invalidStateTotals.WithLabelValues("removed-app", "my-namespace").Inc()
+		err = kubeClient.AutoscalingV1().HorizontalPodAutoscalers("my-namespace").Delete(context.Background(), "removed-app", metav1.DeleteOptions{})
+		assert.Nil(t, err)
+
+		// act
+		_, _, err = pollHorizontalPodAutoscalers(context.Background(), kubeClient, &sync.WaitGroup{})
+
+		assert.Nil(t, err)
+		// deleting returns false if the series no longer exists
+		assert.False(t, minReplicasVector.DeleteLabelValues("removed-app", "my-namespace"))
+		assert.False(t, actualReplicasVector.DeleteLabelValues("removed-app", "my-namespace"))
+		assert.False(t, requestRateVector.DeleteLabelValues("removed-app", "my-namespace"))
+		assert.False(t, hpaInfoVector.DeleteLabelValues(infoLabels...))
+		assert.False(t, maxMinReplicasCappedTotals.DeleteLabelValues("removed-app", "my-namespace"))
+		assert.False(t, invalidStateTotals.DeleteLabelValues("removed-app", "my-namespace"))
+		assert.True(t, minReplicasVector.DeleteLabelValues("kept-app", "my-namespace"))
+	})
+}
+
+func TestBuildInfoVector(t *testing.T) {
+	t.Run("IsSetToOneForBuildInformation", func(t *testing.T) {
+
+		// act
+		value := testutil.ToFloat64(buildInfoVector.WithLabelValues(version, branch, revision, goVersion))
+
+		assert.Equal(t, float64(1), value)
+	})
+}
+
+func TestProcessHorizontalPodAutoscaler(t *testing.T) {
+	t.Run("ReturnsDisabledIfScalerIsExplicitlyDisabled", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "false", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		result, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "disabled", result.Status)
+		assert.Equal(t, reasonDisabled, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+
+	t.Run("RemovesStateAnnotationOfDisabledHPAIfCleanUpIsEnabled", func(t *testing.T) {
+
+		*cleanUpDisabledState = true
+		defer func() { *cleanUpDisabledState = false }()
+		hpa := newTestHorizontalPodAutoscaler(8, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "false", "estafette.io/hpa-scaler-state": `{"minReplicas":8}`, "estafette.io/hpa-scaler-target-min-replicas": "8"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		result, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "disabled", result.Status)
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		updatedHPA, _ := kubeClient.AutoscalingV1().HorizontalPodAutoscalers(hpa.Namespace).Get(context.Background(), hpa.Name, metav1.GetOptions{})
+		assert.Equal(t, map[string]string{"estafette.io/hpa-scaler": "false"}, updatedHPA.Annotations)
+	})
+
+	t.Run("DoesNotUpdateDisabledHPAWithoutStateAnnotationIfCleanUpIsEnabled", func(t *testing.T) {
+
+		*cleanUpDisabledState = true
+		defer func() { *cleanUpDisabledState = false }()
+		hpa := newTestHorizontalPodAutoscaler(8, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "false"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		_, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+
+	t.Run("KeepsStateAnnotationOfDisabledHPAByDefault", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(8, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "false", "estafette.io/hpa-scaler-state": `{"minReplicas":8}`}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		_, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+		assert.Equal(t, `{"minReplicas":8}`, hpa.Annotations["estafette.io/hpa-scaler-state"])
+	})
+
+	t.Run("ReturnsDisabledIfScalerIsExplicitlyDisabledInNativeBehaviorMode", func(t *testing.T) {
+
+		*scaleDownMode = scaleDownModeNativeBehavior
+		defer func() { *scaleDownMode = scaleDownModeRatio }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "false", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		result, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "disabled", result.Status)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+
+	t.Run("ReturnsSkippedIfScalerAnnotationIsMissing", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		result, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonNotEnabled, result.Reason)
+	})
+
+	t.Run("UpdatesIfScalerIsEnabled", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		result, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("SetsRequestRateIfMinReplicasIsAtTarget", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "160"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(8, 20, 10)
+		hpa.Name = "at-target-app"
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-prometheus-server-url": server.URL, "estafette.io/hpa-scaler-prometheus-query": "requests", "estafette.io/hpa-scaler-requests-per-replica": "20", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		result, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, reasonNoChange, result.Reason)
+		assert.Equal(t, float64(160), testutil.ToFloat64(requestRateVector.WithLabelValues("at-target-app", "my-namespace")))
+	})
+
+	t.Run("DeletesMetricsIfScalerIsDisabled", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Name = "disabled-app"
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "false"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		requestRateVector.WithLabelValues("disabled-app", "my-namespace").Set(100)
+		minReplicasVector.WithLabelValues("disabled-app", "my-namespace").Set(5)
+		actualReplicasVector.WithLabelValues("disabled-app", "my-namespace").Set(10)
+
+		// act
+		_, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		// deleting returns false if the series no longer exists
+		assert.False(t, requestRateVector.DeleteLabelValues("disabled-app", "my-namespace"))
+		assert.False(t, minReplicasVector.DeleteLabelValues("disabled-app", "my-namespace"))
+		assert.False(t, actualReplicasVector.DeleteLabelValues("disabled-app", "my-namespace"))
+	})
+
+	t.Run("ReplacesInfoSeriesIfScalerIsDisabled", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Name = "toggled-app"
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-prometheus-server-url": server.URL}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		_, _ = processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+		hpa.Annotations["estafette.io/hpa-scaler"] = "false"
+
+		// act
+		_, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.False(t, hpaInfoVector.DeleteLabelValues("toggled-app", "my-namespace", server.URL, "true"))
+		assert.True(t, hpaInfoVector.DeleteLabelValues("toggled-app", "my-namespace", server.URL, "false"))
+		hpaInfos.Delete("toggled-app", "my-namespace")
+	})
+
+	t.Run("DeletesMetricsIfScalerAnnotationIsRemoved", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Name = "unannotated-app"
+		hpa.Annotations = map[string]string{}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		requestRateVector.WithLabelValues("unannotated-app", "my-namespace").Set(100)
+
+		// act
+		_, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.False(t, requestRateVector.DeleteLabelValues("unannotated-app", "my-namespace"))
+	})
+
+	t.Run("UpdatesIfScalerIsEnabledAndInAllowlist", func(t *testing.T) {
+
+		hpaAllowlist = map[string]bool{"my-namespace/my-app": true}
+		defer func() { hpaAllowlist = map[string]bool{} }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		result, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ReturnsSkippedIfScalerIsEnabledButNotInAllowlist", func(t *testing.T) {
+
+		hpaAllowlist = map[string]bool{"my-namespace/other-app": true}
+		defer func() { hpaAllowlist = map[string]bool{} }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-scale-down-max-ratio": "0.2"}
+		kubeClient := fake.NewSimpleClientset(hpa)
+
+		// act
+		result, err := processHorizontalPodAutoscaler(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonNotAllowed, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+}
+
+func TestExecutePrometheusQueryWithCancelledContext(t *testing.T) {
+	t.Run("ReturnsErrorIfContextIsCancelled", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// act
+		_, err := executePrometheusQuery(ctx, hpa, server.URL, server.URL+"/api/v1/query?query=requests")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("DoesNotCountCancelledQueryAsCircuitBreakerFailure", func(t *testing.T) {
+
+		prometheusCircuitBreaker = newCircuitBreaker(1, time.Minute)
+		defer func() { prometheusCircuitBreaker = nil }()
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// act
+		_, err := executePrometheusQuery(ctx, hpa, server.URL, server.URL+"/api/v1/query?query=requests")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, circuitBreakerClosed, prometheusCircuitBreaker.Status(server.URL))
+	})
+}
+
+func TestExecutePrometheusQueryWithRetries(t *testing.T) {
+	t.Run("RetriesUntilResponseCanBeUnmarshalled", func(t *testing.T) {
+
+		*prometheusQueryRetries = 2
+		*prometheusQueryRetryBackoff = time.Millisecond
+		defer func() { *prometheusQueryRetries = 0; *prometheusQueryRetryBackoff = 0 }()
+		queryCache.Clear()
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts < 3 {
+				// cut off mid-body
+				fmt.Fprint(w, `{"status":"success","data":{"resultType":"vec`)
+				return
+			}
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1513161148.757,"100"]}]}}`)
+		}))
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+
+		// act
+		queryResponse, err := executePrometheusQuery(context.Background(), hpa, server.URL, server.URL+"/api/v1/query?query=requests")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, attempts)
+		requestRate, err := queryResponse.GetValue()
+		assert.Nil(t, err)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("ReturnsErrorIfRetriesAreExhausted", func(t *testing.T) {
+
+		*prometheusQueryRetries = 1
+		*prometheusQueryRetryBackoff = time.Millisecond
+		defer func() { *prometheusQueryRetries = 0; *prometheusQueryRetryBackoff = 0 }()
+		queryCache.Clear()
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vec`)
+		}))
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+
+		// act
+		_, err := executePrometheusQuery(context.Background(), hpa, server.URL, server.URL+"/api/v1/query?query=requests")
+
+		assert.NotNil(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+}
+
+func TestGetMinPodCountBasedOnPrometheusQuery(t *testing.T) {
+	t.Run("ReturnsZeroIfQueryIsEmpty", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{RequestsPerReplica: 1}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(0), minPodCount)
+		assert.Equal(t, float64(0), requestRate)
+	})
+
+	t.Run("DividesRequestRateByStaticRequestsPerReplica", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("NormalizesPerMinuteRequestRateToPerSecond", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "6000"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, RateUnit: rateUnitPerMinute}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// 6000 / 60 / 20
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("DividesGaugeValueByValuePerReplica", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"active_sessions": "1250"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "active_sessions", PrometheusQueryMode: prometheusQueryModeGauge, RequestsPerReplica: 200}
+
+		// act
+		minPodCount, value, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// 1250 / 200
+		assert.Equal(t, int32(7), minPodCount)
+		assert.Equal(t, float64(1250), value)
+	})
+
+	t.Run("DoesNotNormalizeGaugeValueWithRateUnit", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"active_sessions": "6000"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "active_sessions", PrometheusQueryMode: prometheusQueryModeGauge, RequestsPerReplica: 200, RateUnit: rateUnitPerMinute}
+
+		// act
+		minPodCount, value, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// 6000 / 200, where a per minute rate would be 6000 / 60 / 200
+		assert.Equal(t, int32(30), minPodCount)
+		assert.Equal(t, float64(6000), value)
+	})
+
+	t.Run("UsesPerSecondRequestRateAsIs", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, RateUnit: rateUnitPerSecond}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("IncreasesCurrentPodCountIfLatencyExceedsTargetLatency", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"latency_p95": "0.3"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "latency_p95", RequestsPerReplica: 1, TargetLatency: 0.2, LatencyGain: 1}
+
+		// act
+		minPodCount, latency, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// 10 * (1 + (0.3 - 0.2) / 0.2)
+		assert.Equal(t, int32(15), minPodCount)
+		assert.Equal(t, 0.3, latency)
+	})
+
+	t.Run("MultipliesReplicasBySafetyFactor", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, SafetyFactor: 1.2}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// ceil(1.2 * 100 / 20)
+		assert.Equal(t, int32(6), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("FillsInQueryWindow", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"sum(rate(requests[5m]))": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "sum(rate(requests[{{.Window}}]))", QueryWindow: "5m", RequestsPerReplica: 20}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("ReturnsQueryErrorForInvalidPlaceholder", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "sum(rate(requests[{{.Window]))", QueryWindow: "5m", RequestsPerReplica: 20}
+
+		// act
+		_, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		var queryError *QueryError
+		assert.True(t, errors.As(err, &queryError))
+	})
+
+	t.Run("AddsHeadroomOfDeltaRatio", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "200"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, DeltaRatio: 0.1}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// ceil(200 / 20 + 10%)
+		assert.Equal(t, int32(11), minPodCount)
+		assert.Equal(t, float64(200), requestRate)
+	})
+
+	t.Run("AddsHeadroomOfDeltaRatioBeforeAbsoluteDelta", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "150"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, DeltaRatio: 0.1, Delta: 2}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// ceil(2 + 150 / 20 + 10%) = ceil(2 + 8.25)
+		assert.Equal(t, int32(11), minPodCount)
+	})
+
+	t.Run("MultipliesReplicasBySafetyFactorBelowOne", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, SafetyFactor: 0.8}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// ceil(0.8 * 100 / 20)
+		assert.Equal(t, int32(4), minPodCount)
+	})
+
+	t.Run("MultipliesReplicasPerSeriesBySafetyFactor", func(t *testing.T) {
+
+		server := newTestPrometheusServerWithSeries(map[string][]string{"requests": {"50", "50"}})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, SafetyFactor: 1.2, PrometheusQueryAggregation: queryAggregationPerSeriesCeilSum}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// ceil(1.2 * 50 / 20) + ceil(1.2 * 50 / 20)
+		assert.Equal(t, int32(6), minPodCount)
+	})
+
+	t.Run("DividesRequestRateByRequestsPerReplicaFromQuery", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100", "capacity": "10"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, RequestsPerReplicaQuery: "capacity"}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(10), minPodCount)
+	})
+
+	t.Run("DividesRequestRateByRequestsPerReplicaFromRecordingRule", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100", "service:requests_per_replica:capacity": "25"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-prometheus-server-url"] = server.URL
+		hpa.Annotations["estafette.io/hpa-scaler-prometheus-query"] = "requests"
+		hpa.Annotations["estafette.io/hpa-scaler-requests-per-replica"] = "rule:service:requests_per_replica:capacity"
+		desiredState := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(4), minPodCount)
+	})
+
+	t.Run("ReturnsErrorIfRecordingRuleIsMissing", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-prometheus-server-url"] = server.URL
+		hpa.Annotations["estafette.io/hpa-scaler-prometheus-query"] = "requests"
+		hpa.Annotations["estafette.io/hpa-scaler-requests-per-replica"] = "rule:service:requests_per_replica:capacity"
+		desiredState := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, reasonQueryFailed, getFailedReason(err))
+		assert.Equal(t, int32(0), minPodCount)
+	})
+
+	t.Run("FallsBackToStaticRequestsPerReplicaIfQueryFails", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, RequestsPerReplicaQuery: "missing-capacity"}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+	})
+
+	t.Run("DividesRequestRateByFractionalRequestsPerReplicaFromQuery", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "3", "capacity": "0.25"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, RequestsPerReplicaQuery: "capacity"}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, float64(3), requestRate)
+		assert.Equal(t, int32(12), minPodCount)
+	})
+
+	t.Run("FallsBackToStaticRequestsPerReplicaIfQueryReturnsZero", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100", "capacity": "0"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, RequestsPerReplicaQuery: "capacity"}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+	})
+
+	t.Run("DividesRequestRateByRequestsPerReplicaFromQueryWithoutStaticValue", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100", "capacity": "4"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 0, RequestsPerReplicaQuery: "capacity"}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(25), minPodCount)
+	})
+
+	t.Run("ReturnsErrorIfRequestsPerReplicaFromQueryAndStaticValueAreZero", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100", "capacity": "0"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 0, RequestsPerReplicaQuery: "capacity"}
+
+		// act
+		_, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, reasonQueryFailed, getFailedReason(err))
+	})
+
+	t.Run("FallsBackToSecondaryServerIfPrimaryFails", func(t *testing.T) {
+
+		primaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "not json")
+		}))
+		defer primaryServer.Close()
+		secondaryServer := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer secondaryServer.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: primaryServer.URL, PrometheusSecondaryServerURL: secondaryServer.URL, PrometheusQuery: "requests", RequestsPerReplica: 20}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+		assert.Equal(t, float64(0), testutil.ToFloat64(prometheusQueryServerTotals.WithLabelValues(primaryServer.URL)))
+		assert.Equal(t, float64(1), testutil.ToFloat64(prometheusQueryServerTotals.WithLabelValues(secondaryServer.URL)))
+	})
+
+	t.Run("QueriesApiUnderPathPrefix", func(t *testing.T) {
+
+		queryCache.Clear()
+		requestedPaths := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestedPaths = append(requestedPaths, r.URL.Path)
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1513161148.757,"100"]}]}}`)
+		}))
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusPathPrefix: "/prometheus", PrometheusQuery: "requests", RequestsPerReplica: 20}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, []string{"/prometheus/api/v1/query"}, requestedPaths)
+	})
+
+	t.Run("ComputesRequestRateFromCounterQueriedAnIntervalApart", func(t *testing.T) {
+
+		queryTimes := []string{}
+		mutex := sync.Mutex{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			queryTimes = append(queryTimes, r.URL.Query().Get("time"))
+			mutex.Unlock()
+			queryTime, _ := strconv.ParseInt(r.URL.Query().Get("time"), 10, 64)
+			value := "1600"
+			if queryTime < time.Now().Unix()-30 {
+				value = "1000"
+			}
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[%v,"%v"]}]}}`, queryTime, value)
+		}))
+		defer server.Close()
+		queryCache.Clear()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests_total", PrometheusQueryMode: prometheusQueryModeCounter, PrometheusCounterIntervalSeconds: 60, RequestsPerReplica: 2}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// (1600 - 1000) / 60
+		assert.Equal(t, float64(10), requestRate)
+		assert.Equal(t, int32(5), minPodCount)
+		if assert.Equal(t, 2, len(queryTimes)) {
+			earlierTime, _ := strconv.ParseInt(queryTimes[0], 10, 64)
+			laterTime, _ := strconv.ParseInt(queryTimes[1], 10, 64)
+			assert.Equal(t, int64(60), laterTime-earlierTime)
+		}
+	})
+
+	t.Run("ReturnsErrorIfPrimaryAndSecondaryServerFail", func(t *testing.T) {
+
+		failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "not json")
+		}))
+		defer failingServer.Close()
+		queryCache.Clear()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: failingServer.URL, PrometheusSecondaryServerURL: failingServer.URL + "/secondary", PrometheusQuery: "requests", RequestsPerReplica: 20}
+
+		// act
+		_, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("UsesFirstSeriesByDefault", func(t *testing.T) {
+
+		server := newTestPrometheusServerWithSeries(map[string][]string{"requests": []string{"15", "15", "15"}})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 10, PrometheusQueryAggregation: queryAggregationFirst}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(2), minPodCount)
+		assert.Equal(t, float64(15), requestRate)
+	})
+
+	t.Run("DividesSumOfSeriesByRequestsPerReplica", func(t *testing.T) {
+
+		server := newTestPrometheusServerWithSeries(map[string][]string{"requests": []string{"15", "15", "15"}})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 10, PrometheusQueryAggregation: queryAggregationSum}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// ceil(45 / 10)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(45), requestRate)
+	})
+
+	t.Run("SumsRoundedUpReplicasPerSeries", func(t *testing.T) {
+
+		server := newTestPrometheusServerWithSeries(map[string][]string{"requests": []string{"15", "15", "15"}})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 10, PrometheusQueryAggregation: queryAggregationPerSeriesCeilSum}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// ceil(15 / 10) + ceil(15 / 10) + ceil(15 / 10)
+		assert.Equal(t, int32(6), minPodCount)
+		assert.Equal(t, float64(45), requestRate)
+	})
+
+	t.Run("AppliesDeltaOnceToSumOfRoundedUpReplicasPerSeries", func(t *testing.T) {
+
+		server := newTestPrometheusServerWithSeries(map[string][]string{"requests": []string{"15", "5"}})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 10, Delta: 1.5, PrometheusQueryAggregation: queryAggregationPerSeriesCeilSum}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		// ceil(1.5 + ceil(15 / 10) + ceil(5 / 10))
+		assert.Equal(t, int32(5), minPodCount)
+	})
+
+	t.Run("IgnoresScaleDownMaxRatioInNativeBehaviorMode", func(t *testing.T) {
+
+		*scaleDownMode = scaleDownModeNativeBehavior
+		defer func() { *scaleDownMode = scaleDownModeRatio }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, int32(3), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("IgnoresCurrentPodCountIfScaleDownFloorIsDisabled", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, ScaleDownMaxRatio: 0.2, DisableScaleDownFloor: "true"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		// the current pod floor of 8 would win from the 5 replicas based on the request rate if it weren't disabled
+		assert.Equal(t, int32(5), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("HoldsMinReplicasAfterSpikeUntilRequestRateWindowHasPassed", func(t *testing.T) {
+
+		rates := map[string]string{"requests": "200"}
+		server := newTestPrometheusServer(rates)
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(5, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, ScaleDownMaxRatio: 0.2, DisableScaleDownFloor: "true", RequestRateWindowSize: 3}
+		minReplicas := []int32{}
+
+		// act
+		for i := 0; i < 4; i++ {
+			_, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+			assert.Nil(t, err)
+			minReplicas = append(minReplicas, *hpa.Spec.MinReplicas)
+
+			// the spike is over after the first poll
+			rates["requests"] = "100"
+			queryCache.Clear()
+		}
+
+		assert.Equal(t, []int32{10, 10, 10, 5}, minReplicas)
+		lastState, _ := getLastState(hpa)
+		assert.Equal(t, []float64{100, 100, 100}, lastState.RecentRequestRates)
+	})
+
+	t.Run("ListsReplicaSetsIfDeploymentCheckingIsEnabled", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		replicaSet := newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 10)
+		kubeClient := fake.NewSimpleClientset(hpa, &replicaSet)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, EnableScaleDownRatioDeploymentChecking: "true"}
+
+		// act
+		_, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, countListReplicaSetsActions(kubeClient))
+	})
+
+	t.Run("DoesNotListReplicaSetsIfDeploymentCheckingIsDisabledGlobally", func(t *testing.T) {
+
+		*disableDeploymentChecking = true
+		defer func() { *disableDeploymentChecking = false }()
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		replicaSet := newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 10)
+		kubeClient := fake.NewSimpleClientset(hpa, &replicaSet)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, EnableScaleDownRatioDeploymentChecking: "true"}
+
+		// act
+		_, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, countListReplicaSetsActions(kubeClient))
+	})
+
+	t.Run("DoesNotGoBelowLowerBoundIfScaleDownFloorIsDisabled", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, DisableScaleDownFloor: "true"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, reasonClampedLower, result.Reason)
+		assert.Equal(t, int32(3), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("CapsMinReplicasToMaxMinReplicas", func(t *testing.T) {
+
+		*maxMinReplicas = 50
+		defer func() { *maxMinReplicas = 0 }()
+		server := newTestPrometheusServer(map[string]string{"requests": "10000"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 1, Delta: 100, ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, reasonClampedUpper, result.Reason)
+		assert.Equal(t, int32(50), *hpa.Spec.MinReplicas)
+		assert.Equal(t, float64(1), testutil.ToFloat64(maxMinReplicasCappedTotals.WithLabelValues("my-app", "my-namespace")))
+	})
+
+	t.Run("DoesNotUpdateIfManualEditIsRespected", func(t *testing.T) {
+
+		manualEdits = newManualEditTracker()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = `{"enabled":"true","minReplicas":8}`
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, RespectManualEditsSeconds: 600}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonCooldown, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(3), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("UpdatesIfManualEditIsRespectedForLongEnough", func(t *testing.T) {
+
+		manualEdits = newManualEditTracker()
+		manualEdits.Detect("my-namespace/my-app", time.Now().Add(-time.Hour))
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = `{"enabled":"true","minReplicas":8}`
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, RespectManualEditsSeconds: 600}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+		assert.Contains(t, hpa.Annotations["estafette.io/hpa-scaler-state"], `"minReplicas":8`)
+	})
+
+	t.Run("UpdatesIfManualEditsAreAlwaysReconciled", func(t *testing.T) {
+
+		manualEdits = newManualEditTracker()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = `{"enabled":"true","minReplicas":8}`
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, RespectManualEditsSeconds: 0}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("WritesComputedAnnotationsIfEnabled", func(t *testing.T) {
+
+		*writeComputedAnnotations = true
+		defer func() { *writeComputedAnnotations = false }()
+		server := newTestPrometheusServer(map[string]string{"requests": "250.5"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		assert.Equal(t, "250.5", hpa.Annotations["estafette.io/hpa-scaler-last-request-rate"])
+		assert.Equal(t, "13", hpa.Annotations["estafette.io/hpa-scaler-target-min-replicas"])
+	})
+
+	t.Run("DoesNotWriteComputedAnnotationsByDefault", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		_, ok := hpa.Annotations["estafette.io/hpa-scaler-target-min-replicas"]
+		assert.False(t, ok)
+	})
+
+	t.Run("AddsBufferReplicasToQueryBasedMinimum", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "200"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, ScaleDownMaxRatio: 0.2, BufferReplicas: 2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		// max(ceil(200 / 20), 10 - floor(10 * 0.2)) + 2
+		assert.Equal(t, int32(12), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("AddsBufferReplicasToCurrentPodCountBasedMinimum", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, BufferReplicas: 2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		// 10 - floor(10 * 0.2) + 2
+		assert.Equal(t, int32(10), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("CapsBufferReplicasToMaxMinReplicas", func(t *testing.T) {
+
+		*maxMinReplicas = 9
+		defer func() { *maxMinReplicas = 0 }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, BufferReplicas: 2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, reasonClampedUpper, result.Reason)
+		assert.Equal(t, int32(9), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("CapsToMaxMinReplicasIfChangeIsBelowMinChange", func(t *testing.T) {
+
+		*maxMinReplicas = 9
+		defer func() { *maxMinReplicas = 0 }()
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.05, BufferReplicas: 2, MinChange: 3}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, processingResult{"succeeded", reasonClampedUpper}, result)
+		assert.Equal(t, int32(9), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("CapsToMaxMinReplicasIfChangeIsBelowMinChangeRatio", func(t *testing.T) {
+
+		*maxMinReplicas = 9
+		defer func() { *maxMinReplicas = 0 }()
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.05, BufferReplicas: 2, MinChangeRatio: 0.5}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, processingResult{"succeeded", reasonClampedUpper}, result)
+		assert.Equal(t, int32(9), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("DoesNotApplySmallChangeToClampedTargetWithinLimit", func(t *testing.T) {
+
+		*maxMinReplicas = 9
+		defer func() { *maxMinReplicas = 0 }()
+		hpa := newTestHorizontalPodAutoscaler(8, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.05, BufferReplicas: 2, MinChange: 3}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, processingResult{"skipped", reasonBelowMinChange}, result)
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("UsesMaxOfRecentTargetsInStateAnnotation", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"recentTargets":[12,9]}`}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, TargetWindowSize: 3, TargetWindowMode: targetWindowModeMax}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		// max(12, 9, 10 - floor(10 * 0.2))
+		assert.Equal(t, int32(12), *hpa.Spec.MinReplicas)
+		lastState, _ := getLastState(hpa)
+		assert.Equal(t, []int32{12, 9, 8}, lastState.RecentTargets)
+	})
+
+	t.Run("StoresRecentTargetsIfMinReplicasIsUnchanged", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(12, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"lastUpdated":"2020-01-01T00:00:00Z","minReplicas":12,"recentTargets":[12,9]}`}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, MinChange: 4, TargetWindowSize: 2, TargetWindowMode: targetWindowModeMax}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonBelowMinChange, result.Reason)
+		assert.Equal(t, 1, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(12), *hpa.Spec.MinReplicas)
+		lastState, _ := getLastState(hpa)
+		assert.Equal(t, []int32{9, 8}, lastState.RecentTargets)
+		assert.Equal(t, "2020-01-01T00:00:00Z", lastState.LastUpdated)
+		assert.Equal(t, int32(12), *lastState.MinReplicas)
+	})
+
+	t.Run("DoesNotStoreRecentTargetsIfWindowIsDisabled", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(8, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, TargetWindowSize: 1}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, reasonNoChange, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+
+	t.Run("ScalesDownIfRequestRateDropIsWithinMaxRateDropRatio", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "120"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"lastRequestRate":200}`}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, ScaleDownMaxRatio: 0.5, MaxRateDropRatio: 0.5}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(6), *hpa.Spec.MinReplicas)
+		lastState, _ := getLastState(hpa)
+		assert.Equal(t, float64(120), lastState.LastRequestRate)
+	})
+
+	t.Run("DoesNotScaleDownIfRequestRateDropExceedsMaxRateDropRatio", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "80"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"lastUpdated":"2020-01-01T00:00:00Z","minReplicas":10,"lastRequestRate":200}`}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, ScaleDownMaxRatio: 0.5, MaxRateDropRatio: 0.5}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonRateDrop, result.Reason)
+		assert.Equal(t, int32(10), *hpa.Spec.MinReplicas)
+		lastState, _ := getLastState(hpa)
+		assert.Equal(t, float64(80), lastState.LastRequestRate)
+		assert.Equal(t, "2020-01-01T00:00:00Z", lastState.LastUpdated)
+	})
+
+	t.Run("ComparesRequestRateDropWithPreviousPollWithoutUpdate", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"lastRequestRate":400}`}
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", PrometheusQuery: "requests", RequestsPerReplica: 20, ScaleDownMaxRatio: 0.5, MaxRateDropRatio: 0.5}
+		steadyServer := newTestPrometheusServer(map[string]string{"requests": "200"})
+		defer steadyServer.Close()
+		desiredState.PrometheusServerURL = steadyServer.URL
+		results := []processingResult{}
+		for i := 0; i < 2; i++ {
+			result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+			assert.Nil(t, err)
+			results = append(results, result)
+		}
+		lastState, _ := getLastState(hpa)
+		assert.Equal(t, float64(200), lastState.LastRequestRate)
+		droppingServer := newTestPrometheusServer(map[string]string{"requests": "180"})
+		defer droppingServer.Close()
+		desiredState.PrometheusServerURL = droppingServer.URL
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, processingResult{"skipped", reasonNoChange}, results[0])
+		assert.Equal(t, processingResult{"skipped", reasonNoChange}, results[1])
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(9), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ScalesDownIfThereIsNoStoredRequestRate", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "80"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, ScaleDownMaxRatio: 0.5, MaxRateDropRatio: 0.5}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(5), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("DoesNotUpdateIfLastUpdateIsWithinMinUpdateInterval", func(t *testing.T) {
+
+		*minUpdateInterval = time.Minute
+		defer func() { *minUpdateInterval = 0 }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = fmt.Sprintf(`{"lastUpdated":"%v","minReplicas":3}`, time.Now().Add(-10*time.Second).Format(time.RFC3339))
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "skipped", result.Status)
+		assert.Equal(t, reasonDebounced, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+		assert.Equal(t, int32(3), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("UpdatesIfLastUpdateIsLongerAgoThanMinUpdateInterval", func(t *testing.T) {
+
+		*minUpdateInterval = time.Minute
+		defer func() { *minUpdateInterval = 0 }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = fmt.Sprintf(`{"lastUpdated":"%v","minReplicas":3}`, time.Now().Add(-2*time.Minute).Format(time.RFC3339))
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(8), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ScalesBelowGlobalLowerBoundIfHPALowerBoundIsLower", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 2)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.5, MinimumReplicasLowerBound: 1}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		// 2 - floor(2 * 0.5) is below the global lower bound of 3
+		assert.Equal(t, reasonUpdated, result.Reason)
+		assert.Equal(t, int32(1), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("UpdatesMinReplicasToColdStartMinReplicasIfHPAHasZeroReplicas", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 0)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, ColdStartMinReplicas: 6}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, reasonUpdated, result.Reason)
+		assert.Equal(t, int32(6), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ClampsToLowerBoundIfHPAHasZeroReplicasWithoutColdStartMinReplicas", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(5, 20, 0)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, reasonClampedLower, result.Reason)
+		assert.Equal(t, int32(3), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ScalesDownByRatioPerMinuteCompoundedSinceLastUpdate", func(t *testing.T) {
+
+		*scaleDownRatioPerMinute = true
+		defer func() { *scaleDownRatioPerMinute = false }()
+		recentHPA := newTestHorizontalPodAutoscaler(10, 20, 10)
+		recentHPA.Annotations["estafette.io/hpa-scaler-state"] = fmt.Sprintf(`{"lastUpdated":"%v"}`, time.Now().Add(-30*time.Second).Format(time.RFC3339))
+		staleHPA := newTestHorizontalPodAutoscaler(10, 20, 10)
+		staleHPA.Name = "my-other-app"
+		staleHPA.Annotations["estafette.io/hpa-scaler-state"] = fmt.Sprintf(`{"lastUpdated":"%v"}`, time.Now().Add(-5*time.Minute).Format(time.RFC3339))
+		kubeClient := fake.NewSimpleClientset(recentHPA, staleHPA)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+
+		// act
+		_, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, recentHPA, &replicaSetsHolder{}, "test", desiredState)
+		_, otherErr := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, staleHPA, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Nil(t, otherErr)
+		// 10 - floor(10 * (1 - 0.8^0.5))
+		assert.Equal(t, int32(9), *recentHPA.Spec.MinReplicas)
+		// 10 - floor(10 * (1 - 0.8^5))
+		assert.Equal(t, int32(4), *staleHPA.Spec.MinReplicas)
+	})
+
+	t.Run("ClampsMinReplicasToMaxReplicasIfMaxReplicasIsNotManaged", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, BufferReplicas: 20, ManageMaxReplicas: "false"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, reasonClampedUpper, result.Reason)
+		assert.Equal(t, int32(20), *hpa.Spec.MinReplicas)
+		assert.Equal(t, int32(20), hpa.Spec.MaxReplicas)
+	})
+
+	t.Run("DoesNotChangeMaxReplicasAcrossUpdatesIfMaxReplicasIsNotManaged", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, ManageMaxReplicas: "false"}
+
+		// act
+		for _, currentReplicas := range []int32{10, 25, 30} {
+			hpa.Status.CurrentReplicas = currentReplicas
+			_, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+			assert.Nil(t, err)
+			hpa, _ = kubeClient.AutoscalingV1().HorizontalPodAutoscalers("my-namespace").Get(context.Background(), "my-app", metav1.GetOptions{})
+			assert.Equal(t, int32(20), hpa.Spec.MaxReplicas)
+		}
+
+		assert.Equal(t, int32(20), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("RaisesMaxReplicasIfMinReplicasReachesIt", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, BufferReplicas: 20, ManageMaxReplicas: "true"}
+
+		// act
+		_, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(28), *hpa.Spec.MinReplicas)
+		assert.Equal(t, int32(29), hpa.Spec.MaxReplicas)
+	})
+
+	t.Run("UsesOverrideQueryResultInsteadOfRequestRate", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100", "sale_min_replicas": "12"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 2)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 1, PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, BufferReplicas: 2, OverrideMinReplicasQuery: "sale_min_replicas"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, reasonOverridden, result.Reason)
+		assert.Equal(t, int32(12), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("FollowsRequestRateIfOverrideQueryHasNoResult", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 2)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 1, PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, OverrideMinReplicasQuery: "sale_min_replicas"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, reasonUpdated, result.Reason)
+		assert.Equal(t, int32(5), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("UsesOverrideQueryResultIfRequestRateQueryFails", func(t *testing.T) {
+
+		server := newTestPrometheusServer(map[string]string{"sale_min_replicas": "12"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 2)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 1, PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, OverrideMinReplicasQuery: "sale_min_replicas"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, reasonOverridden, result.Reason)
+		assert.Equal(t, int32(12), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ClampsOverrideQueryResultToBounds", func(t *testing.T) {
+
+		*maxMinReplicas = 10
+		defer func() { *maxMinReplicas = 0 }()
+		server := newTestPrometheusServer(map[string]string{"requests": "100", "sale_min_replicas": "12"})
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 2)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 1, PrometheusServerURL: server.URL, PrometheusQuery: "requests", RequestsPerReplica: 20, OverrideMinReplicasQuery: "sale_min_replicas"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, reasonClampedUpper, result.Reason)
+		assert.Equal(t, int32(10), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("RoundsMinReplicasUpToMultiple", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 8)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, RoundToMultiple: 3}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		// 8 - floor(8 * 0.2) = 7, rounded up to a multiple of 3
+		assert.Equal(t, int32(9), *hpa.Spec.MinReplicas)
+	})
+
+	t.Run("ReturnsInvalidReplicasIfMaxReplicasOverflows", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2, BufferReplicas: math.MaxInt32 - 8}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "failed", result.Status)
+		assert.Equal(t, reasonInvalidReplicas, result.Reason)
+		storedHPA, _ := kubeClient.AutoscalingV1().HorizontalPodAutoscalers("my-namespace").Get(context.Background(), "my-app", metav1.GetOptions{})
+		assert.Equal(t, int32(3), *storedHPA.Spec.MinReplicas)
+	})
+
+	t.Run("DoesNotUpdateIfRateLimiterWaitIsCancelled", func(t *testing.T) {
+
+		updateRateLimiter = flowcontrol.NewTokenBucketRateLimiter(0.001, 1)
+		defer func() { updateRateLimiter = nil }()
+		updateRateLimiter.Accept()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.2}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(ctx, kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "failed", result.Status)
+		assert.Equal(t, reasonUpdateFailed, result.Reason)
+		assert.Equal(t, 0, countUpdateActions(kubeClient))
+	})
+
+	t.Run("ScalesToZeroIfEnabled", func(t *testing.T) {
+
+		*scaleToZeroEnabled = true
+		defer func() { *scaleToZeroEnabled = false }()
+		hpa := newTestHorizontalPodAutoscaler(1, 5, 1)
+		kubeClient := fake.NewSimpleClientset(hpa)
+		desiredState := HPAScalerState{Enabled: "true", ScaleDownMaxRatio: 0.5, ScaleToZero: "true"}
+
+		// act
+		result, err := makeHorizontalPodAutoscalerChanges(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, "test", desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "succeeded", result.Status)
+		assert.Equal(t, int32(0), *hpa.Spec.MinReplicas)
+	})
+}
+
+func TestGetWindowedRequestRate(t *testing.T) {
+	testCases := []struct {
+		name                        string
+		recentRequestRates          []float64
+		requestRate                 float64
+		windowSize                  int
+		expectedWindowedRequestRate float64
+		expectedRecentRequestRates  []float64
+	}{
+		{"ReturnsRequestRateIfThereAreNoRecentRequestRates", nil, 50, 3, 50, []float64{50}},
+		{"ReturnsMaxOfRecentRequestRates", []float64{200, 40}, 50, 3, 200, []float64{200, 40, 50}},
+		{"DropsOldestRequestRatesOutsideWindow", []float64{200, 40, 30}, 50, 3, 50, []float64{40, 30, 50}},
+		{"ShrinksRecentRequestRatesIfWindowGotSmaller", []float64{200, 40, 30}, 20, 2, 30, []float64{30, 20}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			// act
+			windowedRequestRate, recentRequestRates := getWindowedRequestRate(tc.recentRequestRates, tc.requestRate, tc.windowSize)
+
+			assert.Equal(t, tc.expectedWindowedRequestRate, windowedRequestRate)
+			assert.Equal(t, tc.expectedRecentRequestRates, recentRequestRates)
+		})
+	}
+}
+
+func TestGetSmoothedReplicas(t *testing.T) {
+	testCases := []struct {
+		name                     string
+		previous                 float64
+		currentReplicas          int32
+		factor                   float64
+		expectedSmoothedReplicas float64
+	}{
+		{"ReturnsCurrentReplicasIfThereIsNoPreviousValue", 0, 10, 0.5, 10},
+		{"MovesHalfwayToCurrentReplicasForFactorOfHalf", 20, 10, 0.5, 15},
+		{"FollowsCurrentReplicasForFactorOfOne", 20, 10, 1, 10},
+		{"DampensSurgeForSmallFactor", 10, 20, 0.2, 12},
+		{"RoundsToTwoDecimals", 10, 11, 0.333, 10.33},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			// act
+			smoothedReplicas := getSmoothedReplicas(tc.previous, tc.currentReplicas, tc.factor)
+
+			assert.Equal(t, tc.expectedSmoothedReplicas, smoothedReplicas)
+		})
+	}
+}
+
+func TestGetWindowedTarget(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		recentTargets          []int32
+		target                 int32
+		windowSize             int
+		mode                   string
+		expectedWindowedTarget int32
+		expectedRecentTargets  []int32
+	}{
+		{"ReturnsTargetIfThereAreNoRecentTargets", nil, 5, 3, targetWindowModeMax, 5, []int32{5}},
+		{"ReturnsMaxOfRecentTargets", []int32{7, 4}, 5, 3, targetWindowModeMax, 7, []int32{7, 4, 5}},
+		{"DropsOldestTargetsOutsideWindow", []int32{9, 7, 4}, 5, 3, targetWindowModeMax, 7, []int32{7, 4, 5}},
+		{"ReturnsMedianOfRecentTargets", []int32{9, 4}, 5, 3, targetWindowModeMedian, 5, []int32{9, 4, 5}},
+		{"ReturnsUpperMedianForEvenNumberOfTargets", []int32{9, 2, 4}, 5, 4, targetWindowModeMedian, 5, []int32{9, 2, 4, 5}},
+		{"ShrinksRecentTargetsIfWindowGotSmaller", []int32{9, 7, 4, 3}, 5, 2, targetWindowModeMax, 5, []int32{3, 5}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			// act
+			windowedTarget, recentTargets := getWindowedTarget(tc.recentTargets, tc.target, tc.windowSize, tc.mode)
+
+			assert.Equal(t, tc.expectedWindowedTarget, windowedTarget)
+			assert.Equal(t, tc.expectedRecentTargets, recentTargets)
+		})
+	}
+}
+
+func TestGetLastChange(t *testing.T) {
+	t.Run("ReturnsLastUpdatedFromStateAnnotation", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = `{"enabled":"true","lastUpdated":"2019-12-13T10:32:28Z"}`
+
+		// act
+		lastChange, ok := getLastChange(hpa)
+
+		assert.True(t, ok)
+		assert.Equal(t, time.Date(2019, 12, 13, 10, 32, 28, 0, time.UTC), lastChange.UTC())
+	})
+
+	t.Run("ReturnsFalseIfStateAnnotationIsMissing", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+
+		// act
+		_, ok := getLastChange(hpa)
+
+		assert.False(t, ok)
+	})
+
+	t.Run("ReturnsFalseIfLastUpdatedIsInvalid", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = `{"enabled":"true","lastUpdated":""}`
+
+		// act
+		_, ok := getLastChange(hpa)
+
+		assert.False(t, ok)
+	})
+}
+
+func TestIsUpdateDebounced(t *testing.T) {
+	now := time.Date(2019, 12, 13, 10, 32, 28, 0, time.UTC)
+
+	testCases := []struct {
+		name              string
+		state             string
+		minUpdateInterval time.Duration
+		expectedDebounced bool
+	}{
+		{"ReturnsTrueIfLastUpdateIsWithinInterval", `{"lastUpdated":"2019-12-13T10:32:00Z"}`, time.Minute, true},
+		{"ReturnsFalseIfLastUpdateIsExactlyIntervalAgo", `{"lastUpdated":"2019-12-13T10:31:28Z"}`, time.Minute, false},
+		{"ReturnsFalseIfLastUpdateIsLongerAgo", `{"lastUpdated":"2019-12-13T10:20:00Z"}`, time.Minute, false},
+		{"ReturnsFalseIfIntervalIsDisabled", `{"lastUpdated":"2019-12-13T10:32:00Z"}`, 0, false},
+		{"ReturnsFalseIfThereIsNoLastUpdate", `{}`, time.Minute, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+			hpa.Annotations["estafette.io/hpa-scaler-state"] = tc.state
+
+			// act
+			debounced := isUpdateDebounced(hpa, tc.minUpdateInterval, now)
+
+			assert.Equal(t, tc.expectedDebounced, debounced)
+		})
+	}
+}
+
+func TestGetLastState(t *testing.T) {
+	t.Run("ReturnsStateFromStateAnnotation", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = `{"enabled":"true","lastUpdated":"2019-12-13T10:32:28Z","minReplicas":5,"recentTargets":[4,5]}`
+
+		// act
+		state, ok := getLastState(hpa)
+
+		assert.True(t, ok)
+		assert.Equal(t, "true", state.Enabled)
+		assert.Equal(t, int32(5), *state.MinReplicas)
+		assert.Equal(t, []int32{4, 5}, state.RecentTargets)
+	})
+
+	t.Run("ReturnsPartialStateWithZeroValuesForMissingFields", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = `{"minReplicas":5}`
+
+		// act
+		state, ok := getLastState(hpa)
+
+		assert.True(t, ok)
+		assert.Equal(t, int32(5), *state.MinReplicas)
+		assert.Equal(t, "", state.LastUpdated)
+		assert.Nil(t, state.RecentTargets)
+	})
+
+	testCases := []struct {
+		name  string
+		state string
+	}{
+		{"MalformedJSON", `{"enabled":"true","minReplicas":`},
+		{"WrongFieldType", `{"minReplicas":"five"}`},
+		{"InvalidLastUpdated", `{"lastUpdated":"yesterday"}`},
+		{"NegativeMinReplicas", `{"minReplicas":-1}`},
+		{"NegativeRecentTarget", `{"recentTargets":[3,-2]}`},
+		{"NegativeLastRequestRate", `{"lastRequestRate":-10}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run("ReturnsFreshStateFor"+tc.name, func(t *testing.T) {
+
+			hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+			hpa.Name = "invalid-state-" + strings.ToLower(tc.name)
+			hpa.Annotations["estafette.io/hpa-scaler-state"] = tc.state
+
+			// act
+			state, ok := getLastState(hpa)
+
+			assert.False(t, ok)
+			assert.Equal(t, HPAScalerState{}, state)
+			assert.Equal(t, float64(1), testutil.ToFloat64(invalidStateTotals.WithLabelValues(hpa.Name, hpa.Namespace)))
+		})
+	}
+}
+
+func TestSetSecondsSinceLastChange(t *testing.T) {
+	t.Run("SetsSecondsSinceLastUpdated", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations["estafette.io/hpa-scaler-state"] = `{"enabled":"true","lastUpdated":"2019-12-13T10:32:28Z"}`
+
+		// act
+		setSecondsSinceLastChange(hpa, time.Date(2019, 12, 13, 11, 32, 28, 0, time.UTC))
+
+		assert.Equal(t, float64(3600), testutil.ToFloat64(secondsSinceLastChangeVector.WithLabelValues("my-app", "my-namespace")))
+	})
+}
+
+func TestGetMinPodCountBasedOnCurrentPodCount(t *testing.T) {
+	testCases := []struct {
+		currentReplicas   int32
+		scaleDownMaxRatio float64
+		expectedPodCount  int32
+	}{
+		{0, 0.2, 0},
+		{0, 1, 0},
+		{1, 0.2, 0},
+		{1, 1, 0},
+		{2, 0.2, 1},
+		{5, 0.2, 4},
+		{5, 0.5, 3},
+		{5, 1, 0},
+		{5, 1.5, 0},
+		{5, 3, 0},
+		{10, 0, 9},
+		{10, 0.2, 8},
+		{10, 1, 0},
+		{10, 2, 0},
+		{100, 0.25, 75},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("Returns%vFor%vReplicasWithRatio%v", tc.expectedPodCount, tc.currentReplicas, tc.scaleDownMaxRatio), func(t *testing.T) {
+
+			hpa := newTestHorizontalPodAutoscaler(3, 200, tc.currentReplicas)
+			desiredState := HPAScalerState{ScaleDownMaxRatio: tc.scaleDownMaxRatio}
+
+			// act
+			podCount := getMinPodCountBasedOnCurrentPodCount(nil, hpa, desiredState)
+
+			assert.Equal(t, tc.expectedPodCount, podCount)
+		})
+	}
+
+	t.Run("ReturnsColdStartMinReplicasForZeroReplicas", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 200, 0)
+		desiredState := HPAScalerState{ScaleDownMaxRatio: 0.2, ColdStartMinReplicas: 5}
+
+		// act
+		podCount := getMinPodCountBasedOnCurrentPodCount(nil, hpa, desiredState)
+
+		assert.Equal(t, int32(5), podCount)
+	})
+
+	t.Run("UsesSmoothedReplicasIfSet", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 200, 10)
+		desiredState := HPAScalerState{ScaleDownMaxRatio: 0.2, SmoothedReplicas: 14.6}
+
+		// act
+		podCount := getMinPodCountBasedOnCurrentPodCount(nil, hpa, desiredState)
+
+		assert.Equal(t, int32(12), podCount)
+	})
+
+	t.Run("IgnoresColdStartMinReplicasForNonZeroReplicas", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 200, 2)
+		desiredState := HPAScalerState{ScaleDownMaxRatio: 0.2, ColdStartMinReplicas: 5}
+
+		// act
+		podCount := getMinPodCountBasedOnCurrentPodCount(nil, hpa, desiredState)
+
+		assert.Equal(t, int32(1), podCount)
+	})
+}
+
+func TestGetScaleDownMaxRatioSinceLastUpdate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name           string
+		lastUpdated    string
+		ratioPerMinute float64
+		expectedRatio  float64
+	}{
+		{"OneMinuteAgo", now.Add(-1 * time.Minute).Format(time.RFC3339), 0.2, 0.2},
+		{"HalfAMinuteAgo", now.Add(-30 * time.Second).Format(time.RFC3339), 0.2, 1 - math.Sqrt(0.8)},
+		{"FiveMinutesAgo", now.Add(-5 * time.Minute).Format(time.RFC3339), 0.2, 1 - math.Pow(0.8, 5)},
+		{"NeverUpdated", "", 0.2, 0.2},
+		{"InTheFuture", now.Add(time.Minute).Format(time.RFC3339), 0.2, 0.2},
+		{"RatioOfOne", now.Add(-5 * time.Minute).Format(time.RFC3339), 1, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+			if tc.lastUpdated != "" {
+				hpa.Annotations["estafette.io/hpa-scaler-state"] = fmt.Sprintf(`{"lastUpdated":"%v"}`, tc.lastUpdated)
+			}
+
+			// act
+			ratio := getScaleDownMaxRatioSinceLastUpdate(hpa, tc.ratioPerMinute, now)
+
+			assert.InDelta(t, tc.expectedRatio, ratio, 0.0001)
+		})
+	}
+}
+
+func TestRoundUpToMultiple(t *testing.T) {
+	testCases := []struct {
+		value    int32
+		multiple int32
+		expected int32
+	}{
+		{7, 3, 9},
+		{6, 3, 6},
+		{1, 3, 3},
+		{0, 3, 0},
+		{7, 1, 7},
+		{7, 0, 7},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("Returns%vFor%vRoundedToMultipleOf%v", tc.expected, tc.value, tc.multiple), func(t *testing.T) {
+
+			// act
+			rounded := roundUpToMultiple(tc.value, tc.multiple)
+
+			assert.Equal(t, tc.expected, rounded)
+		})
+	}
+}
+
+func TestGetMinPodCountBasedOnLatency(t *testing.T) {
+	testCases := []struct {
+		name             string
+		currentReplicas  int32
+		latency          float64
+		desiredState     HPAScalerState
+		expectedPodCount int32
+	}{
+		{"IncreasesPodCountIfLatencyIsAboveTarget", 10, 0.25, HPAScalerState{TargetLatency: 0.2, LatencyGain: 1}, 13},
+		{"AmplifiesIncreaseWithGain", 10, 0.25, HPAScalerState{TargetLatency: 0.2, LatencyGain: 2}, 15},
+		{"KeepsPodCountIfLatencyIsAtTarget", 10, 0.2, HPAScalerState{TargetLatency: 0.2, LatencyGain: 1}, 10},
+		{"DecreasesPodCountIfLatencyIsBelowTarget", 10, 0.1, HPAScalerState{TargetLatency: 0.2, LatencyGain: 1}, 5},
+		{"AddsDelta", 10, 0.2, HPAScalerState{TargetLatency: 0.2, LatencyGain: 1, Delta: 2}, 12},
+		{"NeverReturnsNegativePodCount", 10, 0.05, HPAScalerState{TargetLatency: 0.2, LatencyGain: 2}, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			// act
+			podCount := getMinPodCountBasedOnLatency(tc.currentReplicas, tc.latency, tc.desiredState)
+
+			assert.Equal(t, tc.expectedPodCount, podCount)
+		})
+	}
+}
+
+func TestGetMinimumReplicasLowerBound(t *testing.T) {
+	t.Run("ReturnsThreeByDefault", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{ScaleToZero: "false"}
+
+		// act
+		lowerBound := getMinimumReplicasLowerBound(context.Background(), fake.NewSimpleClientset(), hpa, &replicaSetsHolder{}, desiredState)
+
+		assert.Equal(t, int32(3), lowerBound)
+	})
+
+	t.Run("ReturnsZeroIfScaleToZeroIsEnabledForHPAAndController", func(t *testing.T) {
+
+		*scaleToZeroEnabled = true
+		defer func() { *scaleToZeroEnabled = false }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{ScaleToZero: "true"}
+
+		// act
+		lowerBound := getMinimumReplicasLowerBound(context.Background(), fake.NewSimpleClientset(), hpa, &replicaSetsHolder{}, desiredState)
+
+		assert.Equal(t, int32(0), lowerBound)
+	})
+
+	t.Run("IgnoresScaleToZeroIfNotEnabledForController", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{ScaleToZero: "true"}
+
+		// act
+		lowerBound := getMinimumReplicasLowerBound(context.Background(), fake.NewSimpleClientset(), hpa, &replicaSetsHolder{}, desiredState)
+
+		assert.Equal(t, int32(3), lowerBound)
+	})
+
+	t.Run("ReturnsLowerBoundOfHPAInsteadOfGlobalLowerBound", func(t *testing.T) {
+
+		os.Setenv("MINIMUM_REPLICAS_LOWER_BOUND", "3")
+		defer os.Unsetenv("MINIMUM_REPLICAS_LOWER_BOUND")
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-minimum-replicas-lower-bound": "1"}
+		otherHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		otherHPA.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+
+		// act
+		lowerBound := getMinimumReplicasLowerBound(context.Background(), fake.NewSimpleClientset(), hpa, &replicaSetsHolder{}, getDesiredHorizontalPodAutoscalerState(hpa))
+
+		assert.Equal(t, int32(1), lowerBound)
+		assert.Equal(t, int32(3), getMinimumReplicasLowerBound(context.Background(), fake.NewSimpleClientset(), otherHPA, &replicaSetsHolder{}, getDesiredHorizontalPodAutoscalerState(otherHPA)))
+	})
+
+	t.Run("ReturnsLowerBoundOfHPAInsteadOfLowerBoundOfNamespace", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-minimum-replicas-lower-bound": "2"}
+		kubeClient := fake.NewSimpleClientset(newTestNamespace(map[string]string{"estafette.io/hpa-scaler-minimum-replicas-lower-bound": "5"}))
+
+		// act
+		lowerBound := getMinimumReplicasLowerBound(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, getDesiredHorizontalPodAutoscalerState(hpa))
+
+		assert.Equal(t, int32(2), lowerBound)
+	})
+
+	t.Run("ReturnsLowerBoundOfNamespaceInsteadOfGlobalLowerBound", func(t *testing.T) {
+
+		os.Setenv("MINIMUM_REPLICAS_LOWER_BOUND", "4")
+		defer os.Unsetenv("MINIMUM_REPLICAS_LOWER_BOUND")
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+		kubeClient := fake.NewSimpleClientset(newTestNamespace(map[string]string{"estafette.io/hpa-scaler-minimum-replicas-lower-bound": "5"}))
+
+		// act
+		lowerBound := getMinimumReplicasLowerBound(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, getDesiredHorizontalPodAutoscalerState(hpa))
+
+		assert.Equal(t, int32(5), lowerBound)
+	})
+
+	t.Run("ReturnsGlobalLowerBoundIfNamespaceHasNone", func(t *testing.T) {
+
+		os.Setenv("MINIMUM_REPLICAS_LOWER_BOUND", "4")
+		defer os.Unsetenv("MINIMUM_REPLICAS_LOWER_BOUND")
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+		kubeClient := fake.NewSimpleClientset(newTestNamespace(nil))
+
+		// act
+		lowerBound := getMinimumReplicasLowerBound(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, getDesiredHorizontalPodAutoscalerState(hpa))
+
+		assert.Equal(t, int32(4), lowerBound)
+	})
+
+	t.Run("IgnoresInvalidLowerBoundOfNamespace", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+		kubeClient := fake.NewSimpleClientset(newTestNamespace(map[string]string{"estafette.io/hpa-scaler-minimum-replicas-lower-bound": "0"}))
+
+		// act
+		lowerBound := getMinimumReplicasLowerBound(context.Background(), kubeClient, hpa, &replicaSetsHolder{}, getDesiredHorizontalPodAutoscalerState(hpa))
+
+		assert.Equal(t, int32(3), lowerBound)
+	})
+
+	t.Run("RetrievesNamespaceOncePerIteration", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+		otherHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		otherHPA.Name = "my-other-app"
+		otherHPA.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+		kubeClient := fake.NewSimpleClientset(newTestNamespace(map[string]string{"estafette.io/hpa-scaler-minimum-replicas-lower-bound": "5"}))
+		replicaSets := &replicaSetsHolder{}
+
+		// act
+		lowerBound := getMinimumReplicasLowerBound(context.Background(), kubeClient, hpa, replicaSets, getDesiredHorizontalPodAutoscalerState(hpa))
+		otherLowerBound := getMinimumReplicasLowerBound(context.Background(), kubeClient, otherHPA, replicaSets, getDesiredHorizontalPodAutoscalerState(otherHPA))
+
+		assert.Equal(t, int32(5), lowerBound)
+		assert.Equal(t, int32(5), otherLowerBound)
+		assert.Equal(t, 1, len(kubeClient.Actions()))
+	})
+
+	t.Run("ReturnsErrorForLowerBoundOfHPABelowOne", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-minimum-replicas-lower-bound": "0"}
+
+		// act
+		state, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, 1, len(errs))
+		var parseError *ParseError
+		assert.True(t, errors.As(errs[0], &parseError))
+		assert.Equal(t, "estafette.io/hpa-scaler-minimum-replicas-lower-bound", parseError.Annotation)
+		assert.Equal(t, int32(3), getMinimumReplicasLowerBound(context.Background(), fake.NewSimpleClientset(), hpa, &replicaSetsHolder{}, state))
+	})
+}
+
+func TestApplyJitter(t *testing.T) {
+	t.Run("StaysWithinDeviationOfInput", func(t *testing.T) {
+
+		r = rand.New(rand.NewSource(1))
+
+		for i := 0; i < 1000; i++ {
+			// act
+			output := applyJitter(90)
+
+			assert.True(t, output >= 90-22, "output %v is below range", output)
+			assert.True(t, output < 90+22, "output %v is above range", output)
+		}
+	})
+
+	t.Run("IsReproducibleWithSameSeed", func(t *testing.T) {
+
+		r = rand.New(rand.NewSource(42))
+		first := []int{applyJitter(90), applyJitter(90), applyJitter(90)}
+		r = rand.New(rand.NewSource(42))
+
+		// act
+		second := []int{applyJitter(90), applyJitter(90), applyJitter(90)}
+
+		assert.Equal(t, first, second)
+	})
+}
+
+func TestIsDeploymentInProgress(t *testing.T) {
+	t.Run("ReturnsTrueIfMultipleReplicaSetsWithAppLabelAreNonEmpty", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 2),
+			newTestReplicaSet("my-app-2", map[string]string{"app": "my-app"}, "", 3),
+			newTestReplicaSet("other-app-1", map[string]string{"app": "other-app"}, "", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(), hpa, replicaSets, HPAScalerState{})
+
+		assert.True(t, inProgress)
+	})
+
+	t.Run("ReturnsFalseIfOnlyOneReplicaSetWithAppLabelIsNonEmpty", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 0),
+			newTestReplicaSet("my-app-2", map[string]string{"app": "my-app"}, "", 3),
+			newTestReplicaSet("other-app-1", map[string]string{"app": "other-app"}, "", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(), hpa, replicaSets, HPAScalerState{})
+
+		assert.False(t, inProgress)
+	})
+
+	t.Run("ReturnsTrueIfMultipleReplicaSetsOwnedByScaleTargetAreNonEmpty", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeOwnerReference
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-namespace", UID: "my-app-uid"}}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", nil, "my-app-uid", 2),
+			newTestReplicaSet("my-app-2", nil, "my-app-uid", 3),
+			newTestReplicaSet("other-app-1", nil, "other-app-uid", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(deployment), hpa, replicaSets, HPAScalerState{})
+
+		assert.True(t, inProgress)
+	})
+
+	t.Run("ReturnsFalseIfOnlyOneReplicaSetOwnedByScaleTargetIsNonEmpty", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeOwnerReference
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-namespace", UID: "my-app-uid"}}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", nil, "my-app-uid", 0),
+			newTestReplicaSet("my-app-2", nil, "my-app-uid", 3),
+			newTestReplicaSet("other-app-1", nil, "other-app-uid", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(deployment), hpa, replicaSets, HPAScalerState{})
+
+		assert.False(t, inProgress)
+	})
+
+	t.Run("ReturnsFalseIfScaleTargetDeploymentDoesNotExist", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeOwnerReference
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", nil, "my-app-uid", 2),
+			newTestReplicaSet("my-app-2", nil, "my-app-uid", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(), hpa, replicaSets, HPAScalerState{})
+
+		assert.False(t, inProgress)
+	})
+	t.Run("ReusesResultForHPAsWithSameAppLabel", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		otherHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		otherHPA.Name = "my-app-canary"
+		otherHPA.Labels = map[string]string{"app": "my-app"}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 2),
+			newTestReplicaSet("my-app-2", map[string]string{"app": "my-app"}, "", 3),
+		}}}
+		assert.True(t, isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(), hpa, replicaSets, HPAScalerState{}))
+		replicaSets.replicaSetList.Items[0].Status.Replicas = 0
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(), otherHPA, replicaSets, HPAScalerState{})
+
+		assert.True(t, inProgress)
+		assert.Equal(t, 1, len(replicaSets.deploymentsInProgress))
+	})
+
+	t.Run("RetrievesScaleTargetDeploymentOnceForHPAsWithSameScaleTarget", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeOwnerReference
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		otherHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		otherHPA.Name = "my-app-canary"
+		otherHPA.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-namespace", UID: "my-app-uid"}}
+		kubeClient := fake.NewSimpleClientset(deployment)
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", nil, "my-app-uid", 2),
+			newTestReplicaSet("my-app-2", nil, "my-app-uid", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), kubeClient, hpa, replicaSets, HPAScalerState{})
+		otherInProgress := isDeploymentInProgress(context.Background(), kubeClient, otherHPA, replicaSets, HPAScalerState{})
+
+		assert.True(t, inProgress)
+		assert.True(t, otherInProgress)
+		assert.Equal(t, 1, len(kubeClient.Actions()))
+	})
+
+	t.Run("DoesNotReuseResultForHPAsWithDifferentScaleTargets", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeOwnerReference
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		otherHPA := newTestHorizontalPodAutoscaler(3, 20, 10)
+		otherHPA.Name = "other-app"
+		otherHPA.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "other-app"}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-namespace", UID: "my-app-uid"}}
+		otherDeployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "other-app", Namespace: "my-namespace", UID: "other-app-uid"}}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", nil, "my-app-uid", 2),
+			newTestReplicaSet("my-app-2", nil, "my-app-uid", 3),
+			newTestReplicaSet("other-app-1", nil, "other-app-uid", 3),
+		}}}
+		kubeClient := fake.NewSimpleClientset(deployment, otherDeployment)
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), kubeClient, hpa, replicaSets, HPAScalerState{})
+		otherInProgress := isDeploymentInProgress(context.Background(), kubeClient, otherHPA, replicaSets, HPAScalerState{})
+
+		assert.True(t, inProgress)
+		assert.False(t, otherInProgress)
+	})
+
+	t.Run("ReturnsTrueIfReplicaSetOfOldRevisionIsNonEmptyInRevisionMode", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeRevision
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-namespace", UID: "my-app-uid", Annotations: map[string]string{"deployment.kubernetes.io/revision": "2"}}}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSetWithRevision("my-app-1", "my-app-uid", "1", 2),
+			newTestReplicaSetWithRevision("my-app-2", "my-app-uid", "2", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(deployment), hpa, replicaSets, HPAScalerState{})
+
+		assert.True(t, inProgress)
+	})
+
+	t.Run("ReturnsFalseIfReplicaSetsOfOldRevisionsAreEmptyInRevisionMode", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeRevision
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-namespace", UID: "my-app-uid", Annotations: map[string]string{"deployment.kubernetes.io/revision": "3"}}}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSetWithRevision("my-app-1", "my-app-uid", "1", 0),
+			newTestReplicaSetWithRevision("my-app-2", "my-app-uid", "2", 0),
+			newTestReplicaSetWithRevision("my-app-3", "my-app-uid", "3", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(deployment), hpa, replicaSets, HPAScalerState{})
+
+		assert.False(t, inProgress)
+	})
+
+	t.Run("IgnoresMultipleNonEmptyReplicaSetsOfCurrentRevisionInRevisionMode", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeRevision
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-namespace", UID: "my-app-uid", Annotations: map[string]string{"deployment.kubernetes.io/revision": "2"}}}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSetWithRevision("my-app-2a", "my-app-uid", "2", 2),
+			newTestReplicaSetWithRevision("my-app-2b", "my-app-uid", "2", 3),
+			newTestReplicaSetWithRevision("other-app-1", "other-app-uid", "1", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(deployment), hpa, replicaSets, HPAScalerState{})
+
+		assert.False(t, inProgress)
+	})
+
+	t.Run("ReturnsFalseIfNonEmptyReplicaSetsDoNotExceedThreshold", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-stable", map[string]string{"app": "my-app"}, "", 5),
+			newTestReplicaSet("my-app-canary", map[string]string{"app": "my-app"}, "", 1),
+		}}}
+		desiredState := HPAScalerState{DeploymentInProgressPredicate: deploymentInProgressPredicateReplicaSets, DeploymentInProgressReplicaSets: 2}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(), hpa, replicaSets, desiredState)
+
+		assert.False(t, inProgress)
+	})
+
+	t.Run("LooksUpScaleTargetForReadyReplicasPredicateInAppLabelMode", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		desiredReplicas := int32(5)
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-namespace", UID: "my-app-uid"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &desiredReplicas},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 4, UpdatedReplicas: 5},
+		}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 5),
+		}}}
+		desiredState := HPAScalerState{DeploymentInProgressPredicate: deploymentInProgressPredicateReadyReplicas}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(deployment), hpa, replicaSets, desiredState)
+
+		assert.True(t, inProgress)
+	})
+
+	t.Run("DoesNotReuseResultForHPAsWithDifferentPredicates", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-stable", map[string]string{"app": "my-app"}, "", 5),
+			newTestReplicaSet("my-app-canary", map[string]string{"app": "my-app"}, "", 1),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(), hpa, replicaSets, HPAScalerState{DeploymentInProgressReplicaSets: 1})
+		canaryInProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(), hpa, replicaSets, HPAScalerState{DeploymentInProgressReplicaSets: 2})
+
+		assert.True(t, inProgress)
+		assert.False(t, canaryInProgress)
+	})
+
+	t.Run("CountsNonEmptyReplicaSetsIfDeploymentHasNoRevisionInRevisionMode", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeRevision
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "my-app"}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "my-namespace", UID: "my-app-uid"}}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSetWithRevision("my-app-1", "my-app-uid", "1", 2),
+			newTestReplicaSetWithRevision("my-app-2", "my-app-uid", "2", 3),
+		}}}
+
+		// act
+		inProgress := isDeploymentInProgress(context.Background(), fake.NewSimpleClientset(deployment), hpa, replicaSets, HPAScalerState{})
+
+		assert.True(t, inProgress)
+	})
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	t.Run("RegistersMetricsUnderPrefix", func(t *testing.T) {
+
+		registry := prometheus.NewRegistry()
+		minReplicasVector.WithLabelValues("prefixed-app", "my-namespace").Set(4)
+		defer minReplicasVector.DeleteLabelValues("prefixed-app", "my-namespace")
+
+		// act
+		registerMetrics(registry, "platform_autoscaling_")
+
+		metricFamilies, err := registry.Gather()
+		assert.Nil(t, err)
+		helps := map[string]string{}
+		for _, metricFamily := range metricFamilies {
+			assert.True(t, strings.HasPrefix(metricFamily.GetName(), "platform_autoscaling_"), metricFamily.GetName())
+			helps[metricFamily.GetName()] = metricFamily.GetHelp()
+		}
+		assert.Equal(t, "The minimum number of replicas per hpa as set by this application.", helps["platform_autoscaling_min_replicas"])
+	})
+
+	t.Run("RegistersMetricsUnderDefaultPrefix", func(t *testing.T) {
+
+		registry := prometheus.NewRegistry()
+		minReplicasVector.WithLabelValues("prefixed-app", "my-namespace").Set(4)
+		defer minReplicasVector.DeleteLabelValues("prefixed-app", "my-namespace")
+
+		// act
+		registerMetrics(registry, getMetricPrefix())
+
+		metricFamilies, err := registry.Gather()
+		assert.Nil(t, err)
+		names := []string{}
+		for _, metricFamily := range metricFamilies {
+			names = append(names, metricFamily.GetName())
+		}
+		assert.Contains(t, names, "estafette_hpa_scaler_min_replicas")
+	})
+}
+
+func TestSetLogLevel(t *testing.T) {
+	t.Run("SuppressesDebugMessagesAtInfoLevel", func(t *testing.T) {
+
+		defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+		var buffer bytes.Buffer
+		logger := zerolog.New(&buffer)
+
+		// act
+		err := setLogLevel("info")
+
+		assert.Nil(t, err)
+		logger.Debug().Msg("debug message")
+		assert.Equal(t, "", buffer.String())
+		logger.Info().Msg("info message")
+		assert.Contains(t, buffer.String(), "info message")
+	})
+
+	t.Run("OutputsDebugMessagesAtDebugLevel", func(t *testing.T) {
+
+		defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+		var buffer bytes.Buffer
+		logger := zerolog.New(&buffer)
+
+		// act
+		err := setLogLevel("debug")
+
+		assert.Nil(t, err)
+		logger.Debug().Msg("debug message")
+		assert.Contains(t, buffer.String(), "debug message")
+	})
+
+	t.Run("ReturnsErrorForUnknownLevel", func(t *testing.T) {
+
+		defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+		// act
+		err := setLogLevel("chatty")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetPrometheusQueryURL(t *testing.T) {
+	t.Run("ReturnsInstantQueryURLIfRangeIsZero", func(t *testing.T) {
+
+		// act
+		queryURL := getPrometheusQueryURL("http://prometheus", "sum(rate(requests[5m]))", 0, 0, time.Unix(1513161148, 0))
+
+		assert.Equal(t, "http://prometheus/api/v1/query?query=sum%28rate%28requests%5B5m%5D%29%29", queryURL)
+	})
+
+	t.Run("ReturnsPointQueryURLWithTime", func(t *testing.T) {
+
+		// act
+		queryURL := getPrometheusPointQueryURL("http://prometheus", "sum(requests_total)", time.Unix(1513161148, 0))
+
+		assert.Equal(t, "http://prometheus/api/v1/query?query=sum%28requests_total%29&time=1513161148", queryURL)
+	})
+
+	t.Run("ReturnsInstantQueryURLWithPathPrefix", func(t *testing.T) {
+
+		// act
+		queryURL := getPrometheusQueryURL(getPrometheusBaseURL("http://ingress", "/prometheus"), "requests", 0, 0, time.Unix(1513161148, 0))
+
+		assert.Equal(t, "http://ingress/prometheus/api/v1/query?query=requests", queryURL)
+	})
+
+	t.Run("ReturnsRangeQueryURLWithStep", func(t *testing.T) {
+
+		// act
+		queryURL := getPrometheusQueryURL("http://prometheus", "requests", 600, 30, time.Unix(1513161148, 0))
+
+		parsedURL, err := url.Parse(queryURL)
+		assert.Nil(t, err)
+		assert.Equal(t, "/api/v1/query_range", parsedURL.Path)
+		assert.Equal(t, "requests", parsedURL.Query().Get("query"))
+		assert.Equal(t, "1513160520", parsedURL.Query().Get("start"))
+		assert.Equal(t, "1513161120", parsedURL.Query().Get("end"))
+		assert.Equal(t, "30", parsedURL.Query().Get("step"))
+	})
+
+	t.Run("ReturnsRangeQueryURLWithDefaultStepIfStepIsNotSet", func(t *testing.T) {
+
+		// act
+		queryURL := getPrometheusQueryURL("http://prometheus", "requests", 600, 0, time.Unix(1513161148, 0))
+
+		parsedURL, err := url.Parse(queryURL)
+		assert.Nil(t, err)
+		assert.Equal(t, "60", parsedURL.Query().Get("step"))
+		assert.Equal(t, "1513161120", parsedURL.Query().Get("end"))
+	})
+
+	t.Run("ReturnsRangeQueryURLWithDefaultStepIfStepIsLargerThanRange", func(t *testing.T) {
+
+		// act
+		queryURL := getPrometheusQueryURL("http://prometheus", "requests", 600, 900, time.Unix(1513161148, 0))
+
+		parsedURL, err := url.Parse(queryURL)
+		assert.Nil(t, err)
+		assert.Equal(t, "60", parsedURL.Query().Get("step"))
+	})
+
+	t.Run("ReturnsRangeQueryURLWithDefaultStepIfStepResultsInTooManyPoints", func(t *testing.T) {
+
+		// act
+		queryURL := getPrometheusQueryURL("http://prometheus", "requests", 86400, 1, time.Unix(1513161148, 0))
+
+		parsedURL, err := url.Parse(queryURL)
+		assert.Nil(t, err)
+		assert.Equal(t, "8640", parsedURL.Query().Get("step"))
+	})
+}
+
+func TestValidateReplicas(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		minReplicas               int32
+		maxReplicas               int32
+		minimumReplicasLowerBound int32
+		valid                     bool
+	}{
+		{"MinReplicasBelowMaxReplicas", 3, 20, 3, true},
+		{"MinReplicasEqualToMaxReplicas", 20, 20, 3, true},
+		{"MinReplicasAboveMaxReplicas", 21, 20, 3, false},
+		{"ZeroMinReplicas", 0, 20, 3, false},
+		{"ZeroMinReplicasWhenScalingToZero", 0, 20, 0, true},
+		{"NegativeMinReplicas", -1, 20, 0, false},
+		{"NegativeMaxReplicas", 3, -2147483648, 3, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			hpa := newTestHorizontalPodAutoscaler(tc.minReplicas, tc.maxReplicas, 10)
+
+			// act
+			err := validateReplicas(hpa, tc.minimumReplicasLowerBound)
+
+			assert.Equal(t, tc.valid, err == nil)
+		})
+	}
+
+	t.Run("ReturnsErrorIfMinReplicasIsMissing", func(t *testing.T) {
+
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Spec.MinReplicas = nil
+
+		// act
+		err := validateReplicas(hpa, 3)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetPrometheusBaseURL(t *testing.T) {
+	testCases := []struct {
+		name            string
+		serverURL       string
+		pathPrefix      string
+		expectedBaseURL string
+	}{
+		{"WithoutPrefix", "http://prometheus", "", "http://prometheus"},
+		{"WithPrefix", "http://ingress", "/prometheus", "http://ingress/prometheus"},
+		{"WithPrefixWithoutLeadingSlash", "http://ingress", "prometheus", "http://ingress/prometheus"},
+		{"WithPrefixWithTrailingSlashes", "http://ingress/", "/prometheus/", "http://ingress/prometheus"},
+		{"WithSlashAsPrefix", "http://prometheus", "/", "http://prometheus"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			// act
+			baseURL := getPrometheusBaseURL(tc.serverURL, tc.pathPrefix)
+
+			assert.Equal(t, tc.expectedBaseURL, baseURL)
+		})
+	}
+}
+
+func TestGetPrometheusQueryResponse(t *testing.T) {
+	t.Run("SendsUserAgentWithVersion", func(t *testing.T) {
+
+		defer func(originalVersion string) { version = originalVersion }(version)
+		version = "1.2.3"
+		userAgent := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent = r.UserAgent()
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		}))
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+
+		// act
+		_, err := getPrometheusQueryResponse(context.Background(), hpa, server.URL+"/api/v1/query?query=requests")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "estafette-k8s-hpa-scaler/1.2.3", userAgent)
+	})
+
+	t.Run("SendsUserAgentOverride", func(t *testing.T) {
+
+		*prometheusUserAgent = "my-scaler"
+		defer func() { *prometheusUserAgent = "" }()
+		userAgent := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent = r.UserAgent()
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		}))
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+
+		// act
+		_, err := getPrometheusQueryResponse(context.Background(), hpa, server.URL+"/api/v1/query?query=requests")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "my-scaler", userAgent)
+	})
+}
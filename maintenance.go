@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maintenanceWindow is a daily time range in utc during which hpas aren't updated, as offsets since midnight; it wraps past midnight if end is before start
+type maintenanceWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// the maintenance windows parsed from --maintenance-window
+var maintenanceWindows []maintenanceWindow
+
+// Parses comma-separated daily time ranges like 22:00-02:00
+func parseMaintenanceWindows(value string) (windows []maintenanceWindow, err error) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Maintenance window %v is invalid: should be start-end, like 22:00-02:00", item)
+		}
+
+		start, err := parseTimeOfDay(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("Maintenance window %v has invalid start: %v", item, err)
+		}
+		end, err := parseTimeOfDay(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Maintenance window %v has invalid end: %v", item, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("Maintenance window %v is invalid: start and end should differ", item)
+		}
+
+		windows = append(windows, maintenanceWindow{start: start, end: end})
+	}
+
+	return windows, nil
+}
+
+// Parses a time of day like 22:00 into the offset since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("should be hh:mm")
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Returns whether now falls within any of the maintenance windows, including their start and excluding their end
+func isInMaintenanceWindow(windows []maintenanceWindow, now time.Time) bool {
+	now = now.UTC()
+	sinceMidnight := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+
+	for _, window := range windows {
+		if window.start < window.end {
+			if sinceMidnight >= window.start && sinceMidnight < window.end {
+				return true
+			}
+		} else if sinceMidnight >= window.start || sinceMidnight < window.end {
+			return true
+		}
+	}
+
+	return false
+}
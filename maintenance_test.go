@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMaintenanceWindows(t *testing.T) {
+	t.Run("ReturnsWindowsAsOffsetsSinceMidnight", func(t *testing.T) {
+
+		// act
+		windows, err := parseMaintenanceWindows("22:00-02:00, 12:00-12:30,")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []maintenanceWindow{{start: 22 * time.Hour, end: 2 * time.Hour}, {start: 12 * time.Hour, end: 12*time.Hour + 30*time.Minute}}, windows)
+	})
+
+	t.Run("ReturnsNoWindowsForEmptyValue", func(t *testing.T) {
+
+		// act
+		windows, err := parseMaintenanceWindows("")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(windows))
+	})
+
+	t.Run("ReturnsErrorIfWindowHasNoEnd", func(t *testing.T) {
+
+		// act
+		_, err := parseMaintenanceWindows("22:00")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfTimeIsInvalid", func(t *testing.T) {
+
+		// act
+		_, err := parseMaintenanceWindows("22:00-25:00")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfStartEqualsEnd", func(t *testing.T) {
+
+		// act
+		_, err := parseMaintenanceWindows("02:00-02:00")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestIsInMaintenanceWindow(t *testing.T) {
+	windows := []maintenanceWindow{{start: 22 * time.Hour, end: 2 * time.Hour}, {start: 12 * time.Hour, end: 12*time.Hour + 30*time.Minute}}
+
+	t.Run("ReturnsTrueInsideWindow", func(t *testing.T) {
+
+		// act
+		inWindow := isInMaintenanceWindow(windows, time.Date(2020, 3, 1, 12, 15, 0, 0, time.UTC))
+
+		assert.True(t, inWindow)
+	})
+
+	t.Run("ReturnsTrueInsideWindowWrappingPastMidnight", func(t *testing.T) {
+
+		assert.True(t, isInMaintenanceWindow(windows, time.Date(2020, 3, 1, 23, 0, 0, 0, time.UTC)))
+		assert.True(t, isInMaintenanceWindow(windows, time.Date(2020, 3, 2, 1, 59, 0, 0, time.UTC)))
+	})
+
+	t.Run("ReturnsFalseOutsideWindows", func(t *testing.T) {
+
+		assert.False(t, isInMaintenanceWindow(windows, time.Date(2020, 3, 1, 2, 0, 0, 0, time.UTC)))
+		assert.False(t, isInMaintenanceWindow(windows, time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC)))
+		assert.False(t, isInMaintenanceWindow(windows, time.Date(2020, 3, 1, 21, 59, 0, 0, time.UTC)))
+	})
+
+	t.Run("ComparesTimeOfDayInUTC", func(t *testing.T) {
+
+		amsterdam := time.FixedZone("CET", 3600)
+
+		// act
+		inWindow := isInMaintenanceWindow(windows, time.Date(2020, 3, 1, 13, 15, 0, 0, amsterdam))
+
+		assert.True(t, inWindow)
+	})
+
+	t.Run("ReturnsFalseWithoutWindows", func(t *testing.T) {
+
+		// act
+		inWindow := isInMaintenanceWindow(nil, time.Date(2020, 3, 1, 12, 15, 0, 0, time.UTC))
+
+		assert.False(t, inWindow)
+	})
+}
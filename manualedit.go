@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// manualEditTracker remembers when a manual edit of minReplicas was first noticed per hpa, so it can be respected for a while before reconciling again
+type manualEditTracker struct {
+	mutex      sync.Mutex
+	detectedAt map[string]time.Time
+}
+
+func newManualEditTracker() *manualEditTracker {
+	return &manualEditTracker{
+		detectedAt: map[string]time.Time{},
+	}
+}
+
+// Detect returns when the manual edit for key was first noticed, recording now if it's new
+func (t *manualEditTracker) Detect(key string, now time.Time) time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	detectedAt, ok := t.detectedAt[key]
+	if !ok {
+		detectedAt = now
+		t.detectedAt[key] = detectedAt
+	}
+
+	return detectedAt
+}
+
+// Forget removes the manual edit for key, once minReplicas matches the last value written by this application again
+func (t *manualEditTracker) Forget(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.detectedAt, key)
+}
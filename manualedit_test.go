@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManualEditTracker(t *testing.T) {
+	t.Run("ReturnsTimeOfFirstDetection", func(t *testing.T) {
+
+		tracker := newManualEditTracker()
+		first := time.Date(2019, 12, 13, 10, 0, 0, 0, time.UTC)
+		tracker.Detect("my-namespace/my-app", first)
+
+		// act
+		detectedAt := tracker.Detect("my-namespace/my-app", first.Add(time.Minute))
+
+		assert.Equal(t, first, detectedAt)
+	})
+
+	t.Run("ReturnsNewTimeAfterForget", func(t *testing.T) {
+
+		tracker := newManualEditTracker()
+		first := time.Date(2019, 12, 13, 10, 0, 0, 0, time.UTC)
+		tracker.Detect("my-namespace/my-app", first)
+		tracker.Forget("my-namespace/my-app")
+
+		// act
+		detectedAt := tracker.Detect("my-namespace/my-app", first.Add(time.Minute))
+
+		assert.Equal(t, first.Add(time.Minute), detectedAt)
+	})
+}
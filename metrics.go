@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// Returns a mux serving only /metrics; the default mux isn't used, since importing net/http/pprof registers the profiles on it
+func newMetricsServeMux() *http.ServeMux {
+	serverMux := http.NewServeMux()
+	serverMux.Handle("/metrics", promhttp.Handler())
+
+	return serverMux
+}
+
+// Initializes the /metrics endpoint on the specified port, replacing foundation.InitMetricsWithPort to keep the pprof profiles off it
+func initMetrics(port int) {
+	go func() {
+		portString := fmt.Sprintf(":%v", port)
+		log.Debug().
+			Str("port", portString).
+			Msg("Serving Prometheus metrics...")
+
+		if err := http.ListenAndServe(portString, newMetricsServeMux()); err != nil {
+			log.Fatal().Err(err).Msg("Starting Prometheus listener failed")
+		}
+	}()
+}
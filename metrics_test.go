@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMetricsServeMux(t *testing.T) {
+	t.Run("ServesMetrics", func(t *testing.T) {
+
+		recorder := httptest.NewRecorder()
+
+		// act
+		newMetricsServeMux().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "go_goroutines")
+	})
+
+	t.Run("DoesNotServePprofProfiles", func(t *testing.T) {
+
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine", "/debug/pprof/heap"} {
+			recorder := httptest.NewRecorder()
+
+			// act
+			newMetricsServeMux().ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+
+			assert.Equal(t, http.StatusNotFound, recorder.Code, path)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog/log"
+)
+
+// the metrics mirrored to the otlp endpoint, by their name without the metric prefix
+var otlpMetricNames = map[string]bool{
+	"totals":          true,
+	"min_replicas":    true,
+	"actual_replicas": true,
+	"request_rate":    true,
+}
+
+// used as start time of the cumulative sums
+var otlpStartTime = time.Now()
+
+// OTLPMetricsRequest is used to marshal an otlp metrics export request with the json encoding of otlp/http
+type OTLPMetricsRequest struct {
+	ResourceMetrics []OTLPResourceMetrics `json:"resourceMetrics"`
+}
+
+// OTLPResourceMetrics is used to marshal an otlp metrics export request
+type OTLPResourceMetrics struct {
+	Resource     OTLPResource       `json:"resource"`
+	ScopeMetrics []OTLPScopeMetrics `json:"scopeMetrics"`
+}
+
+// OTLPResource is used to marshal an otlp metrics export request
+type OTLPResource struct {
+	Attributes []OTLPAttribute `json:"attributes"`
+}
+
+// OTLPScopeMetrics is used to marshal an otlp metrics export request
+type OTLPScopeMetrics struct {
+	Scope   OTLPScope    `json:"scope"`
+	Metrics []OTLPMetric `json:"metrics"`
+}
+
+// OTLPScope is used to marshal an otlp metrics export request
+type OTLPScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// OTLPMetric is used to marshal an otlp metrics export request; either Gauge or Sum is set
+type OTLPMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *OTLPGauge `json:"gauge,omitempty"`
+	Sum         *OTLPSum   `json:"sum,omitempty"`
+}
+
+// OTLPGauge is used to marshal an otlp metrics export request
+type OTLPGauge struct {
+	DataPoints []OTLPNumberDataPoint `json:"dataPoints"`
+}
+
+// OTLPSum is used to marshal an otlp metrics export request
+type OTLPSum struct {
+	DataPoints             []OTLPNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+// OTLPNumberDataPoint is used to marshal an otlp metrics export request; the timestamps are fixed64 and thus strings in json
+type OTLPNumberDataPoint struct {
+	Attributes        []OTLPAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+// OTLPAttribute is used to marshal an otlp metrics export request
+type OTLPAttribute struct {
+	Key   string       `json:"key"`
+	Value OTLPAnyValue `json:"value"`
+}
+
+// OTLPAnyValue is used to marshal an otlp metrics export request
+type OTLPAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// otlp aggregation temporality for sums that keep accumulating since the start of the application
+const otlpAggregationTemporalityCumulative = 2
+
+// Returns the otlp export request for the mirrored metrics in the gathered metric families
+func getOTLPMetricsRequest(metricFamilies []*dto.MetricFamily, now time.Time) OTLPMetricsRequest {
+	serviceName := app
+	if serviceName == "" {
+		serviceName = "estafette-k8s-hpa-scaler"
+	}
+
+	timeUnixNano := strconv.FormatInt(now.UnixNano(), 10)
+	startTimeUnixNano := strconv.FormatInt(otlpStartTime.UnixNano(), 10)
+
+	metrics := []OTLPMetric{}
+	for _, metricFamily := range metricFamilies {
+		if !strings.HasPrefix(metricFamily.GetName(), getMetricPrefix()) || !otlpMetricNames[strings.TrimPrefix(metricFamily.GetName(), getMetricPrefix())] {
+			continue
+		}
+
+		metric := OTLPMetric{
+			Name:        metricFamily.GetName(),
+			Description: metricFamily.GetHelp(),
+		}
+
+		dataPoints := []OTLPNumberDataPoint{}
+		for _, m := range metricFamily.GetMetric() {
+			dataPoint := OTLPNumberDataPoint{
+				TimeUnixNano: timeUnixNano,
+			}
+			for _, label := range m.GetLabel() {
+				dataPoint.Attributes = append(dataPoint.Attributes, OTLPAttribute{Key: label.GetName(), Value: OTLPAnyValue{StringValue: label.GetValue()}})
+			}
+
+			switch metricFamily.GetType() {
+			case dto.MetricType_COUNTER:
+				dataPoint.StartTimeUnixNano = startTimeUnixNano
+				dataPoint.AsDouble = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				dataPoint.AsDouble = m.GetGauge().GetValue()
+			default:
+				continue
+			}
+
+			dataPoints = append(dataPoints, dataPoint)
+		}
+
+		if metricFamily.GetType() == dto.MetricType_COUNTER {
+			metric.Sum = &OTLPSum{DataPoints: dataPoints, AggregationTemporality: otlpAggregationTemporalityCumulative, IsMonotonic: true}
+		} else {
+			metric.Gauge = &OTLPGauge{DataPoints: dataPoints}
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return OTLPMetricsRequest{
+		ResourceMetrics: []OTLPResourceMetrics{
+			{
+				Resource: OTLPResource{
+					Attributes: []OTLPAttribute{
+						{Key: "service.name", Value: OTLPAnyValue{StringValue: serviceName}},
+						{Key: "service.version", Value: OTLPAnyValue{StringValue: version}},
+					},
+				},
+				ScopeMetrics: []OTLPScopeMetrics{
+					{
+						Scope:   OTLPScope{Name: serviceName, Version: version},
+						Metrics: metrics,
+					},
+				},
+			},
+		},
+	}
+}
+
+// Gathers the mirrored metrics and posts them to the otlp/http metrics endpoint
+func exportMetricsToOTLP(ctx context.Context, gatherer prometheus.Gatherer, endpoint string, now time.Time) error {
+	metricFamilies, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(getOTLPMetricsRequest(metricFamilies, now))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		responseBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Otlp endpoint %v responded with status %v: %v", endpoint, resp.StatusCode, string(responseBody))
+	}
+
+	return nil
+}
+
+// Initializes the periodic export of the metrics to the otlp/http metrics endpoint, until the context is cancelled
+func initOTLPExport(ctx context.Context, endpoint string, interval time.Duration) {
+	go func() {
+		log.Debug().
+			Str("endpoint", endpoint).
+			Msg("Exporting metrics to otlp endpoint...")
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				if err := exportMetricsToOTLP(ctx, prometheus.DefaultGatherer, endpoint, now); err != nil {
+					log.Warn().Err(err).Msgf("Exporting metrics to otlp endpoint %v failed", endpoint)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
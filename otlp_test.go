@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestOTLPReceiver stores the export requests it receives
+func newTestOTLPReceiver(requests *[]OTLPMetricsRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request OTLPMetricsRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*requests = append(*requests, request)
+	}))
+}
+
+func findOTLPMetric(request OTLPMetricsRequest, name string) *OTLPMetric {
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if metric.Name == name {
+			return &metric
+		}
+	}
+	return nil
+}
+
+func TestExportMetricsToOTLP(t *testing.T) {
+	t.Run("ExportsGaugesAndCounters", func(t *testing.T) {
+
+		registry := prometheus.NewRegistry()
+		registerMetrics(registry, defaultMetricPrefix)
+		minReplicasVector.WithLabelValues("otlp-app", "my-namespace").Set(8)
+		hpaTotals.WithLabelValues("my-namespace", "succeeded", "updated", "otlp").Add(2)
+		requests := []OTLPMetricsRequest{}
+		receiver := newTestOTLPReceiver(&requests)
+		defer receiver.Close()
+
+		// act
+		err := exportMetricsToOTLP(context.Background(), registry, receiver.URL+"/v1/metrics", time.Unix(1513161148, 0))
+
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(requests)) {
+			minReplicas := findOTLPMetric(requests[0], "estafette_hpa_scaler_min_replicas")
+			if assert.NotNil(t, minReplicas) && assert.NotNil(t, minReplicas.Gauge) {
+				assert.Contains(t, minReplicas.Gauge.DataPoints, OTLPNumberDataPoint{
+					Attributes:   []OTLPAttribute{{Key: "hpa", Value: OTLPAnyValue{StringValue: "otlp-app"}}, {Key: "namespace", Value: OTLPAnyValue{StringValue: "my-namespace"}}},
+					TimeUnixNano: "1513161148000000000",
+					AsDouble:     8,
+				})
+			}
+
+			totals := findOTLPMetric(requests[0], "estafette_hpa_scaler_totals")
+			if assert.NotNil(t, totals) && assert.NotNil(t, totals.Sum) {
+				assert.True(t, totals.Sum.IsMonotonic)
+				assert.Equal(t, otlpAggregationTemporalityCumulative, totals.Sum.AggregationTemporality)
+				assert.NotEmpty(t, totals.Sum.DataPoints)
+			}
+
+			assert.Nil(t, findOTLPMetric(requests[0], "estafette_hpa_scaler_build_info"))
+		}
+	})
+
+	t.Run("ReturnsErrorIfEndpointRejectsRequest", func(t *testing.T) {
+
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer receiver.Close()
+
+		// act
+		err := exportMetricsToOTLP(context.Background(), prometheus.NewRegistry(), receiver.URL+"/v1/metrics", time.Now())
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Returns a mux serving the pprof handlers; net/http/pprof registers them on the default mux as well, which is why no listener serves that one
+func newPprofServeMux() *http.ServeMux {
+	serverMux := http.NewServeMux()
+	serverMux.HandleFunc("/debug/pprof/", pprof.Index)
+	serverMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	serverMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	serverMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	serverMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return serverMux
+}
+
+// Initializes the /debug/pprof endpoints on the specified port
+func initPprof(port int) {
+	go func() {
+		portString := fmt.Sprintf(":%v", port)
+		log.Debug().
+			Str("port", portString).
+			Msg("Serving /debug/pprof endpoints...")
+
+		if err := http.ListenAndServe(portString, newPprofServeMux()); err != nil {
+			log.Fatal().Err(err).Msg("Starting /debug/pprof listener failed")
+		}
+	}()
+}
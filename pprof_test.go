@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPprofServeMux(t *testing.T) {
+	t.Run("ServesGoroutineProfile", func(t *testing.T) {
+
+		recorder := httptest.NewRecorder()
+
+		// act
+		newPprofServeMux().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "goroutine profile")
+	})
+
+	t.Run("ServesHeapProfile", func(t *testing.T) {
+
+		recorder := httptest.NewRecorder()
+
+		// act
+		newPprofServeMux().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/heap", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+}
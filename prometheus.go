@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"strconv"
 
 	"github.com/rs/zerolog/log"
@@ -10,9 +12,11 @@ import (
 
 // PrometheusQueryResponseDataResult is used to unmarshal the response from a prometheus query
 // {"metric":{"location":"@searchfareapi_gcloud"},"value":[1513161148.757,"225.4068155675859"]}
+// {"metric":{"location":"@searchfareapi_gcloud"},"values":[[1513161088.757,"219.3"],[1513161148.757,"225.4068155675859"]]} for range queries
 type PrometheusQueryResponseDataResult struct {
-	Metric interface{}   `json:"metric"`
-	Value  []interface{} `json:"value"`
+	Metric interface{}     `json:"metric"`
+	Value  []interface{}   `json:"value"`
+	Values [][]interface{} `json:"values"`
 }
 
 // PrometheusQueryResponseData is used to unmarshal the response from a prometheus query
@@ -42,13 +46,119 @@ func UnmarshalPrometheusQueryResponse(responseBody []byte) (queryResponse Promet
 	return
 }
 
-// GetRequestRate converts the string value into a float64
-func (pqr *PrometheusQueryResponse) GetRequestRate() (float64, error) {
-	if pqr == nil || len(pqr.Data.Result) == 0 || len(pqr.Data.Result[0].Value) < 2 {
-		return 0, errors.New("The request metric is missing from the query result")
+// GetValue converts the string value into a float64, whether it's a request rate, a gauge like the number of active sessions or any other number;
+// for range queries it returns the maximum value within the range
+func (pqr *PrometheusQueryResponse) GetValue() (float64, error) {
+	if pqr == nil || len(pqr.Data.Result) == 0 {
+		return 0, errors.New("The metric is missing from the query result")
 	}
 
-	f, err := strconv.ParseFloat(pqr.Data.Result[0].Value[1].(string), 64)
+	return pqr.Data.Result[0].getValue(pqr.Data.ResultType)
+}
+
+// GetValues converts the string value of each result series into a float64; for range queries it returns the maximum value within the range per series
+func (pqr *PrometheusQueryResponse) GetValues() ([]float64, error) {
+	if pqr == nil || len(pqr.Data.Result) == 0 {
+		return nil, errors.New("The metric is missing from the query result")
+	}
+
+	values := make([]float64, len(pqr.Data.Result))
+	for i, result := range pqr.Data.Result {
+		f, err := result.getValue(pqr.Data.ResultType)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = f
+	}
+
+	return values, nil
+}
+
+// GetCounterRates returns the per second increase of each counter series since the earlier response, matching series by their labels; a decrease is treated as a counter reset
+func (pqr *PrometheusQueryResponse) GetCounterRates(earlier PrometheusQueryResponse, intervalSeconds float64) ([]float64, error) {
+	if pqr == nil || len(pqr.Data.Result) == 0 || len(earlier.Data.Result) == 0 {
+		return nil, errors.New("The request metric is missing from the counter query result")
+	}
+
+	earlierValues := map[string]float64{}
+	for _, result := range earlier.Data.Result {
+		f, err := result.getValue(earlier.Data.ResultType)
+		if err != nil {
+			return nil, err
+		}
+		earlierValues[fmt.Sprint(result.Metric)] = f
+	}
+
+	counterRates := []float64{}
+	for _, result := range pqr.Data.Result {
+		earlierValue, ok := earlierValues[fmt.Sprint(result.Metric)]
+		if !ok {
+			// a series that only just appeared has no increase to compute yet
+			continue
+		}
+
+		f, err := result.getValue(pqr.Data.ResultType)
+		if err != nil {
+			return nil, err
+		}
+
+		increase := f - earlierValue
+		if increase < 0 {
+			increase = f
+		}
+		counterRates = append(counterRates, increase/intervalSeconds)
+	}
+
+	if len(counterRates) == 0 {
+		return nil, errors.New("None of the counter series are present in both counter query results")
+	}
+
+	return counterRates, nil
+}
+
+func (result *PrometheusQueryResponseDataResult) getValue(resultType string) (float64, error) {
+	if resultType == "matrix" {
+		return result.getMaxRangeValue()
+	}
+
+	if len(result.Value) == 0 {
+		return 0, errors.New("The metric is missing from the query result")
+	}
+
+	return parseSampleValue(result.Value)
+}
+
+// parseSampleValue returns the first string in the sample that parses as a float, instead of assuming [timestamp, "value"], to cope with proxies that structure samples differently
+func parseSampleValue(sample []interface{}) (float64, error) {
+	for _, v := range sample {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(s, 64)
+		if err == nil {
+			return f, nil
+		}
+	}
+
+	return 0, fmt.Errorf("The query result sample %v has no value that can be parsed as a float", sample)
+}
+
+func (result *PrometheusQueryResponseDataResult) getMaxRangeValue() (float64, error) {
+	if len(result.Values) == 0 {
+		return 0, errors.New("The metric is missing from the range query result")
+	}
+
+	max := math.Inf(-1)
+	for _, value := range result.Values {
+		f, err := parseSampleValue(value)
+		if err != nil {
+			return 0, err
+		}
+
+		max = math.Max(max, f)
+	}
 
-	return f, err
+	return max, nil
 }
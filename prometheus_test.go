@@ -22,7 +22,7 @@ func TestUnmarshalPrometheusQueryResponse(t *testing.T) {
 	})
 }
 
-func TestGetRequestRate(t *testing.T) {
+func TestGetValue(t *testing.T) {
 	t.Run("ReturnsQueryValueAsFloat64", func(t *testing.T) {
 
 		queryResponse := PrometheusQueryResponse{
@@ -39,7 +39,7 @@ func TestGetRequestRate(t *testing.T) {
 		}
 
 		// act
-		floatValue, err := queryResponse.GetRequestRate()
+		floatValue, err := queryResponse.GetValue()
 
 		assert.Nil(t, err)
 		assert.Equal(t, 225.4068155675859, floatValue)
@@ -54,7 +54,7 @@ func TestGetRequestRate(t *testing.T) {
 		}
 
 		// act
-		_, err := queryResponse.GetRequestRate()
+		_, err := queryResponse.GetValue()
 
 		assert.NotNil(t, err)
 	})
@@ -72,7 +72,248 @@ func TestGetRequestRate(t *testing.T) {
 		}
 
 		// act
-		_, err := queryResponse.GetRequestRate()
+		_, err := queryResponse.GetValue()
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsFirstValueThatParsesAsFloat64", func(t *testing.T) {
+
+		queryResponse := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{
+						Value: []interface{}{
+							"my-proxy",
+							1513161148.757,
+							"225.4068155675859",
+						},
+					},
+				},
+			},
+		}
+
+		// act
+		floatValue, err := queryResponse.GetValue()
+
+		assert.Nil(t, err)
+		assert.Equal(t, 225.4068155675859, floatValue)
+	})
+
+	t.Run("ReturnsErrorIfNoValueParsesAsFloat64", func(t *testing.T) {
+
+		queryResponse := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{
+						Value: []interface{}{
+							1513161148.757,
+							"not-a-number",
+							map[string]interface{}{"value": "225.4"},
+						},
+					},
+				},
+			},
+		}
+
+		// act
+		_, err := queryResponse.GetValue()
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "no value that can be parsed as a float")
+	})
+}
+
+func TestGetValueForRangeQuery(t *testing.T) {
+	t.Run("ReturnsMaximumValueAsFloat64", func(t *testing.T) {
+
+		queryResponse := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				ResultType: "matrix",
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{
+						Values: [][]interface{}{
+							[]interface{}{1513161088.757, "219.3"},
+							[]interface{}{1513161118.757, "230.5"},
+							[]interface{}{1513161148.757, "225.4068155675859"},
+						},
+					},
+				},
+			},
+		}
+
+		// act
+		floatValue, err := queryResponse.GetValue()
+
+		assert.Nil(t, err)
+		assert.Equal(t, 230.5, floatValue)
+	})
+
+	t.Run("ReturnsErrorIfValuesAreMissing", func(t *testing.T) {
+
+		queryResponse := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				ResultType: "matrix",
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{
+						Values: [][]interface{}{},
+					},
+				},
+			},
+		}
+
+		// act
+		_, err := queryResponse.GetValue()
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetValues(t *testing.T) {
+	t.Run("ReturnsValueOfEachSeriesAsFloat64", func(t *testing.T) {
+
+		queryResponse := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				ResultType: "vector",
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{
+						Value: []interface{}{1513161148.757, "15"},
+					},
+					PrometheusQueryResponseDataResult{
+						Value: []interface{}{1513161148.757, "25.5"},
+					},
+				},
+			},
+		}
+
+		// act
+		floatValues, err := queryResponse.GetValues()
+
+		assert.Nil(t, err)
+		assert.Equal(t, []float64{15, 25.5}, floatValues)
+	})
+
+	t.Run("ReturnsMaximumValueOfEachSeriesForRangeQuery", func(t *testing.T) {
+
+		queryResponse := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				ResultType: "matrix",
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{
+						Values: [][]interface{}{
+							[]interface{}{1513161088.757, "10"},
+							[]interface{}{1513161148.757, "12"},
+						},
+					},
+					PrometheusQueryResponseDataResult{
+						Values: [][]interface{}{
+							[]interface{}{1513161088.757, "30"},
+							[]interface{}{1513161148.757, "20"},
+						},
+					},
+				},
+			},
+		}
+
+		// act
+		floatValues, err := queryResponse.GetValues()
+
+		assert.Nil(t, err)
+		assert.Equal(t, []float64{12, 30}, floatValues)
+	})
+
+	t.Run("ReturnsErrorIfValueOfAnySeriesIsMissing", func(t *testing.T) {
+
+		queryResponse := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{
+						Value: []interface{}{1513161148.757, "15"},
+					},
+					PrometheusQueryResponseDataResult{
+						Value: []interface{}{},
+					},
+				},
+			},
+		}
+
+		// act
+		_, err := queryResponse.GetValues()
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetCounterRates(t *testing.T) {
+	t.Run("ReturnsIncreasePerSecondOfEachSeries", func(t *testing.T) {
+
+		earlier := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{Metric: map[string]interface{}{"region": "a"}, Value: []interface{}{1513161088.757, "1000"}},
+					PrometheusQueryResponseDataResult{Metric: map[string]interface{}{"region": "b"}, Value: []interface{}{1513161088.757, "500"}},
+				},
+			},
+		}
+		later := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{Metric: map[string]interface{}{"region": "b"}, Value: []interface{}{1513161148.757, "800"}},
+					PrometheusQueryResponseDataResult{Metric: map[string]interface{}{"region": "a"}, Value: []interface{}{1513161148.757, "1600"}},
+				},
+			},
+		}
+
+		// act
+		floatValues, err := later.GetCounterRates(earlier, 60)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []float64{5, 10}, floatValues)
+	})
+
+	t.Run("TreatsDecreaseAsCounterReset", func(t *testing.T) {
+
+		earlier := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{Value: []interface{}{1513161088.757, "1000"}},
+				},
+			},
+		}
+		later := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{Value: []interface{}{1513161148.757, "120"}},
+				},
+			},
+		}
+
+		// act
+		floatValues, err := later.GetCounterRates(earlier, 60)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []float64{2}, floatValues)
+	})
+
+	t.Run("ReturnsErrorIfNoSeriesIsInBothResults", func(t *testing.T) {
+
+		earlier := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{Metric: map[string]interface{}{"region": "a"}, Value: []interface{}{1513161088.757, "1000"}},
+				},
+			},
+		}
+		later := PrometheusQueryResponse{
+			Data: PrometheusQueryResponseData{
+				Result: []PrometheusQueryResponseDataResult{
+					PrometheusQueryResponseDataResult{Metric: map[string]interface{}{"region": "b"}, Value: []interface{}{1513161148.757, "1600"}},
+				},
+			},
+		}
+
+		// act
+		_, err := later.GetCounterRates(earlier, 60)
 
 		assert.NotNil(t, err)
 	})
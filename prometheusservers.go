@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+)
+
+const serverAggregationSum = "sum"
+const serverAggregationMax = "max"
+
+// Splits the comma-separated list of Prometheus server urls, ignoring empty entries
+func parsePrometheusServerURLs(value string) (urls []string) {
+	for _, url := range strings.Split(value, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls
+}
+
+// Runs the Prometheus query against each of the servers, for example one per region, and combines their request rates series by series.
+// Servers whose query fails are left out, so the rate is only unavailable if all of them fail.
+func getRequestRatesFromPrometheusServers(ctx context.Context, hpa *autoscalingv1.HorizontalPodAutoscaler, desiredState HPAScalerState) (requestRates []float64, err error) {
+	ratesPerServer := [][]float64{}
+	for _, prometheusServerURL := range desiredState.PrometheusServerURLs {
+		serverState := desiredState
+		serverState.PrometheusServerURL = prometheusServerURL
+		serverState.PrometheusSecondaryServerURL = ""
+
+		queryResponse, queryErr := executePrometheusQueryWithFallback(ctx, hpa, serverState, desiredState.PrometheusQuery, desiredState.PrometheusQueryRangeSeconds, desiredState.PrometheusQueryStepSeconds)
+		var rates []float64
+		if queryErr == nil {
+			rates, queryErr = queryResponse.GetValues()
+		}
+		if queryErr != nil {
+			log.Warn().Err(queryErr).Msgf("Querying prometheus server %v for hpa %v in namespace %v failed, combining the request rates of the other servers", prometheusServerURL, hpa.Name, hpa.Namespace)
+			err = queryErr
+			continue
+		}
+
+		ratesPerServer = append(ratesPerServer, rates)
+	}
+
+	if len(ratesPerServer) == 0 {
+		return nil, err
+	}
+
+	return combineRequestRates(ratesPerServer, desiredState.PrometheusServerAggregation), nil
+}
+
+// Combines the n-th series of each server into the n-th series of the result, by adding them up or taking the highest
+func combineRequestRates(ratesPerServer [][]float64, aggregation string) (combined []float64) {
+	for _, rates := range ratesPerServer {
+		for i, rate := range rates {
+			if i >= len(combined) {
+				combined = append(combined, rate)
+				continue
+			}
+
+			if aggregation == serverAggregationMax {
+				combined[i] = math.Max(combined[i], rate)
+			} else {
+				combined[i] += rate
+			}
+		}
+	}
+
+	return combined
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrometheusServerURLs(t *testing.T) {
+	t.Run("SplitsCommaSeparatedURLs", func(t *testing.T) {
+
+		// act
+		urls := parsePrometheusServerURLs("http://prometheus-eu.monitoring, http://prometheus-us.monitoring,")
+
+		assert.Equal(t, []string{"http://prometheus-eu.monitoring", "http://prometheus-us.monitoring"}, urls)
+	})
+}
+
+func TestCombineRequestRates(t *testing.T) {
+	t.Run("AddsUpSeriesOfAllServers", func(t *testing.T) {
+
+		// act
+		combined := combineRequestRates([][]float64{{100, 10}, {60}}, serverAggregationSum)
+
+		assert.Equal(t, []float64{160, 10}, combined)
+	})
+
+	t.Run("TakesHighestSeriesOfAllServers", func(t *testing.T) {
+
+		// act
+		combined := combineRequestRates([][]float64{{100, 10}, {60, 20}}, serverAggregationMax)
+
+		assert.Equal(t, []float64{100, 20}, combined)
+	})
+}
+
+func TestGetMinPodCountBasedOnMultiplePrometheusServers(t *testing.T) {
+	failingServer := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	}
+
+	t.Run("DividesSumOfRatesOfAllServersByRequestsPerReplica", func(t *testing.T) {
+
+		euServer := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer euServer.Close()
+		usServer := newTestPrometheusServer(map[string]string{"requests": "60"})
+		defer usServer.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusQuery: "requests", PrometheusServerURLs: []string{euServer.URL, usServer.URL}, PrometheusServerAggregation: serverAggregationSum, RequestsPerReplica: 20}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(8), minPodCount)
+		assert.Equal(t, float64(160), requestRate)
+	})
+
+	t.Run("DividesMaxOfRatesOfAllServersByRequestsPerReplica", func(t *testing.T) {
+
+		euServer := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer euServer.Close()
+		usServer := newTestPrometheusServer(map[string]string{"requests": "60"})
+		defer usServer.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusQuery: "requests", PrometheusServerURLs: []string{euServer.URL, usServer.URL}, PrometheusServerAggregation: serverAggregationMax, RequestsPerReplica: 20}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("SumsRatesOfAvailableServersIfOneFails", func(t *testing.T) {
+
+		euServer := newTestPrometheusServer(map[string]string{"requests": "100"})
+		defer euServer.Close()
+		usServer := failingServer()
+		defer usServer.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusQuery: "requests", PrometheusServerURLs: []string{euServer.URL, usServer.URL}, PrometheusServerAggregation: serverAggregationSum, RequestsPerReplica: 20}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, float64(100), requestRate)
+	})
+
+	t.Run("TakesMaxOfAvailableServersIfOneFails", func(t *testing.T) {
+
+		euServer := failingServer()
+		defer euServer.Close()
+		usServer := newTestPrometheusServer(map[string]string{"requests": "60"})
+		defer usServer.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusQuery: "requests", PrometheusServerURLs: []string{euServer.URL, usServer.URL}, PrometheusServerAggregation: serverAggregationMax, RequestsPerReplica: 20}
+
+		// act
+		minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(3), minPodCount)
+		assert.Equal(t, float64(60), requestRate)
+	})
+
+	t.Run("ReturnsQueryErrorIfAllServersFail", func(t *testing.T) {
+
+		euServer := failingServer()
+		defer euServer.Close()
+		usServer := failingServer()
+		defer usServer.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusQuery: "requests", PrometheusServerURLs: []string{euServer.URL, usServer.URL}, RequestsPerReplica: 20}
+
+		// act
+		_, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		_, isQueryError := err.(*QueryError)
+		assert.True(t, isQueryError)
+	})
+}
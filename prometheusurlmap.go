@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+	"sigs.k8s.io/yaml"
+)
+
+// prometheusServerURLMapHolder holds the prometheus server url per namespace, which can be swapped while hpas are being processed when the file changes
+type prometheusServerURLMapHolder struct {
+	mutex  sync.RWMutex
+	urlMap map[string]string
+}
+
+// the prometheus server url per namespace, loaded from the file passed with --prometheus-server-url-map-file
+var prometheusServerURLMap = &prometheusServerURLMapHolder{}
+
+// Replaces the prometheus server url per namespace
+func (h *prometheusServerURLMapHolder) set(urlMap map[string]string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.urlMap = urlMap
+}
+
+// Returns the prometheus server url mapped to the namespace, or the default url for namespaces that aren't mapped
+func (h *prometheusServerURLMapHolder) get(namespace, defaultURL string) string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return getPrometheusServerURLForNamespace(h.urlMap, namespace, defaultURL)
+}
+
+// Loads the file and replaces the prometheus server url per namespace; on failure the current urls are kept
+func (h *prometheusServerURLMapHolder) load(path string) error {
+	urlMap, err := loadPrometheusServerURLMap(path)
+	if err != nil {
+		return err
+	}
+
+	h.set(urlMap)
+	log.Info().Msgf("Loaded prometheus server urls for %v namespaces from %v", len(urlMap), path)
+
+	return nil
+}
+
+// Reloads the file whenever it changes until the context is cancelled. The directory is watched rather than the file itself,
+// since editors and configmap mounts replace the file instead of writing to it, which would end a watch on the file.
+func (h *prometheusServerURLMapHolder) watch(ctx context.Context, path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err = watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// configmap mounts update the file by swapping the ..data symlink
+				if event.Op&fsnotify.Chmod == event.Op || (filepath.Base(event.Name) != filepath.Base(path) && filepath.Base(event.Name) != "..data") {
+					continue
+				}
+				if err := h.load(path); err != nil {
+					log.Warn().Err(err).Msgf("Failed reloading prometheus server url map from %v, keeping the current urls", path)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msgf("Failed watching prometheus server url map file %v", path)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Loads the yaml file mapping namespaces to the url of the prometheus server for their hpas
+func loadPrometheusServerURLMap(path string) (urlMap map[string]string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(data, &urlMap); err != nil {
+		return nil, fmt.Errorf("Prometheus server url map file %v is invalid: %v", path, err)
+	}
+
+	// an empty map is more likely a file that's being written than one meant to unmap all namespaces
+	if len(urlMap) == 0 {
+		return nil, fmt.Errorf("Prometheus server url map file %v has no namespaces", path)
+	}
+
+	for namespace, url := range urlMap {
+		if url == "" {
+			return nil, fmt.Errorf("Prometheus server url map file %v has an empty url for namespace %v", path, namespace)
+		}
+	}
+
+	return urlMap, nil
+}
+
+// Returns the prometheus server url mapped to the namespace, or the default url for namespaces that aren't mapped
+func getPrometheusServerURLForNamespace(urlMap map[string]string, namespace, defaultURL string) string {
+	if url, ok := urlMap[namespace]; ok {
+		return url
+	}
+
+	return defaultURL
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writes the content to a temporary file and returns its path
+func writeTestFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "estafette-k8s-hpa-scaler-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+
+	return file.Name()
+}
+
+// polls the condition until it's met or the timeout expires
+func waitFor(condition func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return condition()
+}
+
+func TestLoadPrometheusServerURLMap(t *testing.T) {
+	t.Run("ReturnsURLPerNamespace", func(t *testing.T) {
+
+		path := writeTestFile(t, "team-a: http://prometheus-a.monitoring.svc\nteam-b: http://prometheus-b.monitoring.svc\n")
+		defer os.Remove(path)
+
+		// act
+		urlMap, err := loadPrometheusServerURLMap(path)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"team-a": "http://prometheus-a.monitoring.svc", "team-b": "http://prometheus-b.monitoring.svc"}, urlMap)
+	})
+
+	t.Run("ReturnsErrorIfFileDoesNotExist", func(t *testing.T) {
+
+		// act
+		_, err := loadPrometheusServerURLMap("/does/not/exist.yaml")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfFileIsNotAMapping", func(t *testing.T) {
+
+		path := writeTestFile(t, "- http://prometheus-a.monitoring.svc\n")
+		defer os.Remove(path)
+
+		// act
+		_, err := loadPrometheusServerURLMap(path)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfFileIsEmpty", func(t *testing.T) {
+
+		path := writeTestFile(t, "")
+		defer os.Remove(path)
+
+		// act
+		_, err := loadPrometheusServerURLMap(path)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfURLIsEmpty", func(t *testing.T) {
+
+		path := writeTestFile(t, "team-a: \"\"\n")
+		defer os.Remove(path)
+
+		// act
+		_, err := loadPrometheusServerURLMap(path)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetPrometheusServerURLForNamespace(t *testing.T) {
+	urlMap := map[string]string{"team-a": "http://prometheus-a.monitoring.svc"}
+
+	t.Run("ReturnsMappedURLForKnownNamespace", func(t *testing.T) {
+
+		// act
+		url := getPrometheusServerURLForNamespace(urlMap, "team-a", "http://prometheus.monitoring.svc")
+
+		assert.Equal(t, "http://prometheus-a.monitoring.svc", url)
+	})
+
+	t.Run("ReturnsDefaultURLForUnknownNamespace", func(t *testing.T) {
+
+		// act
+		url := getPrometheusServerURLForNamespace(urlMap, "team-c", "http://prometheus.monitoring.svc")
+
+		assert.Equal(t, "http://prometheus.monitoring.svc", url)
+	})
+
+	t.Run("ReturnsDefaultURLWithoutMap", func(t *testing.T) {
+
+		// act
+		url := getPrometheusServerURLForNamespace(nil, "team-a", "http://prometheus.monitoring.svc")
+
+		assert.Equal(t, "http://prometheus.monitoring.svc", url)
+	})
+}
+
+func TestGetDesiredHorizontalPodAutoscalerStateWithPrometheusServerURLMap(t *testing.T) {
+	t.Run("UsesURLMappedToNamespaceOfHPA", func(t *testing.T) {
+
+		prometheusServerURLMap.set(map[string]string{"my-namespace": "http://prometheus-a.monitoring.svc"})
+		defer prometheusServerURLMap.set(nil)
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+
+		// act
+		state := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, "http://prometheus-a.monitoring.svc", state.PrometheusServerURL)
+	})
+
+	t.Run("PrefersURLFromAnnotation", func(t *testing.T) {
+
+		prometheusServerURLMap.set(map[string]string{"my-namespace": "http://prometheus-a.monitoring.svc"})
+		defer prometheusServerURLMap.set(nil)
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true", "estafette.io/hpa-scaler-prometheus-server-url": "http://prometheus-b.monitoring.svc"}
+
+		// act
+		state := getDesiredHorizontalPodAutoscalerState(hpa)
+
+		assert.Equal(t, "http://prometheus-b.monitoring.svc", state.PrometheusServerURL)
+	})
+}
+
+func TestWatchPrometheusServerURLMap(t *testing.T) {
+	// writes the initial url map to a temporary directory and starts watching it
+	setup := func(t *testing.T) (path string, teardown func()) {
+		dir, err := ioutil.TempDir("", "estafette-k8s-hpa-scaler-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		path = filepath.Join(dir, "prometheus-server-url-map.yaml")
+		if err := ioutil.WriteFile(path, []byte("my-namespace: http://prometheus-a.monitoring.svc\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := prometheusServerURLMap.load(path); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := prometheusServerURLMap.watch(ctx, path); err != nil {
+			t.Fatal(err)
+		}
+
+		return path, func() {
+			cancel()
+			prometheusServerURLMap.set(nil)
+			os.RemoveAll(dir)
+		}
+	}
+
+	t.Run("UsesChangedURLOnNextReconcile", func(t *testing.T) {
+
+		path, teardown := setup(t)
+		defer teardown()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler": "true"}
+
+		// act
+		err := ioutil.WriteFile(path, []byte("my-namespace: http://prometheus-b.monitoring.svc\n"), 0644)
+
+		assert.Nil(t, err)
+		assert.True(t, waitFor(func() bool {
+			return getDesiredHorizontalPodAutoscalerState(hpa).PrometheusServerURL == "http://prometheus-b.monitoring.svc"
+		}, 5*time.Second))
+	})
+
+	t.Run("UsesURLFromReplacedFile", func(t *testing.T) {
+
+		path, teardown := setup(t)
+		defer teardown()
+		replacement := path + ".tmp"
+		if err := ioutil.WriteFile(replacement, []byte("my-namespace: http://prometheus-b.monitoring.svc\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// act
+		err := os.Rename(replacement, path)
+
+		assert.Nil(t, err)
+		assert.True(t, waitFor(func() bool {
+			return prometheusServerURLMap.get("my-namespace", "") == "http://prometheus-b.monitoring.svc"
+		}, 5*time.Second))
+	})
+
+	t.Run("KeepsCurrentURLsIfChangedFileIsInvalid", func(t *testing.T) {
+
+		path, teardown := setup(t)
+		defer teardown()
+
+		// act
+		err := ioutil.WriteFile(path, []byte("my-namespace: \"\"\n"), 0644)
+
+		assert.Nil(t, err)
+		// give the watcher time to pick up the change
+		time.Sleep(200 * time.Millisecond)
+		assert.Equal(t, "http://prometheus-a.monitoring.svc", prometheusServerURLMap.get("my-namespace", ""))
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/sethgrid/pester"
+)
+
+// the client for Prometheus queries, going through the proxy from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY envvars unless --prometheus-proxy-url is set
+var prometheusHTTPClient = newPrometheusHTTPClient(http.ProxyFromEnvironment)
+
+// Returns a retrying client whose requests go through the proxy returned by the proxy function, or directly if it returns nil
+func newPrometheusHTTPClient(proxy func(*http.Request) (*url.URL, error)) *pester.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+
+	return pester.NewExtendedClient(&http.Client{Transport: transport})
+}
+
+// Returns the proxy function for the proxy url, which sends all requests through it
+func getProxyFunc(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.New("The proxy url should be an absolute url with scheme and host, like http://proxy.example.com:3128")
+	}
+
+	return http.ProxyURL(u), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProxyFunc(t *testing.T) {
+	t.Run("ReturnsProxyURLForAnyRequest", func(t *testing.T) {
+
+		proxy, err := getProxyFunc("http://proxy.example.com:3128")
+		req, _ := http.NewRequest("GET", "http://prometheus.monitoring.svc/api/v1/query", nil)
+
+		// act
+		proxyURL, _ := proxy(req)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+	})
+
+	t.Run("ReturnsErrorForURLWithoutScheme", func(t *testing.T) {
+
+		// act
+		_, err := getProxyFunc("proxy.example.com:3128")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestPrometheusHTTPClient(t *testing.T) {
+	t.Run("SendsPrometheusQueriesThroughConfiguredProxy", func(t *testing.T) {
+
+		queryCache.Clear()
+		var proxiedHost string
+		proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxiedHost = r.Host
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1513161148.757,"100"]}]}}`)
+		}))
+		defer proxyServer.Close()
+		proxyCalls := 0
+		prometheusHTTPClient = newPrometheusHTTPClient(func(req *http.Request) (*url.URL, error) {
+			proxyCalls++
+			return url.Parse(proxyServer.URL)
+		})
+		defer func() { prometheusHTTPClient = newPrometheusHTTPClient(http.ProxyFromEnvironment) }()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+		desiredState := HPAScalerState{PrometheusServerURL: "http://prometheus.invalid", PrometheusQuery: "requests", RequestsPerReplica: 20}
+
+		// act
+		minPodCount, _, err := getMinPodCountBasedOnPrometheusQuery(context.Background(), nil, hpa, desiredState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(5), minPodCount)
+		assert.Equal(t, 1, proxyCalls)
+		assert.Equal(t, "prometheus.invalid", proxiedHost)
+	})
+}
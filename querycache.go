@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync"
+)
+
+// prometheusQueryCache holds prometheus query responses keyed by server url and query url, so identical queries within a single poll iteration only execute once
+type prometheusQueryCache struct {
+	mutex     sync.Mutex
+	responses map[prometheusQueryCacheKey]PrometheusQueryResponse
+}
+
+type prometheusQueryCacheKey struct {
+	prometheusServerURL string
+	prometheusQueryURL  string
+}
+
+func newPrometheusQueryCache() *prometheusQueryCache {
+	return &prometheusQueryCache{
+		responses: map[prometheusQueryCacheKey]PrometheusQueryResponse{},
+	}
+}
+
+// Get returns the cached response for the query url against the prometheus server, if any
+func (c *prometheusQueryCache) Get(prometheusServerURL, prometheusQueryURL string) (queryResponse PrometheusQueryResponse, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	queryResponse, ok = c.responses[prometheusQueryCacheKey{prometheusServerURL, prometheusQueryURL}]
+	if ok {
+		prometheusQueryCacheTotals.WithLabelValues("hit").Inc()
+	} else {
+		prometheusQueryCacheTotals.WithLabelValues("miss").Inc()
+	}
+
+	return
+}
+
+// Set stores the response for the query url against the prometheus server
+func (c *prometheusQueryCache) Set(prometheusServerURL, prometheusQueryURL string, queryResponse PrometheusQueryResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.responses[prometheusQueryCacheKey{prometheusServerURL, prometheusQueryURL}] = queryResponse
+}
+
+// Clear removes all cached responses; it's called at the start of each poll iteration to avoid stale values
+func (c *prometheusQueryCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.responses = map[prometheusQueryCacheKey]PrometheusQueryResponse{}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusQueryCache(t *testing.T) {
+	t.Run("ReturnsNotOkIfQueryIsNotCached", func(t *testing.T) {
+
+		cache := newPrometheusQueryCache()
+
+		// act
+		_, ok := cache.Get("http://prometheus", "requests")
+
+		assert.False(t, ok)
+	})
+
+	t.Run("ReturnsCachedResponseForSameServerAndQuery", func(t *testing.T) {
+
+		cache := newPrometheusQueryCache()
+		cache.Set("http://prometheus", "requests", PrometheusQueryResponse{Status: "success"})
+
+		// act
+		queryResponse, ok := cache.Get("http://prometheus", "requests")
+
+		assert.True(t, ok)
+		assert.Equal(t, "success", queryResponse.Status)
+	})
+
+	t.Run("ReturnsNotOkForSameQueryOnOtherServer", func(t *testing.T) {
+
+		cache := newPrometheusQueryCache()
+		cache.Set("http://prometheus", "requests", PrometheusQueryResponse{Status: "success"})
+
+		// act
+		_, ok := cache.Get("http://other-prometheus", "requests")
+
+		assert.False(t, ok)
+	})
+
+	t.Run("ReturnsNotOkAfterClear", func(t *testing.T) {
+
+		cache := newPrometheusQueryCache()
+		cache.Set("http://prometheus", "requests", PrometheusQueryResponse{Status: "success"})
+
+		// act
+		cache.Clear()
+
+		_, ok := cache.Get("http://prometheus", "requests")
+		assert.False(t, ok)
+	})
+}
+
+func TestExecutePrometheusQuery(t *testing.T) {
+	t.Run("ExecutesIdenticalQueriesOnce", func(t *testing.T) {
+
+		queryCache.Clear()
+		requestCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestCount++
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1513161148.757,"100"]}]}}`)
+		}))
+		defer server.Close()
+		hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+
+		// act
+		_, err1 := executePrometheusQuery(context.Background(), hpa, server.URL, server.URL+"/api/v1/query?query=requests")
+		_, err2 := executePrometheusQuery(context.Background(), hpa, server.URL, server.URL+"/api/v1/query?query=requests")
+
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, 1, requestCount)
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// the lookback filled in for {{.Window}} in queries of hpas without the query window annotation
+const defaultQueryWindow = "10m"
+
+// a prometheus duration, like 30s, 5m or 1h30m
+var prometheusDurationRegexp = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|y))+$`)
+
+// prometheusQueryTemplateData holds the values that can be referred to from the query annotation
+type prometheusQueryTemplateData struct {
+	Window string
+}
+
+// Returns the query with its placeholders, like {{.Window}}, filled in; queries without placeholders are returned as is
+func renderPrometheusQuery(prometheusQuery, window string) (string, error) {
+	if !strings.Contains(prometheusQuery, "{{") {
+		return prometheusQuery, nil
+	}
+
+	queryTemplate, err := template.New("query").Option("missingkey=error").Parse(prometheusQuery)
+	if err != nil {
+		return "", fmt.Errorf("Parsing placeholders of query %v failed: %v", prometheusQuery, err)
+	}
+
+	var renderedQuery strings.Builder
+	if err := queryTemplate.Execute(&renderedQuery, prometheusQueryTemplateData{Window: window}); err != nil {
+		return "", fmt.Errorf("Filling in placeholders of query %v failed: %v", prometheusQuery, err)
+	}
+
+	return renderedQuery.String(), nil
+}
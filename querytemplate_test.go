@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPrometheusQuery(t *testing.T) {
+	t.Run("FillsInWindow", func(t *testing.T) {
+
+		// act
+		query, err := renderPrometheusQuery(`sum(rate(nginx_http_requests_total{app="my-app"}[{{.Window}}]))`, "5m")
+
+		assert.Nil(t, err)
+		assert.Equal(t, `sum(rate(nginx_http_requests_total{app="my-app"}[5m]))`, query)
+	})
+
+	t.Run("ReturnsQueryWithoutPlaceholdersAsIs", func(t *testing.T) {
+
+		// act
+		query, err := renderPrometheusQuery(`sum(rate(nginx_http_requests_total{app="my-app"}[10m]))`, "5m")
+
+		assert.Nil(t, err)
+		assert.Equal(t, `sum(rate(nginx_http_requests_total{app="my-app"}[10m]))`, query)
+	})
+
+	t.Run("ReturnsErrorForInvalidPlaceholder", func(t *testing.T) {
+
+		// act
+		_, err := renderPrometheusQuery(`sum(rate(nginx_http_requests_total[{{.Window]))`, "5m")
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorForUnknownPlaceholder", func(t *testing.T) {
+
+		// act
+		_, err := renderPrometheusQuery(`sum(rate(nginx_http_requests_total[{{.Lookback}}]))`, "5m")
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+
+	"github.com/rs/zerolog/log"
+)
+
+const deploymentInProgressPredicateReplicaSets = "replica-sets"
+const deploymentInProgressPredicateReadyReplicas = "ready-replicas"
+
+// deploymentInProgressPredicate decides whether a rollout is in progress, given the replica sets of the application and its deployment,
+// which is nil if it couldn't be retrieved
+type deploymentInProgressPredicate func(replicaSets []*appsv1.ReplicaSet, deployment *appsv1.Deployment, state HPAScalerState) bool
+
+// the predicates that can be selected with the deployment-in-progress-predicate annotation
+var deploymentInProgressPredicates = map[string]deploymentInProgressPredicate{
+	deploymentInProgressPredicateReplicaSets:   hasMoreReplicaSetsThanThreshold,
+	deploymentInProgressPredicateReadyReplicas: hasReadyReplicasMismatch,
+}
+
+// Returns whether the rollout has more non-empty replica sets than the threshold in the state. In revision mode the replica sets
+// of the deployment's current revision count as one, however many there are, so only replica sets of other revisions add to it.
+func hasMoreReplicaSetsThanThreshold(replicaSets []*appsv1.ReplicaSet, deployment *appsv1.Deployment, state HPAScalerState) bool {
+	threshold := state.DeploymentInProgressReplicaSets
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	if *deploymentCheckingMode != deploymentCheckingModeRevision || deployment == nil {
+		return countNonEmptyReplicaSets(replicaSets) > threshold
+	}
+
+	currentRevision, ok := deployment.Annotations[deploymentRevisionAnnotation]
+	if !ok {
+		log.Warn().Msgf("Deployment %v in namespace %v has no %v annotation, counting its non-empty replica sets instead", deployment.Name, deployment.Namespace, deploymentRevisionAnnotation)
+		return countNonEmptyReplicaSets(replicaSets) > threshold
+	}
+
+	count := 1
+	for _, rs := range replicaSets {
+		if rs.Status.Replicas > 0 && rs.Annotations[deploymentRevisionAnnotation] != currentRevision {
+			count++
+		}
+	}
+
+	return count > threshold
+}
+
+// Returns whether the ready or updated replicas of the deployment differ from its desired replicas, regardless of its replica sets
+func hasReadyReplicasMismatch(replicaSets []*appsv1.ReplicaSet, deployment *appsv1.Deployment, state HPAScalerState) bool {
+	if deployment == nil {
+		return false
+	}
+
+	desiredReplicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desiredReplicas = *deployment.Spec.Replicas
+	}
+
+	return deployment.Status.ReadyReplicas != desiredReplicas || deployment.Status.UpdatedReplicas != desiredReplicas
+}
+
+// Returns the number of replica sets that have any replicas.
+func countNonEmptyReplicaSets(replicaSets []*appsv1.ReplicaSet) (count int) {
+	for _, rs := range replicaSets {
+		if rs.Status.Replicas > 0 {
+			count++
+		}
+	}
+
+	return count
+}
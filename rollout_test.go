@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHasMoreReplicaSetsThanThreshold(t *testing.T) {
+	newReplicaSets := func(replicas ...int32) (replicaSets []*appsv1.ReplicaSet) {
+		for _, r := range replicas {
+			replicaSet := newTestReplicaSet("my-app", nil, "", r)
+			replicaSets = append(replicaSets, &replicaSet)
+		}
+		return
+	}
+
+	t.Run("ReturnsTrueForMoreThanOneNonEmptyReplicaSetByDefault", func(t *testing.T) {
+
+		// act
+		inProgress := hasMoreReplicaSetsThanThreshold(newReplicaSets(3, 2, 0), nil, HPAScalerState{})
+
+		assert.True(t, inProgress)
+	})
+
+	t.Run("ReturnsFalseForNonEmptyReplicaSetsUpToThreshold", func(t *testing.T) {
+
+		// act
+		inProgress := hasMoreReplicaSetsThanThreshold(newReplicaSets(3, 2, 0), nil, HPAScalerState{DeploymentInProgressReplicaSets: 2})
+
+		assert.False(t, inProgress)
+	})
+
+	t.Run("ReturnsTrueForNonEmptyReplicaSetsAboveThreshold", func(t *testing.T) {
+
+		// act
+		inProgress := hasMoreReplicaSetsThanThreshold(newReplicaSets(3, 2, 1), nil, HPAScalerState{DeploymentInProgressReplicaSets: 2})
+
+		assert.True(t, inProgress)
+	})
+
+	t.Run("CountsReplicaSetsOfCurrentRevisionAsOneInRevisionMode", func(t *testing.T) {
+
+		*deploymentCheckingMode = deploymentCheckingModeRevision
+		defer func() { *deploymentCheckingMode = deploymentCheckingModeAppLabel }()
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Annotations: map[string]string{"deployment.kubernetes.io/revision": "3"}}}
+		current := newTestReplicaSetWithRevision("my-app-3", "my-app-uid", "3", 3)
+		otherCurrent := newTestReplicaSetWithRevision("my-app-3b", "my-app-uid", "3", 3)
+		old := newTestReplicaSetWithRevision("my-app-2", "my-app-uid", "2", 1)
+
+		// act
+		inProgress := hasMoreReplicaSetsThanThreshold([]*appsv1.ReplicaSet{&current, &otherCurrent, &old}, deployment, HPAScalerState{DeploymentInProgressReplicaSets: 2})
+
+		assert.False(t, inProgress)
+	})
+}
+
+func TestHasReadyReplicasMismatch(t *testing.T) {
+	newDeployment := func(desired, ready, updated int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			Spec:   appsv1.DeploymentSpec{Replicas: &desired},
+			Status: appsv1.DeploymentStatus{ReadyReplicas: ready, UpdatedReplicas: updated},
+		}
+	}
+
+	t.Run("ReturnsFalseIfAllDesiredReplicasAreReadyAndUpdated", func(t *testing.T) {
+
+		// act
+		inProgress := hasReadyReplicasMismatch(nil, newDeployment(5, 5, 5), HPAScalerState{})
+
+		assert.False(t, inProgress)
+	})
+
+	t.Run("ReturnsTrueIfNotAllDesiredReplicasAreReady", func(t *testing.T) {
+
+		// act
+		inProgress := hasReadyReplicasMismatch(nil, newDeployment(5, 4, 5), HPAScalerState{})
+
+		assert.True(t, inProgress)
+	})
+
+	t.Run("ReturnsTrueIfNotAllDesiredReplicasAreUpdated", func(t *testing.T) {
+
+		// act
+		inProgress := hasReadyReplicasMismatch(nil, newDeployment(5, 5, 2), HPAScalerState{})
+
+		assert.True(t, inProgress)
+	})
+
+	t.Run("ReturnsFalseWithoutDeployment", func(t *testing.T) {
+
+		// act
+		inProgress := hasReadyReplicasMismatch(nil, nil, HPAScalerState{})
+
+		assert.False(t, inProgress)
+	})
+}
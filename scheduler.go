@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+)
+
+// the minimum time between poll iterations when processing is spread, so the loop doesn't wake up for every single hpa
+const spreadProcessingMinWait = 10 * time.Second
+
+// horizontalPodAutoscalerScheduler spreads processing the hpas over the poll interval, by giving each hpa its own jittered next run time.
+// The hpas are listed once per interval, the iterations in between pick the due hpas from that list.
+type horizontalPodAutoscalerScheduler struct {
+	interval time.Duration
+	random   *rand.Rand
+	nextRuns map[namespacedName]time.Time
+	hpas     []autoscalingv1.HorizontalPodAutoscaler
+	listedAt time.Time
+}
+
+// spreads processing the hpas when --spread-processing is enabled, nil otherwise
+var hpaScheduler *horizontalPodAutoscalerScheduler
+
+func newHorizontalPodAutoscalerScheduler(interval time.Duration, random *rand.Rand) *horizontalPodAutoscalerScheduler {
+	return &horizontalPodAutoscalerScheduler{
+		interval: interval,
+		random:   random,
+		nextRuns: map[namespacedName]time.Time{},
+	}
+}
+
+// Returns whether the hpa is due to be processed; an hpa seen for the first time gets a random next run within the interval, so they're spread evenly
+func (s *horizontalPodAutoscalerScheduler) due(hpa namespacedName, now time.Time) bool {
+	nextRun, ok := s.nextRuns[hpa]
+	if !ok {
+		nextRun = now.Add(time.Duration(s.random.Int63n(int64(s.interval))))
+		s.nextRuns[hpa] = nextRun
+	}
+
+	return !now.Before(nextRun)
+}
+
+// Schedules the next run of the processed hpa an interval after its last one, jittered by up to 10% either way so hpas don't line up over time
+func (s *horizontalPodAutoscalerScheduler) processed(hpa namespacedName, now time.Time) {
+	deviation := s.interval / 10
+	nextRun := s.nextRuns[hpa].Add(s.interval - deviation + time.Duration(s.random.Int63n(int64(2*deviation))))
+
+	// after an outage the slot has passed already, so start from now instead of catching up
+	if nextRun.Before(now) {
+		nextRun = now.Add(s.interval - deviation + time.Duration(s.random.Int63n(int64(2*deviation))))
+	}
+
+	s.nextRuns[hpa] = nextRun
+}
+
+// Forgets the hpas that weren't listed in the last complete poll iteration
+func (s *horizontalPodAutoscalerScheduler) retain(hpas map[namespacedName]bool) {
+	for hpa := range s.nextRuns {
+		if !hpas[hpa] {
+			delete(s.nextRuns, hpa)
+		}
+	}
+}
+
+// Returns the time until the next hpa is due, at least the minimum wait and at most the interval
+func (s *horizontalPodAutoscalerScheduler) waitTime(now time.Time) time.Duration {
+	wait := s.interval
+	for _, nextRun := range s.nextRuns {
+		if untilNextRun := nextRun.Sub(now); untilNextRun < wait {
+			wait = untilNextRun
+		}
+	}
+
+	if wait < spreadProcessingMinWait {
+		return spreadProcessingMinWait
+	}
+
+	return wait
+}
+
+// Returns the hpas listed less than an interval ago, if any
+func (s *horizontalPodAutoscalerScheduler) listed(now time.Time) ([]autoscalingv1.HorizontalPodAutoscaler, bool) {
+	if s.listedAt.IsZero() || now.Sub(s.listedAt) >= s.interval {
+		return nil, false
+	}
+
+	return s.hpas, true
+}
+
+// Keeps the hpas of a complete listing, to process the due ones until the interval has passed
+func (s *horizontalPodAutoscalerScheduler) list(hpas []autoscalingv1.HorizontalPodAutoscaler, now time.Time) {
+	s.hpas = hpas
+	s.listedAt = now
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+)
+
+func TestHorizontalPodAutoscalerScheduler(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("SpreadsFirstRunsEvenlyOverInterval", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		for i := 0; i < 900; i++ {
+			scheduler.due(namespacedName{"my-namespace", fmt.Sprintf("my-app-%v", i)}, now)
+		}
+
+		// act
+		buckets := make([]int, 9)
+		for _, nextRun := range scheduler.nextRuns {
+			offset := nextRun.Sub(now)
+			assert.True(t, offset >= 0 && offset < 90*time.Second)
+			buckets[int(offset/(10*time.Second))]++
+		}
+
+		// each 10 second bucket holds about a ninth of the hpas
+		for _, count := range buckets {
+			assert.InDelta(t, 100, count, 30)
+		}
+	})
+
+	t.Run("ReturnsDueOnceNextRunHasPassed", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		hpa := namespacedName{"my-namespace", "my-app"}
+		scheduler.nextRuns[hpa] = now.Add(30 * time.Second)
+
+		// act
+		dueBefore := scheduler.due(hpa, now)
+		dueAfter := scheduler.due(hpa, now.Add(30*time.Second))
+
+		assert.False(t, dueBefore)
+		assert.True(t, dueAfter)
+	})
+
+	t.Run("SchedulesNextRunAboutAnIntervalAfterLastRun", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		hpa := namespacedName{"my-namespace", "my-app"}
+		scheduler.nextRuns[hpa] = now
+
+		// act
+		scheduler.processed(hpa, now.Add(5*time.Second))
+
+		nextRun := scheduler.nextRuns[hpa]
+		assert.True(t, !nextRun.Before(now.Add(81*time.Second)) && nextRun.Before(now.Add(99*time.Second)), nextRun.Sub(now).String())
+	})
+
+	t.Run("SchedulesNextRunFromNowIfSlotHasPassed", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		hpa := namespacedName{"my-namespace", "my-app"}
+		scheduler.nextRuns[hpa] = now
+		later := now.Add(10 * time.Minute)
+
+		// act
+		scheduler.processed(hpa, later)
+
+		nextRun := scheduler.nextRuns[hpa]
+		assert.True(t, !nextRun.Before(later.Add(81*time.Second)) && nextRun.Before(later.Add(99*time.Second)), nextRun.Sub(later).String())
+	})
+
+	t.Run("KeepsHPAsSpreadAfterManyIntervals", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		hpas := []namespacedName{}
+		for i := 0; i < 900; i++ {
+			hpas = append(hpas, namespacedName{"my-namespace", fmt.Sprintf("my-app-%v", i)})
+			scheduler.due(hpas[i], now)
+		}
+
+		// act
+		processedPerTick := map[int]int{}
+		tick := 0
+		for current := now; current.Before(now.Add(30 * time.Minute)); current = current.Add(10 * time.Second) {
+			for _, hpa := range hpas {
+				if scheduler.due(hpa, current) {
+					scheduler.processed(hpa, current)
+					processedPerTick[tick]++
+				}
+			}
+			tick++
+		}
+
+		// after warming up, each 10 second tick processes about a ninth of the hpas instead of all of them at once
+		for tick := 18; tick < len(processedPerTick); tick++ {
+			assert.InDelta(t, 100, processedPerTick[tick], 45, "tick %v", tick)
+		}
+	})
+
+	t.Run("ForgetsHPAsThatAreGone", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		kept := namespacedName{"my-namespace", "kept-app"}
+		removed := namespacedName{"my-namespace", "removed-app"}
+		scheduler.due(kept, now)
+		scheduler.due(removed, now)
+
+		// act
+		scheduler.retain(map[namespacedName]bool{kept: true})
+
+		assert.Equal(t, 1, len(scheduler.nextRuns))
+		_, ok := scheduler.nextRuns[kept]
+		assert.True(t, ok)
+	})
+
+	t.Run("WaitsUntilNextHPAIsDue", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		scheduler.nextRuns[namespacedName{"my-namespace", "my-app"}] = now.Add(40 * time.Second)
+		scheduler.nextRuns[namespacedName{"my-namespace", "my-other-app"}] = now.Add(25 * time.Second)
+
+		// act
+		wait := scheduler.waitTime(now)
+
+		assert.Equal(t, 25*time.Second, wait)
+	})
+
+	t.Run("WaitsAtLeastMinimumWait", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		scheduler.nextRuns[namespacedName{"my-namespace", "my-app"}] = now.Add(time.Second)
+
+		// act
+		wait := scheduler.waitTime(now)
+
+		assert.Equal(t, spreadProcessingMinWait, wait)
+	})
+
+	t.Run("WaitsIntervalWithoutHPAs", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+
+		// act
+		wait := scheduler.waitTime(now)
+
+		assert.Equal(t, 90*time.Second, wait)
+	})
+
+	t.Run("ReturnsListedHPAsWithinInterval", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		hpas := []autoscalingv1.HorizontalPodAutoscaler{*newTestHorizontalPodAutoscaler(3, 20, 10)}
+		scheduler.list(hpas, now)
+
+		// act
+		listed, ok := scheduler.listed(now.Add(80 * time.Second))
+
+		assert.True(t, ok)
+		assert.Equal(t, hpas, listed)
+	})
+
+	t.Run("ReturnsEmptyListingWithinInterval", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		scheduler.list(nil, now)
+
+		// act
+		listed, ok := scheduler.listed(now.Add(10 * time.Second))
+
+		assert.True(t, ok)
+		assert.Empty(t, listed)
+	})
+
+	t.Run("ReturnsNoListedHPAsOnceIntervalHasPassed", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+		scheduler.list([]autoscalingv1.HorizontalPodAutoscaler{*newTestHorizontalPodAutoscaler(3, 20, 10)}, now)
+
+		// act
+		_, ok := scheduler.listed(now.Add(90 * time.Second))
+
+		assert.False(t, ok)
+	})
+
+	t.Run("ReturnsNoListedHPAsBeforeFirstListing", func(t *testing.T) {
+
+		scheduler := newHorizontalPodAutoscalerScheduler(90*time.Second, rand.New(rand.NewSource(1)))
+
+		// act
+		_, ok := scheduler.listed(now)
+
+		assert.False(t, ok)
+	})
+}
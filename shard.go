@@ -0,0 +1,22 @@
+package main
+
+import (
+	"hash/fnv"
+)
+
+// Returns whether the hpa belongs to the shard with the index, so each hpa is only queried and updated by one of the replicas; a shard count of 1 or less means a single replica handles all hpas
+func isHorizontalPodAutoscalerInShard(namespace, name string, shardIndex, shardCount int) bool {
+	if shardCount <= 1 {
+		return true
+	}
+
+	return getHorizontalPodAutoscalerShard(namespace, name, shardCount) == shardIndex
+}
+
+// Returns the shard of the hpa from a stable hash of its namespace and name, so it doesn't move between replicas as long as the shard count stays the same
+func getHorizontalPodAutoscalerShard(namespace, name string, shardCount int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(namespace + "/" + name))
+
+	return int(hash.Sum32() % uint32(shardCount))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsHorizontalPodAutoscalerInShard(t *testing.T) {
+	t.Run("ReturnsTrueForEveryHPAIfShardingIsDisabled", func(t *testing.T) {
+
+		for _, shardCount := range []int{0, 1} {
+
+			// act
+			inShard := isHorizontalPodAutoscalerInShard("my-namespace", "my-app", 0, shardCount)
+
+			assert.True(t, inShard)
+		}
+	})
+
+	t.Run("ReturnsTrueForExactlyOneShardPerHPA", func(t *testing.T) {
+
+		for i := 0; i < 100; i++ {
+			name := fmt.Sprintf("my-app-%v", i)
+			shards := 0
+			for shardIndex := 0; shardIndex < 3; shardIndex++ {
+
+				// act
+				if isHorizontalPodAutoscalerInShard("my-namespace", name, shardIndex, 3) {
+					shards++
+				}
+			}
+
+			assert.Equal(t, 1, shards, name)
+		}
+	})
+
+	t.Run("SpreadsHPAsOverAllShards", func(t *testing.T) {
+
+		hpasPerShard := map[int]int{}
+		for i := 0; i < 300; i++ {
+
+			// act
+			hpasPerShard[getHorizontalPodAutoscalerShard("my-namespace", fmt.Sprintf("my-app-%v", i), 3)]++
+		}
+
+		assert.Equal(t, 3, len(hpasPerShard))
+		for shardIndex, count := range hpasPerShard {
+			assert.True(t, count > 50, "shard %v only has %v hpas", shardIndex, count)
+		}
+	})
+
+	t.Run("ReturnsSameShardForSameHPA", func(t *testing.T) {
+
+		// act
+		shard := getHorizontalPodAutoscalerShard("my-namespace", "my-app", 5)
+
+		assert.Equal(t, shard, getHorizontalPodAutoscalerShard("my-namespace", "my-app", 5))
+		assert.NotEqual(t, getHorizontalPodAutoscalerShard("my-namespace", "my-app", 1000), getHorizontalPodAutoscalerShard("other-namespace", "my-app", 1000))
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// inFlightHorizontalPodAutoscalers tracks the hpas being processed, to log the ones that didn't finish before the shutdown timeout
+type inFlightHorizontalPodAutoscalers struct {
+	mutex sync.Mutex
+	hpas  map[namespacedName]time.Time
+}
+
+var inFlight = &inFlightHorizontalPodAutoscalers{hpas: map[namespacedName]time.Time{}}
+
+// Records that processing the hpa started
+func (f *inFlightHorizontalPodAutoscalers) start(hpa namespacedName, now time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.hpas[hpa] = now
+}
+
+// Records that processing the hpa finished
+func (f *inFlightHorizontalPodAutoscalers) finish(hpa namespacedName) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.hpas, hpa)
+}
+
+// Returns the hpas still being processed as sorted namespace/name pairs, along with how long they've been processed
+func (f *inFlightHorizontalPodAutoscalers) describe(now time.Time) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	descriptions := []string{}
+	for hpa, started := range f.hpas {
+		descriptions = append(descriptions, fmt.Sprintf("%v/%v (%v)", hpa.namespace, hpa.name, now.Sub(started).Round(time.Millisecond)))
+	}
+	sort.Strings(descriptions)
+
+	return descriptions
+}
+
+// Returns whether the wait group is done within the timeout; a timeout of 0 waits indefinitely
+func waitWithTimeout(waitGroup *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		waitGroup.Wait()
+		close(done)
+	}()
+
+	if timeout <= 0 {
+		<-done
+		return true
+	}
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Waits for a shutdown signal and then for the running tasks to finish, but no longer than the timeout so shutdown never hangs; replaces foundation.HandleGracefulShutdown
+func handleGracefulShutdown(gracefulShutdown chan os.Signal, waitGroup *sync.WaitGroup, timeout time.Duration) {
+	signalReceived := <-gracefulShutdown
+	log.Info().Msgf("Received signal %v. Waiting for running tasks to finish...", signalReceived)
+
+	if !waitWithTimeout(waitGroup, timeout) {
+		log.Warn().Strs("hpas", inFlight.describe(time.Now())).Msgf("Running tasks didn't finish within %v, shutting down anyway", timeout)
+	}
+
+	log.Info().Msg("Shutting down...")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitWithTimeout(t *testing.T) {
+	t.Run("ReturnsTrueIfWorkersFinishWithinTimeout", func(t *testing.T) {
+
+		waitGroup := &sync.WaitGroup{}
+		waitGroup.Add(1)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			waitGroup.Done()
+		}()
+
+		// act
+		done := waitWithTimeout(waitGroup, time.Second)
+
+		assert.True(t, done)
+	})
+
+	t.Run("ReturnsFalseIfSlowWorkerDoesNotFinishWithinTimeout", func(t *testing.T) {
+
+		waitGroup := &sync.WaitGroup{}
+		waitGroup.Add(1)
+		defer waitGroup.Done()
+
+		// act
+		done := waitWithTimeout(waitGroup, 10*time.Millisecond)
+
+		assert.False(t, done)
+	})
+}
+
+func TestHandleGracefulShutdown(t *testing.T) {
+	t.Run("ReturnsAfterTimeoutIfSlowWorkerDoesNotFinish", func(t *testing.T) {
+
+		gracefulShutdown := make(chan os.Signal, 1)
+		gracefulShutdown <- syscall.SIGTERM
+		waitGroup := &sync.WaitGroup{}
+		waitGroup.Add(1)
+		defer waitGroup.Done()
+		slowHPA := namespacedName{"my-namespace", "my-app"}
+		inFlight.start(slowHPA, time.Now())
+		defer inFlight.finish(slowHPA)
+		start := time.Now()
+
+		// act
+		handleGracefulShutdown(gracefulShutdown, waitGroup, 50*time.Millisecond)
+
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+		assert.True(t, time.Since(start) < time.Second)
+	})
+}
+
+func TestInFlightHorizontalPodAutoscalers(t *testing.T) {
+	t.Run("DescribesOnlyUnfinishedHPAs", func(t *testing.T) {
+
+		now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		tracker := &inFlightHorizontalPodAutoscalers{hpas: map[namespacedName]time.Time{}}
+		tracker.start(namespacedName{"my-namespace", "my-app"}, now.Add(-2*time.Second))
+		tracker.start(namespacedName{"my-namespace", "my-other-app"}, now.Add(-time.Second))
+		tracker.finish(namespacedName{"my-namespace", "my-other-app"})
+
+		// act
+		descriptions := tracker.describe(now)
+
+		assert.Equal(t, []string{"my-namespace/my-app (2s)"}, descriptions)
+	})
+}
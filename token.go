@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// the path the kubelet projects the token of the pod's service account to
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// the kubelet rotates projected tokens well before they expire, so rereading it every minute is plenty
+	serviceAccountTokenRefreshInterval = time.Minute
+)
+
+// bearerTokenSource reads the bearer token from a file and rereads it once it's older than the refresh interval, so rotated tokens are picked up
+type bearerTokenSource struct {
+	path            string
+	refreshInterval time.Duration
+
+	mutex  sync.Mutex
+	token  string
+	readAt time.Time
+}
+
+// the token sent with prometheus queries when --prometheus-service-account-token is set, nil otherwise
+var prometheusBearerToken *bearerTokenSource
+
+func newBearerTokenSource(path string, refreshInterval time.Duration) *bearerTokenSource {
+	return &bearerTokenSource{path: path, refreshInterval: refreshInterval}
+}
+
+// Returns the token, rereading the file if the token is older than the refresh interval; if rereading fails the last token is returned as long as there is one
+func (s *bearerTokenSource) get(now time.Time) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token != "" && now.Sub(s.readAt) < s.refreshInterval {
+		return s.token, nil
+	}
+
+	token, err := readBearerToken(s.path)
+	if err != nil {
+		if s.token != "" {
+			log.Warn().Err(err).Msgf("Rereading bearer token from %v failed, using the last token", s.path)
+			return s.token, nil
+		}
+		return "", err
+	}
+
+	s.token = token
+	s.readAt = now
+
+	return s.token, nil
+}
+
+func readBearerToken(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("The bearer token file " + path + " is empty")
+	}
+
+	return token, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBearerTokenSource(t *testing.T) {
+	t.Run("ReadsTokenWithoutTrailingNewline", func(t *testing.T) {
+
+		path := writeTestFile(t, "first-token\n")
+		defer os.Remove(path)
+		source := newBearerTokenSource(path, time.Minute)
+
+		// act
+		token, err := source.get(time.Now())
+
+		assert.Nil(t, err)
+		assert.Equal(t, "first-token", token)
+	})
+
+	t.Run("KeepsTokenWithinRefreshInterval", func(t *testing.T) {
+
+		path := writeTestFile(t, "first-token")
+		defer os.Remove(path)
+		source := newBearerTokenSource(path, time.Minute)
+		now := time.Now()
+		_, err := source.get(now)
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(path, []byte("second-token"), 0644))
+
+		// act
+		token, err := source.get(now.Add(30 * time.Second))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "first-token", token)
+	})
+
+	t.Run("RereadsRotatedTokenAfterRefreshInterval", func(t *testing.T) {
+
+		path := writeTestFile(t, "first-token")
+		defer os.Remove(path)
+		source := newBearerTokenSource(path, time.Minute)
+		now := time.Now()
+		_, err := source.get(now)
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(path, []byte("second-token"), 0644))
+
+		// act
+		token, err := source.get(now.Add(time.Minute))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "second-token", token)
+	})
+
+	t.Run("KeepsLastTokenIfRereadingFails", func(t *testing.T) {
+
+		path := writeTestFile(t, "first-token")
+		source := newBearerTokenSource(path, time.Minute)
+		now := time.Now()
+		_, err := source.get(now)
+		assert.Nil(t, err)
+		os.Remove(path)
+
+		// act
+		token, err := source.get(now.Add(time.Minute))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "first-token", token)
+	})
+
+	t.Run("ReturnsErrorIfTokenFileIsMissing", func(t *testing.T) {
+
+		source := newBearerTokenSource("/non-existing/token", time.Minute)
+
+		// act
+		_, err := source.get(time.Now())
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfTokenFileIsEmpty", func(t *testing.T) {
+
+		path := writeTestFile(t, "\n")
+		defer os.Remove(path)
+		source := newBearerTokenSource(path, time.Minute)
+
+		// act
+		_, err := source.get(time.Now())
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetPrometheusQueryResponseWithBearerToken(t *testing.T) {
+	t.Run("SendsBearerTokenIfSet", func(t *testing.T) {
+
+		path := writeTestFile(t, "my-token")
+		defer os.Remove(path)
+		prometheusBearerToken = newBearerTokenSource(path, time.Minute)
+		defer func() { prometheusBearerToken = nil }()
+		authorization := ""
+		prometheusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1513161148.757,"90"]}]}}`)
+		}))
+		defer prometheusServer.Close()
+
+		// act
+		_, err := getPrometheusQueryResponse(context.Background(), newTestHorizontalPodAutoscaler(3, 20, 10), prometheusServer.URL+"/api/v1/query?query=requests")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "Bearer my-token", authorization)
+	})
+
+	t.Run("SendsRotatedBearerTokenAfterRefreshInterval", func(t *testing.T) {
+
+		path := writeTestFile(t, "first-token")
+		defer os.Remove(path)
+		prometheusBearerToken = newBearerTokenSource(path, time.Minute)
+		defer func() { prometheusBearerToken = nil }()
+		_, err := prometheusBearerToken.get(time.Now())
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(path, []byte("second-token"), 0644))
+		// pretend the token was read longer than the refresh interval ago
+		prometheusBearerToken.readAt = time.Now().Add(-2 * time.Minute)
+		authorization := ""
+		prometheusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1513161148.757,"90"]}]}}`)
+		}))
+		defer prometheusServer.Close()
+
+		// act
+		_, err = getPrometheusQueryResponse(context.Background(), newTestHorizontalPodAutoscaler(3, 20, 10), prometheusServer.URL+"/api/v1/query?query=requests")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "Bearer second-token", authorization)
+	})
+
+	t.Run("SendsNoAuthorizationIfNotSet", func(t *testing.T) {
+
+		authorization := "unset"
+		prometheusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1513161148.757,"90"]}]}}`)
+		}))
+		defer prometheusServer.Close()
+
+		// act
+		_, err := getPrometheusQueryResponse(context.Background(), newTestHorizontalPodAutoscaler(3, 20, 10), prometheusServer.URL+"/api/v1/query?query=requests")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "", authorization)
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// updateBackoffTracker counts the consecutive failed updates per hpa, so an hpa that keeps failing is skipped for exponentially increasing intervals instead of being retried every iteration
+type updateBackoffTracker struct {
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	mutex    sync.Mutex
+	failures map[string]*updateFailures
+}
+
+type updateFailures struct {
+	consecutiveFailures int
+	lastFailureAt       time.Time
+}
+
+func newUpdateBackoffTracker(initialBackoff, maxBackoff time.Duration) *updateBackoffTracker {
+	return &updateBackoffTracker{
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		failures:       map[string]*updateFailures{},
+	}
+}
+
+// getBackoff returns the time updates are skipped for after the number of consecutive failures, doubling with each failure up to the maximum
+func (t *updateBackoffTracker) getBackoff(consecutiveFailures int) time.Duration {
+	backoff := t.initialBackoff
+	// without a maximum the doubling stops before the duration would overflow
+	for i := 1; i < consecutiveFailures && backoff < math.MaxInt64/2 && (t.maxBackoff <= 0 || backoff < t.maxBackoff); i++ {
+		backoff *= 2
+	}
+
+	if t.maxBackoff > 0 && backoff > t.maxBackoff {
+		return t.maxBackoff
+	}
+
+	return backoff
+}
+
+// BackingOff returns whether updates of key are skipped because of its recent failures, along with the time until it's retried
+func (t *updateBackoffTracker) BackingOff(key string, now time.Time) (bool, time.Duration) {
+	if t == nil || t.initialBackoff <= 0 {
+		return false, 0
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	failures, ok := t.failures[key]
+	if !ok {
+		return false, 0
+	}
+
+	retryAt := failures.lastFailureAt.Add(t.getBackoff(failures.consecutiveFailures))
+	if !now.Before(retryAt) {
+		return false, 0
+	}
+
+	return true, retryAt.Sub(now)
+}
+
+// RecordFailure counts a failed update of key, extending its backoff
+func (t *updateBackoffTracker) RecordFailure(key string, now time.Time) {
+	if t == nil || t.initialBackoff <= 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	failures, ok := t.failures[key]
+	if !ok {
+		failures = &updateFailures{}
+		t.failures[key] = failures
+	}
+	failures.consecutiveFailures++
+	failures.lastFailureAt = now
+}
+
+// RecordSuccess resets the backoff of key after a successful update
+func (t *updateBackoffTracker) RecordSuccess(key string) {
+	if t == nil || t.initialBackoff <= 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.failures, key)
+}
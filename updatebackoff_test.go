@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateBackoffTracker(t *testing.T) {
+	t.Run("DoesNotBackOffWithoutFailures", func(t *testing.T) {
+
+		tracker := newUpdateBackoffTracker(time.Minute, 30*time.Minute)
+
+		// act
+		backingOff, _ := tracker.BackingOff("my-namespace/my-app", time.Now())
+
+		assert.False(t, backingOff)
+	})
+
+	t.Run("DoublesBackoffWithEachConsecutiveFailureUpToMaximum", func(t *testing.T) {
+
+		tracker := newUpdateBackoffTracker(time.Minute, 10*time.Minute)
+		now := time.Now()
+		retryIns := []time.Duration{}
+
+		// act
+		for i := 0; i < 6; i++ {
+			tracker.RecordFailure("my-namespace/my-app", now)
+			_, retryIn := tracker.BackingOff("my-namespace/my-app", now)
+			retryIns = append(retryIns, retryIn)
+		}
+
+		assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}, retryIns)
+	})
+
+	t.Run("StopsBackingOffOnceBackoffHasPassed", func(t *testing.T) {
+
+		tracker := newUpdateBackoffTracker(time.Minute, 30*time.Minute)
+		now := time.Now()
+		tracker.RecordFailure("my-namespace/my-app", now)
+		tracker.RecordFailure("my-namespace/my-app", now)
+
+		// act
+		backingOffBefore, _ := tracker.BackingOff("my-namespace/my-app", now.Add(119*time.Second))
+		backingOffAfter, _ := tracker.BackingOff("my-namespace/my-app", now.Add(2*time.Minute))
+
+		assert.True(t, backingOffBefore)
+		assert.False(t, backingOffAfter)
+	})
+
+	t.Run("ResetsBackoffOnSuccess", func(t *testing.T) {
+
+		tracker := newUpdateBackoffTracker(time.Minute, 30*time.Minute)
+		now := time.Now()
+		tracker.RecordFailure("my-namespace/my-app", now)
+		tracker.RecordFailure("my-namespace/my-app", now)
+		tracker.RecordSuccess("my-namespace/my-app")
+
+		// act
+		tracker.RecordFailure("my-namespace/my-app", now)
+		_, retryIn := tracker.BackingOff("my-namespace/my-app", now)
+
+		assert.Equal(t, time.Minute, retryIn)
+	})
+
+	t.Run("TracksHPAsSeparately", func(t *testing.T) {
+
+		tracker := newUpdateBackoffTracker(time.Minute, 30*time.Minute)
+		now := time.Now()
+		tracker.RecordFailure("my-namespace/my-app", now)
+
+		// act
+		backingOff, _ := tracker.BackingOff("my-namespace/other-app", now)
+
+		assert.False(t, backingOff)
+	})
+
+	t.Run("DoesNotBackOffIfDisabled", func(t *testing.T) {
+
+		tracker := newUpdateBackoffTracker(0, 30*time.Minute)
+		now := time.Now()
+		tracker.RecordFailure("my-namespace/my-app", now)
+
+		// act
+		backingOff, _ := tracker.BackingOff("my-namespace/my-app", now)
+
+		assert.False(t, backingOff)
+	})
+
+	t.Run("DoesNotOverflowWithoutMaximum", func(t *testing.T) {
+
+		tracker := newUpdateBackoffTracker(time.Minute, 0)
+		now := time.Now()
+		for i := 0; i < 100; i++ {
+			tracker.RecordFailure("my-namespace/my-app", now)
+		}
+
+		// act
+		backingOff, retryIn := tracker.BackingOff("my-namespace/my-app", now)
+
+		assert.True(t, backingOff)
+		assert.True(t, retryIn > 0)
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/alecthomas/kingpin"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	runCommand                      = kingpin.Command("run", "Updates the minReplicas of the annotated hpas based on their request rate.").Default()
+	validateQueryCommand            = kingpin.Command("validate-query", "Executes a Prometheus query once against --prometheus-server-url and prints the request rate and computed replicas, to check a query before annotating an hpa with it.")
+	validateQueryQuery              = validateQueryCommand.Flag("query", "The Prometheus query returning the request rate.").Required().String()
+	validateQueryRequestsPerReplica = validateQueryCommand.Flag("requests-per-replica", "The number of requests per second a single replica can handle.").Required().Float64()
+)
+
+// Executes the query the same way it's executed for an annotated hpa and writes the request rate and computed replicas to out
+func runValidateQuery(ctx context.Context, out io.Writer, query string, requestsPerReplica float64) error {
+	if requestsPerReplica <= 0 {
+		return fmt.Errorf("Requests per replica %v should be larger than 0", requestsPerReplica)
+	}
+
+	// the state is parsed from annotations, so it gets the same defaults as an hpa with only these annotations
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "validate-query",
+			Annotations: map[string]string{
+				annotations.Enabled:            "true",
+				annotations.PrometheusQuery:    query,
+				annotations.RequestsPerReplica: strconv.FormatFloat(requestsPerReplica, 'f', -1, 64),
+			},
+		},
+	}
+	desiredState, errs := parseDesiredHorizontalPodAutoscalerState(hpa)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	if desiredState.PrometheusServerURL == "" {
+		return errors.New("The Prometheus server url should be set with --prometheus-server-url")
+	}
+
+	minPodCount, requestRate, err := getMinPodCountBasedOnPrometheusQuery(ctx, nil, hpa, desiredState)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Request rate: %v\n", requestRate)
+	fmt.Fprintf(out, "Computed replicas: %v\n", minPodCount)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunValidateQuery(t *testing.T) {
+	t.Run("PrintsRequestRateAndComputedReplicas", func(t *testing.T) {
+
+		prometheusServer := newTestPrometheusServer(map[string]string{"requests": "90"})
+		defer prometheusServer.Close()
+		*prometheusServerURL = prometheusServer.URL
+		defer func() { *prometheusServerURL = "" }()
+		out := &bytes.Buffer{}
+
+		// act
+		err := runValidateQuery(context.Background(), out, "requests", 20)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "Request rate: 90\nComputed replicas: 5\n", out.String())
+	})
+
+	t.Run("ReturnsErrorIfQueryHasNoResult", func(t *testing.T) {
+
+		prometheusServer := newTestPrometheusServer(map[string]string{})
+		defer prometheusServer.Close()
+		*prometheusServerURL = prometheusServer.URL
+		defer func() { *prometheusServerURL = "" }()
+		out := &bytes.Buffer{}
+
+		// act
+		err := runValidateQuery(context.Background(), out, "requests", 20)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "", out.String())
+	})
+
+	t.Run("ReturnsErrorIfResponseIsInvalid", func(t *testing.T) {
+
+		queryCache.Clear()
+		prometheusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "not json")
+		}))
+		defer prometheusServer.Close()
+		*prometheusServerURL = prometheusServer.URL
+		defer func() { *prometheusServerURL = "" }()
+
+		// act
+		err := runValidateQuery(context.Background(), &bytes.Buffer{}, "requests", 20)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfRequestsPerReplicaIsNotPositive", func(t *testing.T) {
+
+		*prometheusServerURL = "http://prometheus.example.com"
+		defer func() { *prometheusServerURL = "" }()
+
+		// act
+		err := runValidateQuery(context.Background(), &bytes.Buffer{}, "requests", 0)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorIfPrometheusServerURLIsNotSet", func(t *testing.T) {
+
+		// act
+		err := runValidateQuery(context.Background(), &bytes.Buffer{}, "requests", 20)
+
+		assert.NotNil(t, err)
+	})
+}
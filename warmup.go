@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Returns when a rollout of the application was last seen in progress, now if it's still in progress, otherwise the time stored in the state annotation.
+// The last poll that saw the rollout in progress approximates when it completed.
+func getLastRolloutSeen(ctx context.Context, kubeClient kubernetes.Interface, hpa *autoscalingv1.HorizontalPodAutoscaler, replicaSets *replicaSetsHolder, desiredState HPAScalerState, now time.Time) string {
+	if isDeploymentInProgress(ctx, kubeClient, hpa, replicaSets, desiredState) {
+		return now.Format(time.RFC3339)
+	}
+
+	lastState, _ := getLastState(hpa)
+
+	return lastState.LastRolloutSeen
+}
+
+// Returns whether the warmup grace period after the last rollout hasn't passed yet, during which freshly started pods might not serve their share of requests
+func isInWarmupGracePeriod(desiredState HPAScalerState, now time.Time) bool {
+	if desiredState.WarmupGraceSeconds <= 0 || desiredState.LastRolloutSeen == "" {
+		return false
+	}
+
+	lastRolloutSeen, err := time.Parse(time.RFC3339, desiredState.LastRolloutSeen)
+	if err != nil {
+		return false
+	}
+
+	return now.Sub(lastRolloutSeen) < time.Duration(desiredState.WarmupGraceSeconds)*time.Second
+}
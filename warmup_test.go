@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetLastRolloutSeen(t *testing.T) {
+	t.Run("ReturnsNowIfRolloutIsInProgress", func(t *testing.T) {
+
+		now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"lastRolloutSeen":"2020-01-01T10:00:00Z"}`}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 5),
+			newTestReplicaSet("my-app-2", map[string]string{"app": "my-app"}, "", 5),
+		}}}
+
+		// act
+		lastRolloutSeen := getLastRolloutSeen(context.Background(), fake.NewSimpleClientset(), hpa, replicaSets, HPAScalerState{}, now)
+
+		assert.Equal(t, "2020-01-01T12:00:00Z", lastRolloutSeen)
+	})
+
+	t.Run("ReturnsStoredTimeIfRolloutHasCompleted", func(t *testing.T) {
+
+		now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		hpa := newTestHorizontalPodAutoscaler(10, 20, 10)
+		hpa.Labels = map[string]string{"app": "my-app"}
+		hpa.Annotations = map[string]string{"estafette.io/hpa-scaler-state": `{"lastRolloutSeen":"2020-01-01T10:00:00Z"}`}
+		replicaSets := &replicaSetsHolder{replicaSetList: &appsv1.ReplicaSetList{Items: []appsv1.ReplicaSet{
+			newTestReplicaSet("my-app-1", map[string]string{"app": "my-app"}, "", 0),
+			newTestReplicaSet("my-app-2", map[string]string{"app": "my-app"}, "", 10),
+		}}}
+
+		// act
+		lastRolloutSeen := getLastRolloutSeen(context.Background(), fake.NewSimpleClientset(), hpa, replicaSets, HPAScalerState{}, now)
+
+		assert.Equal(t, "2020-01-01T10:00:00Z", lastRolloutSeen)
+	})
+}
+
+func TestIsInWarmupGracePeriod(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("ReturnsTrueWithinGraceSecondsOfLastRollout", func(t *testing.T) {
+
+		// act
+		inGracePeriod := isInWarmupGracePeriod(HPAScalerState{WarmupGraceSeconds: 300, LastRolloutSeen: "2020-01-01T11:58:00Z"}, now)
+
+		assert.True(t, inGracePeriod)
+	})
+
+	t.Run("ReturnsFalseAfterGraceSecondsOfLastRollout", func(t *testing.T) {
+
+		// act
+		inGracePeriod := isInWarmupGracePeriod(HPAScalerState{WarmupGraceSeconds: 300, LastRolloutSeen: "2020-01-01T11:55:00Z"}, now)
+
+		assert.False(t, inGracePeriod)
+	})
+
+	t.Run("ReturnsFalseWithoutRollout", func(t *testing.T) {
+
+		// act
+		inGracePeriod := isInWarmupGracePeriod(HPAScalerState{WarmupGraceSeconds: 300}, now)
+
+		assert.False(t, inGracePeriod)
+	})
+
+	t.Run("ReturnsFalseIfGracePeriodIsDisabled", func(t *testing.T) {
+
+		// act
+		inGracePeriod := isInWarmupGracePeriod(HPAScalerState{LastRolloutSeen: "2020-01-01T11:58:00Z"}, now)
+
+		assert.False(t, inGracePeriod)
+	})
+}
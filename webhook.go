@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	admissionv1 "k8s.io/api/admission/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Returns the admission response for the request, rejecting hpas with scaler annotations that can't be parsed
+func reviewHorizontalPodAutoscaler(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{
+		UID:     request.UID,
+		Allowed: true,
+	}
+
+	var hpa autoscalingv1.HorizontalPodAutoscaler
+	if err := json.Unmarshal(request.Object.Raw, &hpa); err != nil {
+		response.Allowed = false
+		response.Result = &metav1.Status{Message: fmt.Sprintf("Unmarshalling hpa failed: %v", err)}
+		return response
+	}
+
+	_, errs := parseDesiredHorizontalPodAutoscalerState(&hpa)
+	if len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, err := range errs {
+			messages[i] = err.Error()
+		}
+
+		log.Info().Msgf("Rejecting hpa %v in namespace %v because of invalid annotations: %v", hpa.Name, request.Namespace, strings.Join(messages, "; "))
+
+		response.Allowed = false
+		response.Result = &metav1.Status{Message: strings.Join(messages, "; ")}
+	}
+
+	return response
+}
+
+// Handles admission reviews sent by the kubernetes api server for hpas being created or updated
+func webhookHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error().Err(err).Msg("Reading admission review request body failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		log.Error().Err(err).Msg("Unmarshalling admission review request body failed")
+		http.Error(w, "Invalid admission review", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = reviewHorizontalPodAutoscaler(review.Request)
+	review.Request = nil
+
+	responseBody, err := json.Marshal(review)
+	if err != nil {
+		log.Error().Err(err).Msg("Marshalling admission review response failed")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseBody)
+}
+
+// Initializes the /validate endpoint on the specified port, serving tls with the certificate and key files
+func initWebhook(port int, certFile, keyFile string) {
+	go func() {
+		portString := fmt.Sprintf(":%v", port)
+		log.Debug().
+			Str("port", portString).
+			Msg("Serving /validate endpoint...")
+
+		serverMux := http.NewServeMux()
+		serverMux.HandleFunc("/validate", webhookHandler)
+
+		if err := http.ListenAndServeTLS(portString, certFile, keyFile, serverMux); err != nil {
+			log.Fatal().Err(err).Msg("Starting /validate listener failed")
+		}
+	}()
+}
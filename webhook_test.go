@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newTestAdmissionReviewBody(t *testing.T, annotations map[string]string) *bytes.Buffer {
+	hpa := newTestHorizontalPodAutoscaler(3, 20, 10)
+	hpa.Annotations = annotations
+	hpaBytes, err := json.Marshal(hpa)
+	assert.Nil(t, err)
+
+	review := admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "my-uid",
+			Namespace: "my-namespace",
+			Object:    runtime.RawExtension{Raw: hpaBytes},
+		},
+	}
+	reviewBytes, err := json.Marshal(review)
+	assert.Nil(t, err)
+
+	return bytes.NewBuffer(reviewBytes)
+}
+
+func TestWebhookHandler(t *testing.T) {
+	t.Run("AllowsHPAWithValidAnnotations", func(t *testing.T) {
+
+		body := newTestAdmissionReviewBody(t, map[string]string{
+			"estafette.io/hpa-scaler":                      "true",
+			"estafette.io/hpa-scaler-requests-per-replica": "2.5",
+			"estafette.io/hpa-scaler-min-change":           "2",
+		})
+		recorder := httptest.NewRecorder()
+
+		// act
+		webhookHandler(recorder, httptest.NewRequest("POST", "/validate", body))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var review admissionv1.AdmissionReview
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &review))
+		assert.Equal(t, "my-uid", string(review.Response.UID))
+		assert.True(t, review.Response.Allowed)
+	})
+
+	t.Run("AllowsHPAWithoutAnnotations", func(t *testing.T) {
+
+		body := newTestAdmissionReviewBody(t, nil)
+		recorder := httptest.NewRecorder()
+
+		// act
+		webhookHandler(recorder, httptest.NewRequest("POST", "/validate", body))
+
+		var review admissionv1.AdmissionReview
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &review))
+		assert.True(t, review.Response.Allowed)
+	})
+
+	t.Run("RejectsHPAWithUnparseableAnnotations", func(t *testing.T) {
+
+		body := newTestAdmissionReviewBody(t, map[string]string{
+			"estafette.io/hpa-scaler":                      "true",
+			"estafette.io/hpa-scaler-requests-per-replica": "lots",
+			"estafette.io/hpa-scaler-min-change":           "2.5",
+		})
+		recorder := httptest.NewRecorder()
+
+		// act
+		webhookHandler(recorder, httptest.NewRequest("POST", "/validate", body))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var review admissionv1.AdmissionReview
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &review))
+		assert.Equal(t, "my-uid", string(review.Response.UID))
+		assert.False(t, review.Response.Allowed)
+		assert.Contains(t, review.Response.Result.Message, "estafette.io/hpa-scaler-requests-per-replica")
+		assert.Contains(t, review.Response.Result.Message, "estafette.io/hpa-scaler-min-change")
+	})
+
+	t.Run("RejectsHPAWithUnknownQueryAggregation", func(t *testing.T) {
+
+		body := newTestAdmissionReviewBody(t, map[string]string{
+			"estafette.io/hpa-scaler":                              "true",
+			"estafette.io/hpa-scaler-prometheus-query-aggregation": "average",
+		})
+		recorder := httptest.NewRecorder()
+
+		// act
+		webhookHandler(recorder, httptest.NewRequest("POST", "/validate", body))
+
+		var review admissionv1.AdmissionReview
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &review))
+		assert.False(t, review.Response.Allowed)
+	})
+
+	t.Run("ReturnsBadRequestForInvalidAdmissionReview", func(t *testing.T) {
+
+		recorder := httptest.NewRecorder()
+
+		// act
+		webhookHandler(recorder, httptest.NewRequest("POST", "/validate", bytes.NewBufferString("{}")))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}